@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ssh-ftp-proxy/internal/encoder"
+)
+
+// client is a thin wrapper around the proxy HTTP API.
+type client struct {
+	profile Profile
+	http    *http.Client
+}
+
+func newClient(p Profile, timeout time.Duration) *client {
+	return &client{
+		profile: p,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// apiError is returned when the proxy answers with a non-2xx status.
+type apiError struct {
+	Status  int
+	Code    string // /api/v2 error code, empty for legacy bodies
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("server returned %d (%s): %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+func (c *client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(c.profile.Server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// do sends req and decodes the JSON response into out.
+// Error bodies are decoded as well so callers can inspect endpoint-specific fields.
+func (c *client) do(req *http.Request, out any) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return parseError(resp.StatusCode, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// parseError decodes an error body. /api/v2 wraps a code and message in an
+// envelope; legacy SSH and FTP endpoints Base64-encode a plain "error" string,
+// file endpoints do not.
+func parseError(status int, data []byte) *apiError {
+	e := &apiError{Status: status, Message: strings.TrimSpace(string(data))}
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || len(body.Error) == 0 {
+		return e
+	}
+
+	var v2 struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body.Error, &v2); err == nil {
+		if v2.Message != "" {
+			e.Code, e.Message = v2.Code, v2.Message
+		}
+		return e
+	}
+
+	var legacy string
+	if err := json.Unmarshal(body.Error, &legacy); err != nil || legacy == "" {
+		return e
+	}
+	e.Message = legacy
+	if decoded, err := encoder.Decode(legacy); err == nil && isPrintable(decoded) {
+		e.Message = decoded
+	}
+	return e
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *client) postJSON(path string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+func (c *client) get(path string, out any) error {
+	req, err := c.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// execResult mirrors server.SSHExecResponse
+type execResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// decodedResult is the human-readable form of execResult, used for JSON output.
+type decodedResult struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (r execResult) decode() decodedResult {
+	stdout, _ := encoder.Decode(r.Stdout)
+	stderr, _ := encoder.Decode(r.Stderr)
+	errMsg, _ := encoder.Decode(r.Error)
+	return decodedResult{Stdout: stdout, Stderr: stderr, ExitCode: r.ExitCode, Error: errMsg}
+}
+
+func (c *client) exec(cmd string) (decodedResult, error) {
+	var res execResult
+	err := c.postJSON("/api/ssh/exec", map[string]string{"command": encoder.Encode(cmd)}, &res)
+	return res.decode(), err
+}
+
+type scriptResult struct {
+	Results []execResult `json:"results"`
+	Total   int          `json:"total"`
+	Failed  int          `json:"failed"`
+}
+
+func (c *client) script(script string, commands []string) (scriptResult, error) {
+	req := map[string]any{}
+	if script != "" {
+		req["script"] = encoder.Encode(script)
+	} else {
+		encoded := make([]string, len(commands))
+		for i, cmd := range commands {
+			encoded[i] = encoder.Encode(cmd)
+		}
+		req["commands"] = encoded
+	}
+	var res scriptResult
+	err := c.postJSON("/api/ssh/script", req, &res)
+	return res, err
+}
+
+// taskInfo mirrors server.AsyncTask
+type taskInfo struct {
+	ID        string      `json:"id"`
+	Status    string      `json:"status"`
+	Command   string      `json:"command"`
+	Result    *execResult `json:"result,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	DoneAt    *time.Time  `json:"done_at,omitempty"`
+}
+
+func (c *client) startTask(cmd string) (string, error) {
+	var res struct {
+		TaskID string `json:"task_id"`
+	}
+	err := c.postJSON("/api/ssh/exec/async", map[string]string{"command": encoder.Encode(cmd)}, &res)
+	return res.TaskID, err
+}
+
+func (c *client) task(id string) (taskInfo, error) {
+	var res taskInfo
+	err := c.get("/api/ssh/task/"+id, &res)
+	return res, err
+}
+
+// fileInfo mirrors file.FileInfo
+type fileInfo struct {
+	Name    string `json:"name"`
+	IsDir   bool   `json:"is_dir"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+func (c *client) list(path string) ([]fileInfo, error) {
+	var res struct {
+		Files []fileInfo `json:"files"`
+	}
+	err := c.postJSON("/api/file/list", map[string]string{"path": encoder.Encode(path)}, &res)
+	return res.Files, err
+}
+
+func (c *client) download(path string) ([]byte, error) {
+	var res struct {
+		Content string `json:"content"`
+	}
+	if err := c.postJSON("/api/file/download", map[string]string{"path": encoder.Encode(path)}, &res); err != nil {
+		return nil, err
+	}
+	return encoder.DecodeBytes(res.Content)
+}
+
+type uploadResult struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Error   string `json:"error,omitempty"`
+}
+
+// upload streams a local file to /api/file/upload as multipart without buffering it in memory.
+func (c *client) upload(localPath, remotePath string, extract bool) (uploadResult, error) {
+	var res uploadResult
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			if err := mw.WriteField("path", encoder.Encode(remotePath)); err != nil {
+				return err
+			}
+			if extract {
+				if err := mw.WriteField("extract", "true"); err != nil {
+					return err
+				}
+			}
+			part, err := mw.CreateFormFile("file", filepath.Base(localPath))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, f); err != nil {
+				return err
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	req, err := c.newRequest(http.MethodPost, "/api/file/upload", pr)
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	err = c.do(req, &res)
+	return res, err
+}
+
+func (c *client) remove(paths []string) error {
+	if len(paths) == 1 {
+		return c.postJSON("/api/file/delete", map[string]string{"path": encoder.Encode(paths[0])}, nil)
+	}
+	encoded := make([]string, len(paths))
+	for i, p := range paths {
+		encoded[i] = encoder.Encode(p)
+	}
+	var res struct {
+		Failed []struct {
+			Path  string `json:"path"`
+			Error string `json:"error"`
+		} `json:"failed"`
+	}
+	if err := c.postJSON("/api/file/batch/delete", map[string][]string{"paths": encoded}, &res); err != nil {
+		return err
+	}
+	if len(res.Failed) > 0 {
+		msgs := make([]string, 0, len(res.Failed))
+		for _, f := range res.Failed {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", f.Path, f.Error))
+		}
+		return fmt.Errorf("failed to delete %d path(s): %s", len(res.Failed), strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func (c *client) copy(src, dst string) error {
+	return c.postJSON("/api/file/copy", map[string]string{"src": encoder.Encode(src), "dst": encoder.Encode(dst)}, nil)
+}
+
+func (c *client) move(src, dst string) error {
+	return c.postJSON("/api/file/rename", map[string]string{"src": encoder.Encode(src), "dst": encoder.Encode(dst)}, nil)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"ssh-ftp-proxy/internal/encoder"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want apiError
+	}{
+		{
+			name: "v2 envelope",
+			body: `{"error": {"code": "not_found", "message": "no such file", "details": {"path": "/x"}}}`,
+			want: apiError{Status: http.StatusNotFound, Code: "not_found", Message: "no such file"},
+		},
+		{
+			name: "legacy base64",
+			body: `{"error": "` + encoder.Encode("connection refused") + `"}`,
+			want: apiError{Status: http.StatusNotFound, Message: "connection refused"},
+		},
+		{
+			name: "legacy plain",
+			body: `{"error": "path is outside allowed directories"}`,
+			want: apiError{Status: http.StatusNotFound, Message: "path is outside allowed directories"},
+		},
+		{
+			name: "not json",
+			body: "404 page not found\n",
+			want: apiError{Status: http.StatusNotFound, Message: "404 page not found"},
+		},
+		{
+			name: "no error field",
+			body: `{"success": false}`,
+			want: apiError{Status: http.StatusNotFound, Message: `{"success": false}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseError(http.StatusNotFound, []byte(tt.body)); *got != tt.want {
+				t.Errorf("parseError = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	v2 := apiError{Status: http.StatusBadGateway, Code: "ssh_connect_failed", Message: "dial failed"}
+	if got, want := v2.Error(), "server returned 502 (ssh_connect_failed): dial failed"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
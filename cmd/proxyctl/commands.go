@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type commandFunc func(g *globals, args []string) (int, error)
+
+var commands = map[string]commandFunc{
+	"exec":   cmdExec,
+	"script": cmdScript,
+	"task":   cmdTask,
+	"shell":  cmdShell,
+	"ls":     cmdList,
+	"get":    cmdGet,
+	"put":    cmdPut,
+	"rm":     cmdRemove,
+	"cp":     cmdCopy,
+	"mv":     cmdMove,
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// printResult writes an SSH result the way a local shell would: stdout to stdout, stderr to stderr.
+func printResult(r decodedResult) {
+	fmt.Fprint(os.Stdout, r.Stdout)
+	fmt.Fprint(os.Stderr, r.Stderr)
+}
+
+// ============ SSH Commands ============
+
+func cmdExec(g *globals, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, usageError("command is required")
+	}
+	res, err := g.client.exec(strings.Join(args, " "))
+	if err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(res)
+	} else {
+		printResult(res)
+		if res.Error != "" && res.ExitCode < 0 {
+			fmt.Fprintln(os.Stderr, "proxyctl:", res.Error)
+		}
+	}
+	return exitStatus(res.ExitCode), nil
+}
+
+// exitStatus maps a remote exit code to a local process exit status.
+// Connection failures are reported by the server as -1.
+func exitStatus(code int) int {
+	if code < 0 {
+		return 1
+	}
+	return code
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func cmdScript(g *globals, args []string) (int, error) {
+	fs := flag.NewFlagSet("script", flag.ContinueOnError)
+	var cmds stringList
+	fs.Var(&cmds, "c", "Command to run (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 0, usageError(err.Error())
+	}
+
+	var script string
+	switch {
+	case len(cmds) > 0 && fs.NArg() > 0:
+		return 0, usageError("use either a script file or -c, not both")
+	case len(cmds) == 0 && fs.NArg() != 1:
+		return 0, usageError("script file (or - for stdin) is required")
+	case len(cmds) == 0:
+		var data []byte
+		var err error
+		if fs.Arg(0) == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(fs.Arg(0))
+		}
+		if err != nil {
+			return 0, err
+		}
+		script = string(data)
+	}
+
+	res, err := g.client.script(script, cmds)
+	if err != nil {
+		return 0, err
+	}
+
+	results := make([]decodedResult, len(res.Results))
+	for i, r := range res.Results {
+		results[i] = r.decode()
+	}
+	if g.json {
+		printJSON(map[string]any{"results": results, "total": res.Total, "failed": res.Failed})
+	} else {
+		for i, r := range results {
+			if len(results) > 1 {
+				fmt.Fprintf(os.Stderr, "==> [%d/%d] %s (exit %d)\n", i+1, len(results), commandLabel(cmds, i), r.ExitCode)
+			}
+			printResult(r)
+		}
+	}
+
+	// Last exit code wins, like a shell script
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return exitStatus(results[len(results)-1].ExitCode), nil
+}
+
+func commandLabel(cmds []string, i int) string {
+	if i < len(cmds) {
+		return cmds[i]
+	}
+	return "script"
+}
+
+func cmdTask(g *globals, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, usageError("subcommand is required: run, status or wait")
+	}
+	switch args[0] {
+	case "run":
+		if len(args) < 2 {
+			return 0, usageError("command is required")
+		}
+		id, err := g.client.startTask(strings.Join(args[1:], " "))
+		if err != nil {
+			return 0, err
+		}
+		if g.json {
+			printJSON(map[string]string{"task_id": id})
+		} else {
+			fmt.Println(id)
+		}
+		return 0, nil
+
+	case "status":
+		if len(args) != 2 {
+			return 0, usageError("task ID is required")
+		}
+		t, err := g.client.task(args[1])
+		if err != nil {
+			return 0, err
+		}
+		printTask(g, t)
+		return 0, nil
+
+	case "wait":
+		fs := flag.NewFlagSet("task wait", flag.ContinueOnError)
+		interval := fs.Duration("interval", 2*time.Second, "Polling interval")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 0, usageError(err.Error())
+		}
+		if fs.NArg() != 1 {
+			return 0, usageError("task ID is required")
+		}
+		for {
+			t, err := g.client.task(fs.Arg(0))
+			if err != nil {
+				return 0, err
+			}
+			if t.Status != "running" {
+				printTask(g, t)
+				if t.Result == nil {
+					return 1, nil
+				}
+				return exitStatus(t.Result.ExitCode), nil
+			}
+			time.Sleep(*interval)
+		}
+
+	default:
+		return 0, usageError(fmt.Sprintf("unknown task subcommand %q", args[0]))
+	}
+}
+
+func printTask(g *globals, t taskInfo) {
+	var res *decodedResult
+	if t.Result != nil {
+		r := t.Result.decode()
+		res = &r
+	}
+	if g.json {
+		printJSON(map[string]any{
+			"id":         t.ID,
+			"status":     t.Status,
+			"command":    t.Command,
+			"result":     res,
+			"created_at": t.CreatedAt,
+			"done_at":    t.DoneAt,
+		})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "task %s: %s (%s)\n", t.ID, t.Status, t.Command)
+	if res != nil {
+		printResult(*res)
+		if res.Error != "" && res.ExitCode < 0 {
+			fmt.Fprintln(os.Stderr, "proxyctl:", res.Error)
+		}
+	}
+}
+
+// ============ File Commands ============
+
+func cmdList(g *globals, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, usageError("path is required")
+	}
+	files, err := g.client.list(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if g.json {
+		if files == nil {
+			files = []fileInfo{}
+		}
+		printJSON(files)
+		return 0, nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range files {
+		name := f.Name
+		if f.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", f.Size, time.Unix(f.ModTime, 0).Format("2006-01-02 15:04"), name)
+	}
+	w.Flush()
+	return 0, nil
+}
+
+func cmdGet(g *globals, args []string) (int, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return 0, usageError("usage: get <remote> [local|-]")
+	}
+	remote := args[0]
+	local := filepath.Base(remote)
+	if len(args) == 2 {
+		local = args[1]
+	}
+
+	content, err := g.client.download(remote)
+	if err != nil {
+		return 0, err
+	}
+	if local == "-" {
+		os.Stdout.Write(content)
+		return 0, nil
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local = filepath.Join(local, filepath.Base(remote))
+	}
+	if err := os.WriteFile(local, content, 0644); err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(map[string]any{"path": local, "size": len(content)})
+	} else {
+		fmt.Fprintf(os.Stderr, "%s -> %s (%d bytes)\n", remote, local, len(content))
+	}
+	return 0, nil
+}
+
+func cmdPut(g *globals, args []string) (int, error) {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	extract := fs.Bool("extract", false, "Extract the uploaded archive (.tar.gz, .tgz, .tar, .zip) on the server")
+	if err := fs.Parse(args); err != nil {
+		return 0, usageError(err.Error())
+	}
+	if fs.NArg() != 2 {
+		return 0, usageError("usage: put [-extract] <local> <remote>")
+	}
+
+	res, err := g.client.upload(fs.Arg(0), fs.Arg(1), *extract)
+	if err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(res)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s -> %s (%d bytes)\n", fs.Arg(0), res.Path, res.Size)
+		if res.Error != "" {
+			fmt.Fprintln(os.Stderr, "proxyctl:", res.Error)
+		}
+	}
+	if res.Error != "" {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func cmdRemove(g *globals, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, usageError("at least one path is required")
+	}
+	if err := g.client.remove(args); err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(map[string]any{"success": true, "paths": args})
+	}
+	return 0, nil
+}
+
+func cmdCopy(g *globals, args []string) (int, error) {
+	if len(args) != 2 {
+		return 0, usageError("usage: cp <src> <dst>")
+	}
+	if err := g.client.copy(args[0], args[1]); err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(map[string]any{"success": true, "src": args[0], "dst": args[1]})
+	}
+	return 0, nil
+}
+
+func cmdMove(g *globals, args []string) (int, error) {
+	if len(args) != 2 {
+		return 0, usageError("usage: mv <src> <dst>")
+	}
+	if err := g.client.move(args[0], args[1]); err != nil {
+		return 0, err
+	}
+	if g.json {
+		printJSON(map[string]any{"success": true, "src": args[0], "dst": args[1]})
+	}
+	return 0, nil
+}
@@ -0,0 +1,118 @@
+// Command proxyctl is a command-line client for the AI SSH/FTP Proxy HTTP and WebSocket API.
+//
+// Usage:
+//
+//	proxyctl [global flags] <command> [args]
+//
+// Connection settings come from a profile file (see Profile), the PROXYCTL_*
+// environment variables and the global flags, in increasing priority.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const usage = `Usage: proxyctl [global flags] <command> [args]
+
+Commands:
+  exec <command...>                 Run a command over SSH, exits with its exit code
+  script <file|->                   Run a bash script (use - for stdin)
+  script -c <cmd> [-c <cmd>...]     Run a list of commands sequentially
+  task run <command...>             Start a command asynchronously and print its task ID
+  task status <id>                  Show the status of an async task
+  task wait [-interval d] <id>      Wait for an async task and print its result
+  shell                             Open an interactive terminal over /ws/ssh
+  ls <path>                         List a directory
+  get <remote> [local|-]            Download a file (default: same name in current dir)
+  put [-extract] <local> <remote>   Upload a file (remote ending in / is a directory)
+  rm <path...>                      Delete files or directories
+  cp <src> <dst>                    Copy a file or directory
+  mv <src> <dst>                    Move or rename a file or directory
+
+Global flags:
+`
+
+// globals holds the resolved global flags shared by all commands.
+type globals struct {
+	client *client
+	json   bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("proxyctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", defaultProfilePath(), "Path to profile file (env PROXYCTL_CONFIG)")
+	profileName := fs.String("profile", "", "Profile name (default: the file's 'current' profile)")
+	server := fs.String("server", "", "Server URL, e.g. http://host:48891 (env PROXYCTL_SERVER)")
+	output := fs.String("o", "", "Output format: human or json")
+	jsonOut := fs.Bool("json", false, "Shorthand for -o json")
+	timeout := fs.Duration("timeout", 5*time.Minute, "HTTP request timeout")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	flags := Profile{Server: *server, Output: *output}
+	if *jsonOut {
+		flags.Output = "json"
+	}
+	p, err := resolveProfile(*configPath, *profileName, flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "proxyctl:", err)
+		return 2
+	}
+
+	g := &globals{
+		client: newClient(p, *timeout),
+		json:   p.Output == "json",
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	handler, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "proxyctl: unknown command %q\n\n", cmd)
+		fs.Usage()
+		return 2
+	}
+
+	code, err := handler(g, cmdArgs)
+	if err != nil {
+		var uerr usageError
+		if errors.As(err, &uerr) {
+			fmt.Fprintf(os.Stderr, "proxyctl %s: %s\n", cmd, uerr)
+			return 2
+		}
+		if g.json {
+			printJSON(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintln(os.Stderr, "proxyctl:", err)
+		}
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+// usageError marks errors caused by wrong command-line arguments (exit status 2).
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ssh-ftp-proxy/internal/encoder"
+)
+
+func TestRunExitStatus(t *testing.T) {
+	for _, key := range []string{"PROXYCTL_SERVER", "PROXYCTL_TOKEN", "PROXYCTL_TARGET"} {
+		t.Setenv(key, "")
+	}
+	// The command decides the answer: "exit N" exits N, "down" cannot
+	// connect, "broken" is a server error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Command string `json:"command"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		cmd, _ := encoder.Decode(req.Command)
+		w.Header().Set("Content-Type", "application/json")
+		switch cmd {
+		case "exit 0":
+			w.Write([]byte(`{"stdout": "", "stderr": "", "exit_code": 0}`))
+		case "exit 3":
+			w.Write([]byte(`{"stdout": "", "stderr": "", "exit_code": 3}`))
+		case "down":
+			w.Write([]byte(`{"stdout": "", "stderr": "", "exit_code": -1, "error": "` + encoder.Encode("dial failed") + `"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error": {"code": "upstream_error", "message": "broken"}}`))
+		}
+	}))
+	defer srv.Close()
+	global := []string{"-config", filepath.Join(t.TempDir(), "none.yaml"), "-server", srv.URL}
+
+	tests := []struct {
+		name string
+		args []string
+		env  string // PROXYCTL_TOKEN
+		want int
+	}{
+		{name: "success", args: []string{"exec", "exit", "0"}, want: 0},
+		{name: "remote exit code", args: []string{"exec", "exit", "3"}, want: 3},
+		{name: "connection failure", args: []string{"exec", "down"}, want: 1},
+		{name: "api error", args: []string{"exec", "broken"}, want: 1},
+		{name: "missing argument", args: []string{"exec"}, want: 2},
+		{name: "unknown command", args: []string{"frobnicate"}, want: 2},
+		{name: "removed token flag", args: []string{"-token", "secret", "exec", "exit", "0"}, want: 2},
+		{name: "unsupported token", args: []string{"exec", "exit", "0"}, env: "secret", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROXYCTL_TOKEN", tt.env)
+			args := append(append([]string{}, global...), tt.args...)
+			if got := run(args); got != tt.want {
+				t.Errorf("run(%v) = %d, want %d", args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	for code, want := range map[int]int{0: 0, 1: 1, 127: 127, -1: 1} {
+		if got := exitStatus(code); got != want {
+			t.Errorf("exitStatus(%d) = %d, want %d", code, got, want)
+		}
+	}
+}
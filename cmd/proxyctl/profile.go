@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// Profile holds the connection settings for one proxy deployment.
+type Profile struct {
+	Server   string `mapstructure:"server"`    // HTTP API base URL, e.g. http://host:48891
+	WSServer string `mapstructure:"ws_server"` // WebSocket base URL, defaults to server host with ws_port
+	WSPort   int    `mapstructure:"ws_port"`
+	Output   string `mapstructure:"output"` // "human" or "json"
+
+	// Token and Target are not supported: the API has no authentication and
+	// each proxy serves the targets in its own config. They are only read so
+	// that setting one is an error instead of being silently ignored.
+	Token  string `mapstructure:"token"`
+	Target string `mapstructure:"target"`
+}
+
+// profileFile is the on-disk layout of the profile file:
+//
+//	current: prod
+//	profiles:
+//	  prod:
+//	    server: http://10.0.0.5:48891
+//	    output: json
+type profileFile struct {
+	Current  string             `mapstructure:"current"`
+	Profiles map[string]Profile `mapstructure:"profiles"`
+}
+
+const (
+	defaultServer = "http://127.0.0.1:48891"
+	defaultWSPort = 48892
+)
+
+// defaultProfilePath returns $PROXYCTL_CONFIG or ~/.config/proxyctl/config.yaml
+func defaultProfilePath() string {
+	if p := os.Getenv("PROXYCTL_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "proxyctl", "config.yaml")
+}
+
+// loadProfile reads the named profile (or the file's current one) from path.
+// A missing file is not an error: the built-in defaults are used instead.
+func loadProfile(path, name string) (Profile, error) {
+	p := Profile{}
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			v := viper.New()
+			v.SetConfigFile(path)
+			v.SetConfigType("yaml")
+			if err := v.ReadInConfig(); err != nil {
+				return p, fmt.Errorf("failed to read profile file %s: %w", path, err)
+			}
+			var f profileFile
+			if err := v.Unmarshal(&f); err != nil {
+				return p, fmt.Errorf("failed to parse profile file %s: %w", path, err)
+			}
+			if name == "" {
+				name = f.Current
+			}
+			if name != "" {
+				found, ok := f.Profiles[name]
+				if !ok {
+					return p, fmt.Errorf("profile %q not found in %s", name, path)
+				}
+				p = found
+			}
+		} else if name != "" {
+			return p, fmt.Errorf("profile %q requested but %s does not exist", name, path)
+		}
+	}
+
+	// Environment overrides the file, flags override the environment (see resolveProfile)
+	if v := os.Getenv("PROXYCTL_SERVER"); v != "" {
+		p.Server = v
+	}
+	if v := os.Getenv("PROXYCTL_TOKEN"); v != "" {
+		p.Token = v
+	}
+	if v := os.Getenv("PROXYCTL_TARGET"); v != "" {
+		p.Target = v
+	}
+	return p, nil
+}
+
+// resolveProfile loads the profile, applies the non-empty fields of flags over
+// it and fills in the defaults
+func resolveProfile(path, name string, flags Profile) (Profile, error) {
+	p, err := loadProfile(path, name)
+	if err != nil {
+		return p, err
+	}
+	if flags.Server != "" {
+		p.Server = flags.Server
+	}
+	if flags.Output != "" {
+		p.Output = flags.Output
+	}
+	if p.Server == "" {
+		p.Server = defaultServer
+	}
+	return p, p.validate()
+}
+
+// validate rejects settings the client cannot honour
+func (p Profile) validate() error {
+	if p.Output != "" && p.Output != "human" && p.Output != "json" {
+		return fmt.Errorf("unknown output format %q", p.Output)
+	}
+	if p.Token != "" {
+		return errors.New("token is not supported: the proxy API has no authentication, unset it in the profile or PROXYCTL_TOKEN")
+	}
+	if p.Target != "" {
+		return errors.New("target is not supported: the proxy serves the targets in its own config, unset it in the profile or PROXYCTL_TARGET")
+	}
+	return nil
+}
+
+// wsURL derives the WebSocket base URL from the HTTP server URL when not set explicitly.
+func (p Profile) wsURL() (string, error) {
+	if p.WSServer != "" {
+		return p.WSServer, nil
+	}
+	u, err := url.Parse(p.Server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server url: %w", err)
+	}
+	scheme := "ws"
+	if u.Scheme == "https" {
+		scheme = "wss"
+	}
+	port := p.WSPort
+	if port == 0 {
+		port = defaultWSPort
+	}
+	return fmt.Sprintf("%s://%s", scheme, u.Hostname()+":"+strconv.Itoa(port)), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveProfile(t *testing.T) {
+	path := writeProfile(t, `
+current: prod
+profiles:
+  prod:
+    server: http://file:1
+    output: json
+  dev:
+    server: http://dev:1
+`)
+	tests := []struct {
+		name    string
+		profile string
+		env     string
+		flags   Profile
+		want    Profile
+	}{
+		{name: "file", want: Profile{Server: "http://file:1", Output: "json"}},
+		{name: "named profile", profile: "dev", want: Profile{Server: "http://dev:1"}},
+		{name: "env over file", env: "http://env:1", want: Profile{Server: "http://env:1", Output: "json"}},
+		{
+			name:  "flag over env",
+			env:   "http://env:1",
+			flags: Profile{Server: "http://flag:1", Output: "human"},
+			want:  Profile{Server: "http://flag:1", Output: "human"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROXYCTL_SERVER", tt.env)
+			got, err := resolveProfile(path, tt.profile, tt.flags)
+			if err != nil {
+				t.Fatalf("resolveProfile: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("profile = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("defaults without a file", func(t *testing.T) {
+		for _, key := range []string{"PROXYCTL_SERVER", "PROXYCTL_TOKEN", "PROXYCTL_TARGET"} {
+			t.Setenv(key, "")
+		}
+		got, err := resolveProfile(filepath.Join(t.TempDir(), "none.yaml"), "", Profile{})
+		if err != nil || got.Server != defaultServer {
+			t.Errorf("profile = %+v, %v, want the default server", got, err)
+		}
+	})
+	t.Run("unknown profile", func(t *testing.T) {
+		if _, err := resolveProfile(path, "staging", Profile{}); err == nil || !strings.Contains(err.Error(), `"staging" not found`) {
+			t.Errorf("error = %v, want profile not found", err)
+		}
+	})
+}
+
+func TestResolveProfileUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		flags   Profile
+		wantErr string
+	}{
+		{
+			name:    "token in file",
+			file:    "profiles:\n  p:\n    token: secret\ncurrent: p\n",
+			wantErr: "token is not supported",
+		},
+		{
+			name:    "token in env",
+			env:     map[string]string{"PROXYCTL_TOKEN": "secret"},
+			wantErr: "token is not supported",
+		},
+		{
+			name:    "target in file",
+			file:    "profiles:\n  p:\n    target: web1\ncurrent: p\n",
+			wantErr: "target is not supported",
+		},
+		{
+			name:    "target in env",
+			env:     map[string]string{"PROXYCTL_TARGET": "web1"},
+			wantErr: "target is not supported",
+		},
+		{
+			name:    "output",
+			flags:   Profile{Output: "yaml"},
+			wantErr: `unknown output format "yaml"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"PROXYCTL_SERVER", "PROXYCTL_TOKEN", "PROXYCTL_TARGET"} {
+				t.Setenv(key, tt.env[key])
+			}
+			path := filepath.Join(t.TempDir(), "none.yaml")
+			if tt.file != "" {
+				path = writeProfile(t, tt.file)
+			}
+			if _, err := resolveProfile(path, "", tt.flags); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
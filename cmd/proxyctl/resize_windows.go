@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// notifyResize is a no-op on Windows, which has no SIGWINCH; the initial size is still sent.
+func notifyResize(fn func()) (stop func()) {
+	return func() {}
+}
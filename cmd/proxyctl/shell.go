@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"ssh-ftp-proxy/internal/encoder"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// wsMessage mirrors ssh.WSMessage
+type wsMessage struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+}
+
+// cmdShell opens an interactive shell over /ws/ssh with the local terminal in raw mode.
+func cmdShell(g *globals, args []string) (int, error) {
+	if len(args) != 0 {
+		return 0, usageError("shell takes no arguments")
+	}
+
+	base, err := g.client.profile.wsURL()
+	if err != nil {
+		return 0, err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(strings.TrimRight(base, "/")+"/ws/ssh", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to %s: %w", base, err)
+	}
+	defer conn.Close()
+
+	// gorilla/websocket supports one concurrent writer
+	var writeMu sync.Mutex
+	send := func(msg wsMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteJSON(msg)
+	}
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set raw mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+
+		sendSize := func() {
+			if cols, rows, err := term.GetSize(fd); err == nil {
+				send(wsMessage{Type: "resize", Payload: fmt.Sprintf("%d,%d", rows, cols)})
+			}
+		}
+		sendSize()
+		stop := notifyResize(sendSize)
+		defer stop()
+	}
+
+	// Local stdin -> WS
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				if send(wsMessage{Type: "input", Payload: encoder.EncodeBytes(buf[:n])}) != nil {
+					return
+				}
+			}
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	// WS -> local stdout until the remote shell exits
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return 0, nil
+		}
+		switch msg.Type {
+		case "output":
+			data, err := encoder.DecodeBytes(msg.Payload)
+			if err != nil {
+				continue
+			}
+			os.Stdout.Write(data)
+		case "error":
+			text, _ := encoder.Decode(msg.Payload)
+			return 0, fmt.Errorf("remote error: %s", text)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"go.uber.org/zap"
+)
+
+// runCheckConfig implements check-config: it loads and validates the config
+// like the server does, optionally connects to each backend, and returns the
+// exit code
+func runCheckConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ssh-ftp-proxy check-config [--config path] [--connect]")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "config/config.yaml", "Path to config file")
+	connect := fs.Bool("connect", false, "Also connect and log in to the SSH and FTP servers")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	absPath, _ := filepath.Abs(*configPath)
+	cfg, err := config.Read(absPath)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Printf("%s: invalid\n%v\n", absPath, err)
+		return 1
+	}
+	if _, err := os.Stat(absPath); errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s: not found, using defaults + env vars\n", absPath)
+	}
+	fmt.Printf("%s: OK\n", absPath)
+	if !*connect {
+		return 0
+	}
+
+	// Connection errors are printed below; the services' own logging is noise here
+	log := zap.NewNop().Sugar()
+	sshManager := ssh.NewManager(log)
+	defer sshManager.Close()
+	sshService := ssh.NewService(cfg.SSHServer, sshManager)
+	ftpService := ftp.NewService(cfg.FTPServer, log)
+	defer ftpService.Close()
+
+	backends := []struct {
+		name, target string
+		ping         func() error
+	}{
+		{"ssh", sshService.Target(), sshService.Ping},
+		{"ftp", ftpService.Target(), ftpService.Ping},
+	}
+	code := 0
+	for _, b := range backends {
+		start := time.Now()
+		if err := b.ping(); err != nil {
+			fmt.Printf("%-4s %-22s error: %v\n", b.name, b.target, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%-4s %-22s ok (%s)\n", b.name, b.target, time.Since(start).Round(time.Millisecond))
+	}
+	return code
+}
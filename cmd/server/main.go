@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -13,71 +14,119 @@ import (
 
 	"ssh-ftp-proxy/internal/config"
 	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/redact"
 	"ssh-ftp-proxy/internal/server"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"go.uber.org/zap"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "secret":
+			os.Exit(runSecret(os.Args[2:]))
+		case "check-config":
+			os.Exit(runCheckConfig(os.Args[2:]))
+		}
+	}
+
 	configPath := flag.String("config", "config/config.yaml", "Path to config file")
 	flag.Parse()
 
 	// 1. Load Config
 	absPath, _ := filepath.Abs(*configPath)
-	if err := config.LoadConfig(absPath); err != nil {
+	cfg, err := config.Load(absPath)
+	if err != nil {
 		fmt.Printf("Failed to load config from %s: %v\n", absPath, err)
 		os.Exit(1)
 	}
 
 	// 2. Init Logger
-	if err := logger.InitLogger(config.GlobalConfig.Log.Level, config.GlobalConfig.Log.File); err != nil {
+	log, level, err := logger.New(cfg.Log)
+	if err != nil {
 		fmt.Printf("Failed to init logger: %v\n", err)
 		os.Exit(1)
 	}
-	defer logger.Sync()
+	defer log.Sync()
+	// Patterns were validated with the config
+	redactor, _ := redact.New(cfg.Redact.Patterns)
+	log = redactor.Logger(log)
 
-	logger.Log.Info("Starting AI SSH/FTP Proxy Service")
+	log.Info("Starting AI SSH/FTP Proxy Service")
+	if _, err := os.Stat(absPath); errors.Is(err, os.ErrNotExist) {
+		log.Infow("Config file not found, using defaults + env vars", "path", absPath)
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// SSH connections are pooled per target and shared by both servers
+	sshManager := ssh.NewManager(log)
+	defer sshManager.Close()
+	opts := server.Options{Config: cfg, Logger: log, Redactor: redactor, SSHManager: sshManager}
+
 	// 3. Start WS Server (Async)
-	wsSrv := server.NewWSServer()
-	go func() {
-		if err := wsSrv.Run(); err != nil && err != http.ErrServerClosed {
-			logger.Log.Error("WS Server failed", "error", err)
-		}
-	}()
+	wsSrv := server.NewWSServer(opts)
+	wsHTTP := serve(log, "WebSocket Server", wsSrv.Addr(), wsSrv.Handler())
 
 	// 4. Start HTTP Server (Async)
-	httpSrv := server.NewServer()
+	httpSrv := server.NewServer(opts)
+	httpHTTP := serve(log, "HTTP Server", httpSrv.Addr(), httpSrv.Handler())
+
+	// 5. Reload the config when the file changes or on SIGHUP
+	reload := &reloader{path: absPath, log: log, level: level, httpSrv: httpSrv, wsSrv: wsSrv, current: *cfg}
+	if err := config.Watch(absPath, func() { reload.reload("file") }, ctx.Done()); err != nil {
+		log.Warnw("Config file watch disabled, reload with SIGHUP", "error", err)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		if err := httpSrv.Run(); err != nil && err != http.ErrServerClosed {
-			logger.Log.Error("HTTP Server failed", "error", err)
+		for range hup {
+			reload.reload("SIGHUP")
 		}
 	}()
 
-	// 5. Graceful Shutdown
+	// 6. Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	select {
 	case sig := <-quit:
-		logger.Log.Info("Received signal, shutting down...", "signal", sig)
+		log.Infow("Received signal, shutting down...", "signal", sig)
 	case <-ctx.Done():
-		logger.Log.Info("Context cancelled, shutting down...")
+		log.Info("Context cancelled, shutting down...")
 	}
 
 	// Give 10 seconds for graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
-	// Shutdown servers
-	logger.Log.Info("Stopping servers...")
+	// Stop accepting requests and wait for the ones in flight. WebSocket
+	// shells are hijacked connections Shutdown does not wait for; they end
+	// when the SSH connections close.
+	log.Info("Stopping servers...")
+	for name, srv := range map[string]*http.Server{"HTTP Server": httpHTTP, "WebSocket Server": wsHTTP} {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Warnw("Graceful shutdown incomplete", "server", name, "error", err)
+		}
+	}
+	httpSrv.Close()
+	wsSrv.Close()
 
-	// Note: gin.Engine doesn't expose the underlying http.Server by default
-	// For full graceful shutdown, we would need to modify the server package
-	// For now, we just log and exit gracefully
-	_ = shutdownCtx
+	log.Info("AI SSH/FTP Proxy Service stopped")
+}
 
-	logger.Log.Info("AI SSH/FTP Proxy Service stopped")
+// serve runs handler on addr in the background until the returned server is
+// shut down
+func serve(log *zap.SugaredLogger, name, addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		log.Infow("Starting "+name, "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorw(name+" failed", "error", err)
+		}
+	}()
+	return srv
 }
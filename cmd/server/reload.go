@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/server"
+
+	"go.uber.org/zap"
+)
+
+// reloader applies changes of the config file to the running servers
+type reloader struct {
+	path    string
+	log     *zap.SugaredLogger
+	level   zap.AtomicLevel
+	httpSrv *server.Server
+	wsSrv   *server.WSServer
+
+	mu      sync.Mutex // One reload at a time
+	current config.Config
+}
+
+// reload reads and validates the config file and applies it. An invalid
+// config is rejected as a whole and the running one stays in effect.
+func (r *reloader) reload(trigger string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := os.Stat(r.path); err != nil {
+		// Mid-replace, or removed: nothing to apply
+		r.log.Warnw("Config reload skipped", "trigger", trigger, "error", err)
+		return
+	}
+	cfg, err := config.Read(r.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		r.log.Errorw("Config reload rejected, keeping the running config", "trigger", trigger, "error", err)
+		return
+	}
+
+	// The listeners are already bound
+	if cfg.Server != r.current.Server {
+		r.log.Warnw("Listen address changes take effect after a restart",
+			"running", listenAddrs(r.current.Server), "configured", listenAddrs(cfg.Server))
+		cfg.Server = r.current.Server
+	}
+	// The log file stays open; only the level follows
+	configured, running := cfg.Log, r.current.Log
+	configured.Level, running.Level = "", ""
+	if configured != running {
+		r.log.Warnw("Log file and rotation changes take effect after a restart", "running", running, "configured", configured)
+		level := cfg.Log.Level
+		cfg.Log = r.current.Log
+		cfg.Log.Level = level
+	}
+
+	if err := r.level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		r.log.Warnw("Invalid log level, keeping the current one", "level", cfg.Log.Level, "error", err)
+	}
+	r.httpSrv.Reload(cfg)
+	r.wsSrv.Reload(cfg)
+	r.current = *cfg
+	r.log.Infow("Config reloaded", "trigger", trigger, "path", r.path)
+}
+
+func listenAddrs(s config.ServerConfig) string {
+	return fmt.Sprintf("http %s:%d, ws %s:%d", s.BindIP, s.HTTPPort, s.BindIP, s.WSPort)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"golang.org/x/term"
+)
+
+const secretUsage = `Usage: ssh-ftp-proxy secret encrypt
+
+Reads a secret from stdin (prompting without echo on a terminal) and prints
+an enc: value for config.yaml, encrypted with the key in ` + config.MasterKeyEnv + `.
+The server needs the same ` + config.MasterKeyEnv + ` to decrypt it.
+
+Example:
+  export ` + config.MasterKeyEnv + `="$(openssl rand -base64 32)"
+  ssh-ftp-proxy secret encrypt < password.txt
+`
+
+// runSecret implements the secret subcommand and returns the exit code
+func runSecret(args []string) int {
+	if len(args) != 1 || args[0] != "encrypt" {
+		fmt.Fprint(os.Stderr, secretUsage)
+		return 2
+	}
+
+	var plaintext string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Secret: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read secret: %v\n", err)
+			return 1
+		}
+		plaintext = string(b)
+	} else {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read secret: %v\n", err)
+			return 1
+		}
+		plaintext = strings.TrimRight(string(b), "\r\n")
+	}
+	if plaintext == "" {
+		fmt.Fprintln(os.Stderr, "Empty secret")
+		return 1
+	}
+
+	value, err := config.EncryptSecret(plaintext)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encrypt: %v\n", err)
+		return 1
+	}
+	fmt.Println(value)
+	return 0
+}
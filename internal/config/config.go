@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,6 +17,8 @@ type Config struct {
 	SSHServer SSHConfig    `mapstructure:"ssh_server"`
 	FTPServer FTPConfig    `mapstructure:"ftp_server"`
 	Log       LogConfig    `mapstructure:"log"`
+	Health    HealthConfig `mapstructure:"health"`
+	Redact    RedactConfig `mapstructure:"redact"`
 }
 
 type ServerConfig struct {
@@ -23,95 +28,233 @@ type ServerConfig struct {
 }
 
 type SSHConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
-	KeyFile  string `mapstructure:"key_file"`
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"`
+	SSHAuth `mapstructure:",squash"`
+	Pool    SSHPoolConfig `mapstructure:"pool"`
+
+	// host:port reached from the target by /api/ssh/tunnel/http/* (empty = disabled)
+	HTTPTunnel string `mapstructure:"http_tunnel"`
+
+	// Bastions to tunnel through, outermost first (like ssh -J a,b)
+	JumpHosts []SSHJumpHost `mapstructure:"jump_hosts"`
+
+	// Forward the local SSH_AUTH_SOCK agent to sessions on the target (like ssh -A)
+	ForwardAgent bool `mapstructure:"forward_agent"`
+}
+
+// SSHAuth holds the credentials for one SSH hop. Every configured method is
+// offered: public keys (certificate, key file, agent), then password, then
+// keyboard-interactive answered with the password.
+type SSHAuth struct {
+	User          string `mapstructure:"user"`
+	Password      string `mapstructure:"password"`
+	KeyFile       string `mapstructure:"key_file"`
+	KeyPassphrase string `mapstructure:"key_passphrase"` // For encrypted key files
+	CertFile      string `mapstructure:"cert_file"`      // OpenSSH user certificate (default KeyFile-cert.pub when present)
+	UseAgent      bool   `mapstructure:"use_agent"`      // Offer the keys of the SSH_AUTH_SOCK agent
+}
+
+// SSHJumpHost is a bastion on the way to the target, with its own credentials
+type SSHJumpHost struct {
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"` // Default 22
+	SSHAuth `mapstructure:",squash"`
+}
+
+// SSHPoolConfig sizes the connections kept to the SSH server, shared by the
+// HTTP and WebSocket servers
+type SSHPoolConfig struct {
+	MaxConns          int           `mapstructure:"max_conns"`          // Upper bound on connections to the server
+	MaxSessions       int           `mapstructure:"max_sessions"`       // Concurrent sessions per connection; lowered when sshd MaxSessions is smaller
+	KeepaliveInterval time.Duration `mapstructure:"keepalive_interval"` // Background keepalive period (0 = off)
+	WaitTimeout       time.Duration `mapstructure:"wait_timeout"`       // How long a request waits for a free session (0 = forever)
+	BackoffMin        time.Duration `mapstructure:"backoff_min"`        // Delay before retrying a failed dial, doubled per failure
+	BackoffMax        time.Duration `mapstructure:"backoff_max"`        // Upper bound on the retry delay
 }
 
 type FTPConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
+	Host     string        `mapstructure:"host"`
+	Port     int           `mapstructure:"port"`
+	User     string        `mapstructure:"user"`
+	Password string        `mapstructure:"password"`
+	Pool     FTPPoolConfig `mapstructure:"pool"`
+
+	// FTPS
+	TLSMode            string `mapstructure:"tls_mode"`             // none, explicit (AUTH TLS) or implicit
+	CAFile             string `mapstructure:"ca_file"`              // PEM bundle to verify the server (default: system roots)
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Do not verify the server certificate
+	CertFile           string `mapstructure:"cert_file"`            // Client certificate (PEM)
+	KeyFile            string `mapstructure:"key_file"`             // Client private key (PEM)
+
+	// Connection behaviour
+	Active         bool          `mapstructure:"active"`          // Active mode: the server connects back for data (PORT/EPRT)
+	ActiveAddr     string        `mapstructure:"active_addr"`     // Address announced in active mode (default: local address of the control connection)
+	DisableEPSV    bool          `mapstructure:"disable_epsv"`    // Use PASV only, for servers or NATs that mishandle EPSV
+	Encoding       string        `mapstructure:"encoding"`        // Filename encoding on the server, e.g. gbk (default utf-8)
+	DialTimeout    time.Duration `mapstructure:"dial_timeout"`    // Connect, TLS handshake and greeting
+	CommandTimeout time.Duration `mapstructure:"command_timeout"` // Wait for the reply to a command
+	DataTimeout    time.Duration `mapstructure:"data_timeout"`    // Abort a transfer that moves no data for this long (0 = never)
+}
+
+// FTPPoolConfig bounds the pool of logged-in FTP connections
+type FTPPoolConfig struct {
+	MaxConns    int           `mapstructure:"max_conns"`    // Upper bound on open connections
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // Close connections idle for longer (0 = never)
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"` // Close connections older than this (0 = never)
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"` // How long a request waits for a free connection (0 = forever)
+}
+
+// HealthConfig controls the readiness probes behind /api/health/ready
+type HealthConfig struct {
+	CacheTTL  time.Duration `mapstructure:"cache_ttl"`  // How long a probe result is reused
+	Timeout   time.Duration `mapstructure:"timeout"`    // Per-component probe timeout
+	FileRoots []string      `mapstructure:"file_roots"` // Directories that must be writable (default: temp dir)
+}
+
+// RedactConfig adds patterns to the built-in secret detectors applied to
+// logs and task listings
+type RedactConfig struct {
+	Patterns []string `mapstructure:"patterns"` // Regexes; a (?P<secret>...) group masks only that part
 }
 
 type LogConfig struct {
-	Level string `mapstructure:"level"`
-	File  string `mapstructure:"file"`
+	Level      string `mapstructure:"level"`
+	File       string `mapstructure:"file"`
+	MaxSize    int    `mapstructure:"max_size"`     // Rotate the file at this many megabytes
+	MaxAgeDays int    `mapstructure:"max_age_days"` // Delete rotated files older than this (0 = keep)
+	MaxBackups int    `mapstructure:"max_backups"`  // Rotated files kept at most (0 = all)
+	Compress   bool   `mapstructure:"compress"`     // Gzip rotated files
+}
+
+// Load reads and validates the config at path
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-var GlobalConfig Config
+// Read loads the config at path over the defaults and environment variables.
+// A missing file leaves the defaults.
+func Read(path string) (*Config, error) {
+	v := viper.New()
 
-func LoadConfig(path string) error {
 	// Set defaults
-	viper.SetDefault("server.http_port", 48891)
-	viper.SetDefault("server.ws_port", 48892)
-	viper.SetDefault("server.bind_ip", "0.0.0.0")
-	viper.SetDefault("ssh_server.host", "127.0.0.1")
-	viper.SetDefault("ssh_server.port", 22)
-	viper.SetDefault("ssh_server.user", "root")
-	viper.SetDefault("ssh_server.password", "")
-	viper.SetDefault("ssh_server.key_file", "")
-	viper.SetDefault("ftp_server.host", "127.0.0.1")
-	viper.SetDefault("ftp_server.port", 21)
-	viper.SetDefault("ftp_server.user", "root")
-	viper.SetDefault("ftp_server.password", "")
-	viper.SetDefault("log.level", "info")
-	viper.SetDefault("log.file", "logs/server.log")
+	v.SetDefault("server.http_port", 48891)
+	v.SetDefault("server.ws_port", 48892)
+	v.SetDefault("server.bind_ip", "0.0.0.0")
+	v.SetDefault("ssh_server.host", "127.0.0.1")
+	v.SetDefault("ssh_server.port", 22)
+	v.SetDefault("ssh_server.user", "root")
+	v.SetDefault("ssh_server.password", "")
+	v.SetDefault("ssh_server.key_file", "")
+	v.SetDefault("ssh_server.key_passphrase", "")
+	v.SetDefault("ssh_server.cert_file", "")
+	v.SetDefault("ssh_server.use_agent", false)
+	v.SetDefault("ssh_server.forward_agent", false)
+	v.SetDefault("ssh_server.http_tunnel", "")
+	v.SetDefault("ssh_server.pool.max_conns", 2)
+	v.SetDefault("ssh_server.pool.max_sessions", 10)
+	v.SetDefault("ssh_server.pool.keepalive_interval", "30s")
+	v.SetDefault("ssh_server.pool.wait_timeout", "30s")
+	v.SetDefault("ssh_server.pool.backoff_min", "1s")
+	v.SetDefault("ssh_server.pool.backoff_max", "1m")
+	v.SetDefault("ftp_server.host", "127.0.0.1")
+	v.SetDefault("ftp_server.port", 21)
+	v.SetDefault("ftp_server.user", "root")
+	v.SetDefault("ftp_server.password", "")
+	v.SetDefault("ftp_server.tls_mode", "none")
+	v.SetDefault("ftp_server.dial_timeout", "5s")
+	v.SetDefault("ftp_server.command_timeout", "30s")
+	v.SetDefault("ftp_server.data_timeout", "60s")
+	v.SetDefault("ftp_server.pool.max_conns", 4)
+	v.SetDefault("ftp_server.pool.idle_timeout", "60s")
+	v.SetDefault("ftp_server.pool.max_lifetime", "30m")
+	v.SetDefault("ftp_server.pool.wait_timeout", "30s")
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.file", "logs/server.log")
+	v.SetDefault("log.max_size", 100)
+	v.SetDefault("log.max_age_days", 30)
+	v.SetDefault("log.max_backups", 10)
+	v.SetDefault("log.compress", true)
+	v.SetDefault("health.cache_ttl", "10s")
+	v.SetDefault("health.timeout", "5s")
 
 	// Viper env binding: APP_SERVER_HTTP_PORT -> server.http_port
-	viper.SetEnvPrefix("APP")
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.AutomaticEnv()
+	v.SetEnvPrefix("APP")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
 
 	// Try to load config file (optional - not fatal if missing)
-	viper.SetConfigFile(path)
-	viper.SetConfigType("yaml")
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("Config file not found (%s), using defaults + env vars\n", path)
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		if _, statErr := os.Stat(path); statErr == nil {
+			// Present but unreadable or invalid: never fall back to defaults for it
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
 	}
 
 	// Apply SFTP_ prefixed env vars (more intuitive for AI)
-	applyEnvOverrides()
+	applyEnvOverrides(v)
+
+	if unknown := unknownKeys(v.AllSettings(), reflect.TypeOf(Config{}), ""); len(unknown) > 0 {
+		errs := make([]error, len(unknown))
+		for i, msg := range unknown {
+			errs[i] = errors.New(msg)
+		}
+		return nil, errors.Join(errs...)
+	}
 
-	if err := viper.Unmarshal(&GlobalConfig); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
 	// FTP defaults to SSH values if not explicitly set
-	if GlobalConfig.FTPServer.Host == "127.0.0.1" && os.Getenv("SFTP_FTP_HOST") == "" && os.Getenv("APP_FTP_SERVER_HOST") == "" {
-		GlobalConfig.FTPServer.Host = GlobalConfig.SSHServer.Host
+	if cfg.FTPServer.Host == "127.0.0.1" && os.Getenv("SFTP_FTP_HOST") == "" && os.Getenv("APP_FTP_SERVER_HOST") == "" {
+		cfg.FTPServer.Host = cfg.SSHServer.Host
+	}
+	if cfg.FTPServer.User == "root" && os.Getenv("SFTP_FTP_USER") == "" && os.Getenv("APP_FTP_SERVER_USER") == "" {
+		cfg.FTPServer.User = cfg.SSHServer.User
 	}
-	if GlobalConfig.FTPServer.User == "root" && os.Getenv("SFTP_FTP_USER") == "" && os.Getenv("APP_FTP_SERVER_USER") == "" {
-		GlobalConfig.FTPServer.User = GlobalConfig.SSHServer.User
+	if cfg.FTPServer.Password == "" && os.Getenv("SFTP_FTP_PASS") == "" && os.Getenv("APP_FTP_SERVER_PASSWORD") == "" {
+		cfg.FTPServer.Password = cfg.SSHServer.Password
 	}
-	if GlobalConfig.FTPServer.Password == "" && os.Getenv("SFTP_FTP_PASS") == "" && os.Getenv("APP_FTP_SERVER_PASSWORD") == "" {
-		GlobalConfig.FTPServer.Password = GlobalConfig.SSHServer.Password
+
+	// Passwords may be env:, file: or enc: references
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &cfg, nil
 }
 
 // applyEnvOverrides reads SFTP_* environment variables for simple AI usage
 // Example: SFTP_SSH_HOST=127.0.0.1 SFTP_SSH_PORT=22 SFTP_SSH_USER=root SFTP_SSH_PASS=xxx ./ssh-ftp-proxy
-func applyEnvOverrides() {
+func applyEnvOverrides(v *viper.Viper) {
 	envMap := map[string]string{
-		"SFTP_HTTP_PORT": "server.http_port",
-		"SFTP_WS_PORT":   "server.ws_port",
-		"SFTP_BIND_IP":   "server.bind_ip",
-		"SFTP_SSH_HOST":  "ssh_server.host",
-		"SFTP_SSH_PORT":  "ssh_server.port",
-		"SFTP_SSH_USER":  "ssh_server.user",
-		"SFTP_SSH_PASS":  "ssh_server.password",
-		"SFTP_SSH_KEY":   "ssh_server.key_file",
-		"SFTP_FTP_HOST":  "ftp_server.host",
-		"SFTP_FTP_PORT":  "ftp_server.port",
-		"SFTP_FTP_USER":  "ftp_server.user",
-		"SFTP_FTP_PASS":  "ftp_server.password",
-		"SFTP_LOG_LEVEL": "log.level",
-		"SFTP_LOG_FILE":  "log.file",
+		"SFTP_HTTP_PORT":    "server.http_port",
+		"SFTP_WS_PORT":      "server.ws_port",
+		"SFTP_BIND_IP":      "server.bind_ip",
+		"SFTP_SSH_HOST":     "ssh_server.host",
+		"SFTP_SSH_PORT":     "ssh_server.port",
+		"SFTP_SSH_USER":     "ssh_server.user",
+		"SFTP_SSH_PASS":     "ssh_server.password",
+		"SFTP_SSH_KEY":      "ssh_server.key_file",
+		"SFTP_SSH_KEY_PASS": "ssh_server.key_passphrase",
+		"SFTP_FTP_HOST":     "ftp_server.host",
+		"SFTP_FTP_PORT":     "ftp_server.port",
+		"SFTP_FTP_USER":     "ftp_server.user",
+		"SFTP_FTP_PASS":     "ftp_server.password",
+		"SFTP_FTP_TLS":      "ftp_server.tls_mode",
+		"SFTP_LOG_LEVEL":    "log.level",
+		"SFTP_LOG_FILE":     "log.file",
 	}
 
 	for envKey, viperKey := range envMap {
@@ -119,11 +262,11 @@ func applyEnvOverrides() {
 			// Try int conversion for port fields
 			if strings.HasSuffix(viperKey, "_port") || viperKey == "ssh_server.port" {
 				if intVal, err := strconv.Atoi(val); err == nil {
-					viper.Set(viperKey, intVal)
+					v.Set(viperKey, intVal)
 					continue
 				}
 			}
-			viper.Set(viperKey, val)
+			v.Set(viperKey, val)
 		}
 	}
 }
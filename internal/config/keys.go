@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// unknownKeys reports every key in settings that no field of t reads, as
+// dotted paths, so typos such as ssh_sever do not silently fall back to
+// defaults
+func unknownKeys(settings map[string]any, t reflect.Type, prefix string) []string {
+	fields := keyFields(t)
+	var unknown []string
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		path := prefix + key
+		field, ok := fields[key]
+		if !ok {
+			msg := "unknown key " + path
+			if guess := closestKey(key, slices.Collect(maps.Keys(fields))); guess != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", prefix+guess)
+			}
+			unknown = append(unknown, msg)
+			continue
+		}
+		switch value := settings[key].(type) {
+		case map[string]any:
+			if field.Kind() == reflect.Struct {
+				unknown = append(unknown, unknownKeys(value, field, path+".")...)
+			}
+		case []any:
+			if field.Kind() == reflect.Slice && field.Elem().Kind() == reflect.Struct {
+				for i, item := range value {
+					if m, ok := item.(map[string]any); ok {
+						unknown = append(unknown, unknownKeys(m, field.Elem(), fmt.Sprintf("%s[%d].", path, i))...)
+					}
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// keyFields maps the mapstructure keys of t to field types, following
+// squashed embedded structs
+func keyFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			maps.Copy(fields, keyFields(f.Type))
+			continue
+		}
+		if name != "" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
+
+// closestKey returns the candidate within two edits of key, if any
+func closestKey(key string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range slices.Sorted(slices.Values(candidates)) {
+		if d := editDistance(key, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	settings := map[string]any{
+		"server":    map[string]any{"http_port": 1, "htp_port": 2},
+		"ssh_sever": map[string]any{"host": "x"},
+		"ssh_server": map[string]any{
+			"password":   "x",
+			"pool":       map[string]any{"max_con": 1},
+			"jump_hosts": []any{map[string]any{"host": "a", "user": "b", "key_fle": "c"}},
+		},
+		"health": map[string]any{"file_roots": []any{"/tmp"}},
+		"zzz":    1,
+	}
+	want := []string{
+		"unknown key server.htp_port (did you mean server.http_port?)",
+		"unknown key ssh_server.jump_hosts[0].key_fle (did you mean ssh_server.jump_hosts[0].key_file?)",
+		"unknown key ssh_server.pool.max_con (did you mean ssh_server.pool.max_conns?)",
+		"unknown key ssh_sever (did you mean ssh_server?)",
+		"unknown key zzz",
+	}
+
+	got := unknownKeys(settings, reflect.TypeOf(Config{}), "")
+	if !slices.Equal(got, want) {
+		t.Errorf("unknownKeys:\n got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MasterKeyEnv holds the key enc: secrets are encrypted with. Any string
+// works; it is hashed to an AES-256 key, so use a long random one
+// (e.g. openssl rand -base64 32).
+const MasterKeyEnv = "SFTP_MASTER_KEY"
+
+// Secret reference prefixes. Values without one are used as they are.
+const (
+	secretEnv  = "env:"  // env:NAME, read from an environment variable
+	secretFile = "file:" // file:/path, read from a file, trailing newline dropped
+	secretEnc  = "enc:"  // enc:BASE64, AES-256-GCM under the master key
+)
+
+// secretFields lists the config values that may hold a secret reference
+func secretFields(cfg *Config) map[string]*string {
+	fields := map[string]*string{
+		"ssh_server.password":       &cfg.SSHServer.Password,
+		"ssh_server.key_passphrase": &cfg.SSHServer.KeyPassphrase,
+		"ftp_server.password":       &cfg.FTPServer.Password,
+	}
+	for i := range cfg.SSHServer.JumpHosts {
+		j := &cfg.SSHServer.JumpHosts[i]
+		prefix := "ssh_server.jump_hosts[" + strconv.Itoa(i) + "]."
+		fields[prefix+"password"] = &j.Password
+		fields[prefix+"key_passphrase"] = &j.KeyPassphrase
+	}
+	return fields
+}
+
+// resolveSecrets replaces every secret reference in cfg with its value
+func resolveSecrets(cfg *Config) error {
+	fields := secretFields(cfg)
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		field := fields[name]
+		value, err := ResolveSecret(*field)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*field = value
+	}
+	return nil
+}
+
+// ResolveSecret returns the value ref refers to, or ref itself when it is
+// not a reference
+func ResolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretEnv):
+		name := strings.TrimPrefix(ref, secretEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, secretFile):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, secretFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, secretEnc):
+		key, err := masterKey()
+		if err != nil {
+			return "", err
+		}
+		return decryptSecret(strings.TrimPrefix(ref, secretEnc), key)
+	}
+	return ref, nil
+}
+
+// EncryptSecret returns an enc: reference to plaintext under the master key
+func EncryptSecret(plaintext string) (string, error) {
+	key, err := masterKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretEnc + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encoded string, key []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted secret: too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt secret: wrong %s?", MasterKeyEnv)
+	}
+	return string(plaintext), nil
+}
+
+func masterKey() ([]byte, error) {
+	value := os.Getenv(MasterKeyEnv)
+	if value == "" {
+		return nil, fmt.Errorf("%s is not set", MasterKeyEnv)
+	}
+	key := sha256.Sum256([]byte(value))
+	return key[:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretPath, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv(MasterKeyEnv, "master")
+	enc, err := EncryptSecret("from-enc")
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{name: "plain", ref: "hunter2", want: "hunter2"},
+		{name: "empty", ref: "", want: ""},
+		{name: "env", ref: "env:TEST_SECRET", want: "from-env"},
+		{name: "missing env", ref: "env:TEST_SECRET_MISSING", wantErr: "environment variable TEST_SECRET_MISSING is not set"},
+		{name: "file", ref: "file:" + secretPath, want: "from-file"},
+		{name: "missing file", ref: "file:" + filepath.Join(dir, "missing"), wantErr: "no such file"},
+		{name: "enc", ref: enc, want: "from-enc"},
+		{name: "bad base64", ref: "enc:!!!", wantErr: "invalid encrypted secret"},
+		{name: "too short", ref: "enc:AAAA", wantErr: "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSecret(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveSecret(%q) error = %v, want %q", tt.ref, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSecret(%q): %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveSecret(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretMasterKey(t *testing.T) {
+	t.Setenv(MasterKeyEnv, "master")
+	enc, err := EncryptSecret("s3cret")
+	if err != nil {
+		t.Fatalf("EncryptSecret: %v", err)
+	}
+	if !strings.HasPrefix(enc, secretEnc) {
+		t.Fatalf("EncryptSecret = %q, want an %s reference", enc, secretEnc)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr string
+	}{
+		{name: "same key", key: "master", want: "s3cret"},
+		{name: "wrong key", key: "other", wantErr: "wrong " + MasterKeyEnv},
+		{name: "unset key", key: "", wantErr: MasterKeyEnv + " is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(MasterKeyEnv, tt.key)
+			got, err := ResolveSecret(enc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveSecret error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSecret: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveSecret = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("encrypt without key", func(t *testing.T) {
+		t.Setenv(MasterKeyEnv, "")
+		if _, err := EncryptSecret("x"); err == nil || !strings.Contains(err.Error(), MasterKeyEnv+" is not set") {
+			t.Fatalf("EncryptSecret error = %v, want unset %s", err, MasterKeyEnv)
+		}
+	})
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("TEST_SSH_PASS", "ssh-pass")
+	t.Setenv("TEST_JUMP_PASS", "jump-pass")
+	t.Setenv("TEST_JUMP_PHRASE", "jump-phrase")
+
+	cfg := &Config{}
+	cfg.SSHServer.Password = "env:TEST_SSH_PASS"
+	cfg.SSHServer.KeyPassphrase = "plain-phrase"
+	cfg.FTPServer.Password = "ftp-pass"
+	cfg.SSHServer.JumpHosts = []SSHJumpHost{
+		{SSHAuth: SSHAuth{Password: "plain"}},
+		{SSHAuth: SSHAuth{Password: "env:TEST_JUMP_PASS", KeyPassphrase: "env:TEST_JUMP_PHRASE"}},
+	}
+	if err := resolveSecrets(cfg); err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+	got := map[string]string{
+		"ssh password":      cfg.SSHServer.Password,
+		"ssh passphrase":    cfg.SSHServer.KeyPassphrase,
+		"ftp password":      cfg.FTPServer.Password,
+		"jump 0 password":   cfg.SSHServer.JumpHosts[0].Password,
+		"jump 1 password":   cfg.SSHServer.JumpHosts[1].Password,
+		"jump 1 passphrase": cfg.SSHServer.JumpHosts[1].KeyPassphrase,
+	}
+	want := map[string]string{
+		"ssh password":      "ssh-pass",
+		"ssh passphrase":    "plain-phrase",
+		"ftp password":      "ftp-pass",
+		"jump 0 password":   "plain",
+		"jump 1 password":   "jump-pass",
+		"jump 1 passphrase": "jump-phrase",
+	}
+	for field, w := range want {
+		if got[field] != w {
+			t.Errorf("%s = %q, want %q", field, got[field], w)
+		}
+	}
+
+	// Errors name the field
+	cfg = &Config{}
+	cfg.SSHServer.JumpHosts = []SSHJumpHost{{SSHAuth: SSHAuth{KeyPassphrase: "env:TEST_UNSET_PHRASE"}}}
+	err := resolveSecrets(cfg)
+	if err == nil || !strings.HasPrefix(err.Error(), "ssh_server.jump_hosts[0].key_passphrase: ") {
+		t.Fatalf("resolveSecrets error = %v, want it to name the jump host field", err)
+	}
+}
+
+// The FTP password falls back to the SSH one before references are resolved,
+// so both end up with the resolved value
+func TestReadInheritsResolvedPassword(t *testing.T) {
+	t.Setenv("TEST_SSH_PASS", "ssh-pass")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ssh_server:\n  password: env:TEST_SSH_PASS\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if cfg.SSHServer.Password != "ssh-pass" || cfg.FTPServer.Password != "ssh-pass" {
+		t.Errorf("passwords = %q (ssh), %q (ftp), want both %q",
+			cfg.SSHServer.Password, cfg.FTPServer.Password, "ssh-pass")
+	}
+}
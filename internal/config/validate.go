@@ -0,0 +1,111 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"ssh-ftp-proxy/internal/redact"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Validate reports settings the service cannot run with, all at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(name, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{name}, args...)...))
+	}
+	checkPort := func(name string, port int) {
+		if port < 1 || port > 65535 {
+			fail(name, "port %d out of range 1-65535", port)
+		}
+	}
+	checkFile := func(name, path string) {
+		if path == "" {
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			fail(name, "%v", err)
+			return
+		}
+		f.Close()
+	}
+	checkAuth := func(name string, auth SSHAuth) {
+		if auth.User == "" {
+			fail(name+".user", "required")
+		}
+		if auth.Password == "" && auth.KeyFile == "" && !auth.UseAgent {
+			fail(name, "no auth method: set password, key_file or use_agent")
+		}
+		checkFile(name+".key_file", auth.KeyFile)
+		checkFile(name+".cert_file", auth.CertFile)
+		if auth.CertFile != "" && auth.KeyFile == "" {
+			fail(name+".cert_file", "requires key_file")
+		}
+	}
+
+	checkPort("server.http_port", c.Server.HTTPPort)
+	checkPort("server.ws_port", c.Server.WSPort)
+	if c.Server.BindIP != "" && net.ParseIP(c.Server.BindIP) == nil {
+		fail("server.bind_ip", "invalid IP address %q", c.Server.BindIP)
+	}
+
+	ssh := c.SSHServer
+	if ssh.Host == "" {
+		fail("ssh_server.host", "required")
+	}
+	checkPort("ssh_server.port", ssh.Port)
+	checkAuth("ssh_server", ssh.SSHAuth)
+	if ssh.HTTPTunnel != "" {
+		if _, _, err := net.SplitHostPort(ssh.HTTPTunnel); err != nil {
+			fail("ssh_server.http_tunnel", "%v", err)
+		}
+	}
+	for i, j := range ssh.JumpHosts {
+		name := fmt.Sprintf("ssh_server.jump_hosts[%d]", i)
+		if j.Host == "" {
+			fail(name+".host", "required")
+		}
+		if j.Port != 0 {
+			checkPort(name+".port", j.Port)
+		}
+		checkAuth(name, j.SSHAuth)
+	}
+
+	ftp := c.FTPServer
+	if ftp.Host == "" {
+		fail("ftp_server.host", "required")
+	}
+	checkPort("ftp_server.port", ftp.Port)
+	switch ftp.TLSMode {
+	case "", "none", "explicit", "implicit":
+	default:
+		fail("ftp_server.tls_mode", "unknown mode %q (want none, explicit or implicit)", ftp.TLSMode)
+	}
+	checkFile("ftp_server.ca_file", ftp.CAFile)
+	checkFile("ftp_server.cert_file", ftp.CertFile)
+	checkFile("ftp_server.key_file", ftp.KeyFile)
+	if (ftp.CertFile == "") != (ftp.KeyFile == "") {
+		fail("ftp_server", "cert_file and key_file go together")
+	}
+
+	if _, err := zapcore.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+	if c.Log.MaxSize < 1 {
+		fail("log.max_size", "must be at least 1 (megabytes)")
+	}
+	if c.Log.MaxAgeDays < 0 {
+		fail("log.max_age_days", "must not be negative")
+	}
+	if c.Log.MaxBackups < 0 {
+		fail("log.max_backups", "must not be negative")
+	}
+	if err := redact.Check(c.Redact.Patterns); err != nil {
+		fail("redact.patterns", "%v", err)
+	}
+	return errors.Join(errs...)
+}
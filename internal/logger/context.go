@@ -0,0 +1,23 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying log, so services called with it
+// log with the request's fields (e.g. its request ID)
+func NewContext(ctx context.Context, log *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if it has none
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if log, ok := ctx.Value(contextKey{}).(*zap.SugaredLogger); ok {
+		return log
+	}
+	return fallback
+}
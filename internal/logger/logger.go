@@ -3,47 +3,54 @@ package logger
 import (
 	"os"
 
+	"ssh-ftp-proxy/internal/config"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var Log *zap.SugaredLogger
-
-func InitLogger(level string, filepath string) error {
+// New creates the service logger, writing JSON to cfg.File, rotated by size
+// and pruned by age and count, and text to stdout. The returned level is
+// shared by both outputs, so changing it (e.g. on config reload) applies to
+// them at once.
+func New(cfg config.LogConfig) (*zap.SugaredLogger, zap.AtomicLevel, error) {
 	var zapLevel zapcore.Level
-	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+	if err := zapLevel.UnmarshalText([]byte(cfg.Level)); err != nil {
 		zapLevel = zapcore.InfoLevel
 	}
+	level := zap.NewAtomicLevelAt(zapLevel)
 
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	// Write to both stdout and file
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+	// Write to both stdout and file. Open it now so a bad path fails at
+	// startup rather than on the first write.
+	file := &lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.MaxSize,
+		MaxAge:     cfg.MaxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+		LocalTime:  true,
+	}
+	if _, err := file.Write(nil); err != nil {
+		return nil, level, err
 	}
 
 	core := zapcore.NewTee(
 		zapcore.NewCore(
 			zapcore.NewJSONEncoder(encoderConfig),
 			zapcore.AddSync(file),
-			zapLevel,
+			level,
 		),
 		zapcore.NewCore(
 			zapcore.NewConsoleEncoder(encoderConfig),
 			zapcore.AddSync(os.Stdout),
-			zapLevel,
+			level,
 		),
 	)
 
 	logger := zap.New(core, zap.AddCaller())
-	Log = logger.Sugar()
-	return nil
-}
-
-func Sync() {
-	if Log != nil {
-		Log.Sync()
-	}
+	return logger.Sugar(), level, nil
 }
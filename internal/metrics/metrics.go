@@ -0,0 +1,111 @@
+// Package metrics holds the Prometheus collectors exported on /metrics.
+//
+// The collectors are process-wide: every server in the process, including
+// each embedded proxy.Proxy, counts into the same registry.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ssh_ftp_proxy"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	SSHExecs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_exec_total",
+		Help:      "SSH commands executed by target and exit code (-1 when the command could not run).",
+	}, []string{"target", "exit_code"})
+
+	SSHExecDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ssh_exec_duration_seconds",
+		Help:      "SSH command duration by target.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"target"})
+
+	SSHConnectFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_connect_failures_total",
+		Help:      "Failed SSH connection attempts by target.",
+	}, []string{"target"})
+
+	SSHReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_reconnects_total",
+		Help:      "SSH connections re-established after the previous one was lost, by target.",
+	}, []string{"target"})
+
+	WSSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_sessions_active",
+		Help:      "Interactive WebSocket SSH sessions currently open.",
+	})
+
+	AsyncTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "async_tasks",
+		Help:      "Async tasks by state (running, done, error).",
+	}, []string{"state"})
+
+	FTPBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ftp_bytes_total",
+		Help:      "Bytes transferred over FTP by direction (upload, download).",
+	}, []string{"direction"})
+
+	FileBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "file_bytes_total",
+		Help:      "Bytes transferred through the file API by direction (upload, download).",
+	}, []string{"direction"})
+
+	SFTPBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sftp_bytes_total",
+		Help:      "Bytes transferred over SFTP by direction (upload, download).",
+	}, []string{"direction"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		SSHExecs, SSHExecDuration, SSHConnectFailures, SSHReconnects,
+		WSSessions, AsyncTasks,
+		FTPBytes, FileBytes, SFTPBytes,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveSSHExec records one command execution against target
+func ObserveSSHExec(target string, exitCode int, d time.Duration) {
+	SSHExecs.WithLabelValues(target, strconv.Itoa(exitCode)).Inc()
+	SSHExecDuration.WithLabelValues(target).Observe(d.Seconds())
+}
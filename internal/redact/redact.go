@@ -0,0 +1,176 @@
+// Package redact masks secrets (passwords on command lines, tokens, keys) in
+// text that is logged or returned in task listings. The commands themselves
+// run unmodified.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Mask replaces each secret
+const Mask = "[REDACTED]"
+
+// SecretGroup names the part of a pattern to mask; patterns without it are
+// masked as a whole
+const SecretGroup = "secret"
+
+// builtins detect common secrets. Each masks only the secret, keeping the
+// flag or key name so the redacted text still reads.
+var builtins = []string{
+	// --password=x, --pass x, -password x
+	`(?i)(?:^|\s)--?(?:password|passwd|pass|pwd)(?:=|\s+)(?P<secret>\S+)`,
+	// mysql -pSECRET (no space; -p alone prompts)
+	`(?i)\b(?:mysql|mysqldump|mysqladmin|mariadb)\b[^|;&\n]*?\s-p(?P<secret>[^\s-]\S*)`,
+	// sshpass -p SECRET
+	`\bsshpass\s+-p\s*(?P<secret>\S+)`,
+	// PASSWORD=x, DB_PASS=x, api_token=x, client_secret: x
+	`(?i)\b(?:\w*_)?(?:password|passwd|pass|pwd|secret|token|api_?key)(?:_\w*)?\s*[=:]\s*(?P<secret>[^\s&'"]+)`,
+	// user:password@ in URLs
+	`://[^/\s:@]+:(?P<secret>[^/\s@]+)@`,
+	// Authorization: Bearer x
+	`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`,
+	// AWS access key IDs
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	// PEM private keys, including the markers
+	`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`,
+}
+
+// Redactor masks what the built-in detectors and the configured patterns
+// match. It is safe for concurrent use, including Update.
+type Redactor struct {
+	patterns atomic.Pointer[[]*regexp.Regexp]
+}
+
+// New creates a Redactor with the built-in detectors and patterns
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	if err := r.Update(patterns); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update replaces the configured patterns. On error the current ones stay.
+func (r *Redactor) Update(patterns []string) error {
+	compiled, err := compile(patterns)
+	if err != nil {
+		return err
+	}
+	r.patterns.Store(&compiled)
+	return nil
+}
+
+// Check reports the first of patterns that does not compile
+func Check(patterns []string) error {
+	_, err := compile(patterns)
+	return err
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(builtins)+len(patterns))
+	for _, p := range builtins {
+		compiled = append(compiled, regexp.MustCompile(p))
+	}
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// String returns s with every match masked
+func (r *Redactor) String(s string) string {
+	for _, re := range *r.patterns.Load() {
+		s = mask(re, s)
+	}
+	return s
+}
+
+func mask(re *regexp.Regexp, s string) string {
+	group := re.SubexpIndex(SecretGroup)
+	if group < 0 {
+		return re.ReplaceAllLiteralString(s, Mask)
+	}
+
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		out = append(out, s[last:start]...)
+		out = append(out, Mask...)
+		last = end
+	}
+	return string(append(out, s[last:]...))
+}
+
+// Logger returns log with messages and string, error, Stringer and reflected
+// fields redacted
+func (r *Redactor) Logger(log *zap.SugaredLogger) *zap.SugaredLogger {
+	return log.Desugar().WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &core{Core: c, r: r}
+	})).Sugar()
+}
+
+type core struct {
+	zapcore.Core
+	r *Redactor
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(c.fields(fields)), r: c.r}
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.String(ent.Message)
+	return c.Core.Write(ent, c.fields(fields))
+}
+
+func (c *core) fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = c.r.String(f.String)
+		case zapcore.ByteStringType:
+			f = zap.String(f.Key, c.r.String(string(f.Interface.([]byte))))
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zap.String(f.Key, c.r.String(err.Error()))
+			}
+		case zapcore.StringerType:
+			f = zap.String(f.Key, c.r.String(fmt.Sprint(f.Interface)))
+		case zapcore.ReflectType:
+			// Formatted as the JSON encoder would, so it reads the same redacted
+			if data, err := json.Marshal(f.Interface); err == nil {
+				f = zap.String(f.Key, c.r.String(string(data)))
+			} else {
+				f = zap.String(f.Key, c.r.String(fmt.Sprintf("%+v", f.Interface)))
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
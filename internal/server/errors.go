@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"ssh-ftp-proxy/internal/encoder"
+	"ssh-ftp-proxy/internal/service/file"
+	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/sftp"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gin-gonic/gin"
+	pkgsftp "github.com/pkg/sftp"
+)
+
+// ErrorCode is a stable, machine-readable error identifier used by /api/v2
+type ErrorCode string
+
+const (
+	CodeInvalidRequest     ErrorCode = "invalid_request"
+	CodeAuthFailed         ErrorCode = "auth_failed"
+	CodeSSHConnectFailed   ErrorCode = "ssh_connect_failed"
+	CodeFTPConnectFailed   ErrorCode = "ftp_connect_failed"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeAlreadyExists      ErrorCode = "already_exists"
+	CodePermissionDenied   ErrorCode = "permission_denied"
+	CodePathOutsideSandbox ErrorCode = "path_outside_sandbox"
+	CodeTimeout            ErrorCode = "timeout"
+	CodeUnsupported        ErrorCode = "unsupported"
+	CodeUpstreamError      ErrorCode = "upstream_error"
+	CodeInternal           ErrorCode = "internal_error"
+)
+
+// codeStatus maps every error code to the HTTP status used on /api/v2
+var codeStatus = map[ErrorCode]int{
+	CodeInvalidRequest:     http.StatusBadRequest,
+	CodeAuthFailed:         http.StatusBadGateway,
+	CodeSSHConnectFailed:   http.StatusBadGateway,
+	CodeFTPConnectFailed:   http.StatusBadGateway,
+	CodeNotFound:           http.StatusNotFound,
+	CodeAlreadyExists:      http.StatusConflict,
+	CodePermissionDenied:   http.StatusForbidden,
+	CodePathOutsideSandbox: http.StatusForbidden,
+	CodeTimeout:            http.StatusGatewayTimeout,
+	CodeUnsupported:        http.StatusBadRequest,
+	CodeUpstreamError:      http.StatusBadGateway,
+	CodeInternal:           http.StatusInternalServerError,
+}
+
+// APIError is the single error type returned by /api/v2
+type APIError struct {
+	Code    ErrorCode `json:"code" enum:"invalid_request,auth_failed,ssh_connect_failed,ftp_connect_failed,not_found,already_exists,permission_denied,path_outside_sandbox,timeout,unsupported,upstream_error,internal_error"`
+	Message string    `json:"message"`
+	Details any       `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// Status returns the HTTP status for the error code
+func (e *APIError) Status() int {
+	if status, ok := codeStatus[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorEnvelope wraps APIError in every /api/v2 error response
+type ErrorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+func newAPIError(code ErrorCode, format string, args ...any) *APIError {
+	return &APIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidRequest(format string, args ...any) *APIError {
+	return newAPIError(CodeInvalidRequest, format, args...)
+}
+
+// toAPIError classifies a service error into an APIError, keeping its message
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &APIError{Code: classifyError(err), Message: err.Error()}
+}
+
+func classifyError(err error) ErrorCode {
+	switch {
+	case errors.Is(err, ssh.ErrAuth), errors.Is(err, ftp.ErrAuth):
+		return CodeAuthFailed
+	case errors.Is(err, ssh.ErrTunnel):
+		return CodeUpstreamError
+	case errors.Is(err, ssh.ErrConnect):
+		return CodeSSHConnectFailed
+	case errors.Is(err, ftp.ErrConnect):
+		return CodeFTPConnectFailed
+	case errors.Is(err, file.ErrUnsafePath), errors.Is(err, ftp.ErrUnsafePath):
+		return CodePathOutsideSandbox
+	case errors.Is(err, file.ErrUnsupportedArchive), errors.Is(err, ftp.ErrUnsupportedArchive),
+		errors.Is(err, sftp.ErrSubsystem):
+		return CodeUnsupported
+	case errors.Is(err, ftp.ErrTransferNotFound), errors.Is(err, ftp.ErrSyncNotFound),
+		errors.Is(err, ssh.ErrForwardNotFound):
+		return CodeNotFound
+	case errors.Is(err, ftp.ErrTransferConflict), errors.Is(err, ssh.ErrInvalidForward):
+		return CodeInvalidRequest
+	case errors.Is(err, fs.ErrNotExist):
+		return CodeNotFound
+	case errors.Is(err, fs.ErrExist):
+		return CodeAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return CodePermissionDenied
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ssh.ErrSessionTimeout):
+		return CodeTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CodeTimeout
+	}
+
+	// FTP replies
+	var ftpErr *textproto.Error
+	if errors.As(err, &ftpErr) {
+		switch ftpErr.Code {
+		case 550, 450:
+			// "File unavailable" covers missing files and refused access alike
+			return classifyUnavailable(ftpErr.Msg)
+		case 530, 532:
+			return CodeAuthFailed
+		case 553:
+			return CodePermissionDenied
+		case 502, 504:
+			return CodeUnsupported
+		}
+		return CodeUpstreamError
+	}
+
+	// SFTP status codes that the client did not already map to fs errors
+	var sftpErr *pkgsftp.StatusError
+	if errors.As(err, &sftpErr) {
+		if sftpErr.FxCode() == pkgsftp.ErrSSHFxOpUnsupported {
+			return CodeUnsupported
+		}
+		return CodeUpstreamError
+	}
+	return CodeInternal
+}
+
+// classifyUnavailable tells a missing file from other 450/550 replies by the
+// reply text, which is all servers give to go on
+func classifyUnavailable(msg string) ErrorCode {
+	msg = strings.ToLower(msg)
+	switch {
+	case containsAny(msg, "no such file", "not found", "does not exist", "doesn't exist", "cannot find", "can't find"):
+		return CodeNotFound
+	case containsAny(msg, "permission denied", "access denied", "access is denied", "not permitted", "forbidden"):
+		return CodePermissionDenied
+	}
+	return CodeUpstreamError
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiV2Key marks requests routed through the /api/v2 group
+const apiV2Key = "api_v2"
+
+func apiV2Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiV2Key, true)
+		c.Next()
+	}
+}
+
+func isV2(c *gin.Context) bool {
+	return c.GetBool(apiV2Key)
+}
+
+// legacyError writes an error in the pre-v2 shape used by one family of /api handlers
+type legacyError func(c *gin.Context, status int, msg string)
+
+var (
+	// legacyPlain: {"error": "message"}, used by file and task endpoints
+	legacyPlain legacyError = func(c *gin.Context, status int, msg string) {
+		c.JSON(status, ErrorResponse{Error: msg})
+	}
+	// legacySSH: SSHExecResponse with a Base64 error and exit code 1
+	legacySSH legacyError = func(c *gin.Context, status int, msg string) {
+		c.JSON(status, SSHExecResponse{Error: encoder.Encode(msg), ExitCode: 1})
+	}
+	// legacyFTP: {"error": "BASE64"}
+	legacyFTP legacyError = func(c *gin.Context, status int, msg string) {
+		c.JSON(status, FTPErrorResponse{Error: encoder.Encode(msg)})
+	}
+	// legacyUpload: FileUploadResponse with a plain error
+	legacyUpload legacyError = func(c *gin.Context, status int, msg string) {
+		c.JSON(status, FileUploadResponse{Error: msg})
+	}
+)
+
+// fail writes err as an ErrorEnvelope on /api/v2, and in the handler's legacy shape
+// with legacyStatus on /api so existing clients keep working.
+func (s *Server) fail(c *gin.Context, legacyStatus int, err error, legacy legacyError) {
+	if isV2(c) {
+		apiErr := toAPIError(err)
+		c.AbortWithStatusJSON(apiErr.Status(), ErrorEnvelope{Error: apiErr})
+		return
+	}
+	legacy(c, legacyStatus, err.Error())
+	c.Abort()
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"fmt"
+	"net/textproto"
+	"testing"
+)
+
+func TestClassifyFTPUnavailable(t *testing.T) {
+	tests := []struct {
+		code int
+		msg  string
+		want ErrorCode
+	}{
+		{550, "/x: No such file or directory", CodeNotFound},
+		{550, "File not found", CodeNotFound},
+		{550, "/etc/shadow: Permission denied", CodePermissionDenied},
+		{550, "Access is denied.", CodePermissionDenied},
+		{550, "Requested action not taken.", CodeUpstreamError},
+		{450, "File busy", CodeUpstreamError},
+		{553, "Could not create file.", CodePermissionDenied},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("delete failed: %w", &textproto.Error{Code: tt.code, Msg: tt.msg})
+		if got := classifyError(err); got != tt.want {
+			t.Errorf("%d %q: got %s, want %s", tt.code, tt.msg, got, tt.want)
+		}
+	}
+}
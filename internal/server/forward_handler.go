@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SSHForwardRequest struct {
+	Type    string `json:"type" binding:"required" enum:"local,remote,dynamic"`
+	Listen  string `json:"listen"`  // host:port to listen on: on the target for remote, on the proxy otherwise (default 127.0.0.1:0)
+	Connect string `json:"connect"` // host:port to connect to: from the target for local, from the proxy for remote; unused for dynamic
+}
+
+type SSHForwardListResponse struct {
+	Forwards []ssh.Forward `json:"forwards"`
+}
+
+// handleSSHForwardCreate starts a local, remote or dynamic (SOCKS5) forward
+func (s *Server) handleSSHForwardCreate(c *gin.Context) {
+	var req SSHForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyPlain)
+		return
+	}
+
+	forward, err := s.sshService.StartForward(c.Request.Context(), ssh.ForwardOptions{
+		Type:    req.Type,
+		Listen:  req.Listen,
+		Connect: req.Connect,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ssh.ErrInvalidForward) {
+			status = http.StatusBadRequest
+		}
+		s.fail(c, status, err, legacyPlain)
+		return
+	}
+
+	c.JSON(http.StatusCreated, forward)
+}
+
+func (s *Server) handleSSHForwardList(c *gin.Context) {
+	c.JSON(http.StatusOK, SSHForwardListResponse{Forwards: s.sshService.Forwards()})
+}
+
+func (s *Server) handleSSHForwardDelete(c *gin.Context) {
+	if err := s.sshService.StopForward(c.Param("id")); err != nil {
+		s.fail(c, http.StatusNotFound, err, legacyPlain)
+		return
+	}
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
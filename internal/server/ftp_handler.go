@@ -1,8 +1,14 @@
 package server
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"strings"
 
 	"ssh-ftp-proxy/internal/encoder"
 	"ssh-ftp-proxy/internal/service/ftp"
@@ -11,30 +17,32 @@ import (
 )
 
 type FTPListRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path      string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Recursive bool   `json:"recursive"`                             // Include subdirectories; entries then carry a relative path
+	MaxDepth  int    `json:"max_depth"`                             // Subdirectory levels for recursive listings (default 10)
 }
 
 type FTPListResponse struct {
 	Entries []ftp.Entry `json:"entries"`
-	Error   string      `json:"error,omitempty"` // Base64 encoded
+	Error   string      `json:"error,omitempty" format:"byte"` // Base64 encoded
 }
 
 func (s *Server) handleFTPList(c *gin.Context) {
 	var req FTPListRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid request: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
 		return
 	}
 
 	path, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid base64 path: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
 		return
 	}
 
-	entries, err := s.ftpService.List(path)
+	entries, err := s.ftpService.List(path, ftp.ListOptions{Recursive: req.Recursive, MaxDepth: req.MaxDepth})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, s.newFTPErrorResponse(err.Error()))
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
 		return
 	}
 
@@ -42,73 +50,502 @@ func (s *Server) handleFTPList(c *gin.Context) {
 }
 
 type FTPUploadRequest struct {
-	Path    string `json:"path" binding:"required"`    // Base64 encoded
-	Content string `json:"content" binding:"required"` // Base64 encoded
+	Path       string `json:"path" binding:"required" format:"byte"`    // Base64 encoded
+	Content    string `json:"content" binding:"required" format:"byte"` // Base64 encoded
+	Offset     int64  `json:"offset"`                                   // Write from this byte (resume)
+	Append     bool   `json:"append"`                                   // Append to the remote file
+	TransferID string `json:"transfer_id"`                              // Continue a transfer at its recorded offset
+	Size       int64  `json:"size"`                                     // Total size of the file, for progress
+}
+
+type FTPUploadResponse struct {
+	Status   string       `json:"status"`
+	Transfer ftp.Transfer `json:"transfer"`
+}
+
+// transferIDHeader carries the transfer ID on every upload/download response,
+// including legacy error bodies that have no room for it
+const transferIDHeader = "X-Transfer-ID"
+
+// transferError attaches the transfer state to err so clients learn where to resume
+func transferError(c *gin.Context, err error, t ftp.Transfer) error {
+	if t.ID == "" {
+		return err
+	}
+	c.Header(transferIDHeader, t.ID)
+	apiErr := *toAPIError(err)
+	apiErr.Details = map[string]any{"transfer": t}
+	return &apiErr
+}
+
+// transferStatus is the legacy status of a failed upload or download: request
+// errors about the transfer ID get the status v2 uses, the rest stay 500
+func transferStatus(err error) int {
+	switch {
+	case errors.Is(err, ftp.ErrTransferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ftp.ErrTransferConflict):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
 
 func (s *Server) handleFTPUpload(c *gin.Context) {
 	var req FTPUploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid request: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
 		return
 	}
 
 	path, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid base64 path: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
 		return
 	}
 
 	// Manually decode content because it might be binary
 	contentBytes, err := encoder.DecodeBytes(req.Content)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid base64 content: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 content: %v", err), legacyFTP)
 		return
 	}
 
-	if err := s.ftpService.Upload(path, contentBytes); err != nil {
-		c.JSON(http.StatusInternalServerError, s.newFTPErrorResponse(err.Error()))
+	if req.Offset < 0 || (req.Append && req.Offset > 0) {
+		s.fail(c, http.StatusBadRequest, invalidRequest("offset must be non-negative and cannot be combined with append"), legacyFTP)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	transfer, err := s.ftpService.UploadFrom(path, bytes.NewReader(contentBytes), ftp.UploadOptions{
+		TransferID: req.TransferID,
+		Offset:     req.Offset,
+		Append:     req.Append,
+		Size:       req.Size,
+	})
+	if err != nil {
+		s.fail(c, transferStatus(err), transferError(c, err, transfer), legacyFTP)
+		return
+	}
+
+	c.Header(transferIDHeader, transfer.ID)
+	c.JSON(http.StatusOK, FTPUploadResponse{Status: "ok", Transfer: transfer})
+}
+
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// FTPErrorResponse is the error body of the FTP endpoints
+type FTPErrorResponse struct {
+	Error string `json:"error" format:"byte"` // Base64 encoded
 }
 
 type FTPDownloadRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path       string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Offset     int64  `json:"offset"`                                // Start at this byte
+	Length     int64  `json:"length"`                                // Read at most this many bytes (0 = to the end)
+	TransferID string `json:"transfer_id"`                           // Continue a transfer at its recorded offset
 }
 
 type FTPDownloadResponse struct {
-	Content string `json:"content"`         // Base64 encoded
-	Error   string `json:"error,omitempty"` // Base64 encoded
+	Content  string        `json:"content" format:"byte"`         // Base64 encoded
+	Error    string        `json:"error,omitempty" format:"byte"` // Base64 encoded
+	Transfer *ftp.Transfer `json:"transfer,omitempty"`
 }
 
 func (s *Server) handleFTPDownload(c *gin.Context) {
 	var req FTPDownloadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid request: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
 		return
 	}
 
 	path, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, s.newFTPErrorResponse(fmt.Sprintf("Invalid base64 path: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
 		return
 	}
 
-	content, err := s.ftpService.Download(path)
+	if req.Offset < 0 || req.Length < 0 {
+		s.fail(c, http.StatusBadRequest, invalidRequest("offset and length must be non-negative"), legacyFTP)
+		return
+	}
+
+	content, transfer, err := s.ftpService.DownloadRange(path, ftp.DownloadOptions{
+		TransferID: req.TransferID,
+		Offset:     req.Offset,
+		Length:     req.Length,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, s.newFTPErrorResponse(err.Error()))
+		s.fail(c, transferStatus(err), transferError(c, err, transfer), legacyFTP)
 		return
 	}
 
+	c.Header(transferIDHeader, transfer.ID)
 	c.JSON(http.StatusOK, FTPDownloadResponse{
-		Content: encoder.EncodeBytes(content),
+		Content:  encoder.EncodeBytes(content),
+		Transfer: &transfer,
+	})
+}
+
+// handleFTPTransfer returns the progress of an upload or download
+func (s *Server) handleFTPTransfer(c *gin.Context) {
+	transfer, err := s.ftpService.Transfer(c.Param("id"))
+	if err != nil {
+		s.fail(c, http.StatusNotFound, err, legacyFTP)
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+type FTPMkdirRequest struct {
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+}
+
+// handleFTPMkdir creates a directory with parents
+func (s *Server) handleFTPMkdir(c *gin.Context) {
+	var req FTPMkdirRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	path, err := encoder.Decode(req.Path)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
+		return
+	}
+
+	if err := s.ftpService.Mkdir(path); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type FTPDeleteRequest struct {
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+}
+
+// handleFTPDelete deletes a file
+func (s *Server) handleFTPDelete(c *gin.Context) {
+	var req FTPDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	path, err := encoder.Decode(req.Path)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
+		return
+	}
+
+	if err := s.ftpService.Delete(path); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type FTPRmdirRequest struct {
+	Path      string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Recursive bool   `json:"recursive"`                             // Remove contents first
+}
+
+// handleFTPRmdir removes a directory, optionally with its contents
+func (s *Server) handleFTPRmdir(c *gin.Context) {
+	var req FTPRmdirRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	path, err := encoder.Decode(req.Path)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
+		return
+	}
+
+	if err := s.ftpService.RemoveDir(path, req.Recursive); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type FTPRenameRequest struct {
+	Src string `json:"src" binding:"required" format:"byte"` // Base64 encoded
+	Dst string `json:"dst" binding:"required" format:"byte"` // Base64 encoded
+}
+
+// handleFTPRename moves/renames a file or directory
+func (s *Server) handleFTPRename(c *gin.Context) {
+	var req FTPRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	src, err := encoder.Decode(req.Src)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 src: %v", err), legacyFTP)
+		return
+	}
+
+	dst, err := encoder.Decode(req.Dst)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 dst: %v", err), legacyFTP)
+		return
+	}
+
+	if err := s.ftpService.Rename(src, dst); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type FTPStatRequest struct {
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+}
+
+// handleFTPStat returns size and modification time of a path
+func (s *Server) handleFTPStat(c *gin.Context) {
+	var req FTPStatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	path, err := encoder.Decode(req.Path)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %v", err), legacyFTP)
+		return
+	}
+
+	info, err := s.ftpService.Stat(path)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+type FTPBatchDeleteRequest struct {
+	Paths []string `json:"paths" binding:"required" format:"byte"` // Array of Base64 encoded paths
+}
+
+// handleFTPBatchDelete deletes multiple files/directories
+func (s *Server) handleFTPBatchDelete(c *gin.Context) {
+	var req FTPBatchDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		decoded, err := encoder.Decode(p)
+		if err != nil {
+			s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 path: %s", p), legacyFTP)
+			return
+		}
+		paths = append(paths, decoded)
+	}
+
+	result, err := s.ftpService.BatchDelete(paths)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type FTPSyncRequest struct {
+	Local     string   `json:"local" binding:"required" format:"byte"`  // Base64 encoded local directory
+	Remote    string   `json:"remote" binding:"required" format:"byte"` // Base64 encoded FTP directory
+	Direction string   `json:"direction" enum:"upload,download"`        // upload: local -> FTP (default); download: FTP -> local
+	DryRun    bool     `json:"dry_run"`                                 // Only report the planned actions
+	Delete    bool     `json:"delete"`                                  // Delete destination entries missing from the source
+	Include   []string `json:"include"`                                 // Globs; only matching files are copied
+	Exclude   []string `json:"exclude"`                                 // Globs; matching entries are neither copied nor deleted
+}
+
+type FTPSyncResponse struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+	Poll   string `json:"poll"` // URL to poll for progress
+}
+
+// handleFTPSync starts mirroring a local directory to FTP or back
+func (s *Server) handleFTPSync(c *gin.Context) {
+	var req FTPSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return
+	}
+
+	local, err := encoder.Decode(req.Local)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 local path: %v", err), legacyFTP)
+		return
+	}
+	remote, err := encoder.Decode(req.Remote)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 remote path: %v", err), legacyFTP)
+		return
+	}
+
+	task, err := s.ftpService.StartSync(c.Request.Context(), ftp.SyncOptions{
+		Local:     local,
+		Remote:    remote,
+		Direction: req.Direction,
+		DryRun:    req.DryRun,
+		Delete:    req.Delete,
+		Include:   req.Include,
+		Exclude:   req.Exclude,
+	})
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("%v", err), legacyFTP)
+		return
+	}
+
+	poll := fmt.Sprintf("/api/ftp/sync/%s", task.ID)
+	if isV2(c) {
+		poll = fmt.Sprintf("/api/v2/ftp/sync/%s", task.ID)
+	}
+	c.JSON(http.StatusAccepted, FTPSyncResponse{
+		TaskID: task.ID,
+		Status: task.Status,
+		Poll:   poll,
 	})
 }
 
-func (s *Server) newFTPErrorResponse(msg string) gin.H {
-	return gin.H{
-		"error": encoder.Encode(msg),
+// handleFTPSyncStatus returns the progress of a sync
+func (s *Server) handleFTPSyncStatus(c *gin.Context) {
+	task, err := s.ftpService.SyncTask(c.Param("id"))
+	if err != nil {
+		s.fail(c, http.StatusNotFound, err, legacyFTP)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// FTPUploadStreamForm documents the multipart fields accepted by handleFTPUploadStream.
+// path and extract may also be passed as query parameters; as form fields
+// they must precede the file part, which is streamed as it arrives.
+type FTPUploadStreamForm struct {
+	Path    string `form:"path" binding:"required" format:"byte"` // Base64 encoded destination file or directory
+	File    []byte `form:"file" binding:"required" format:"binary"`
+	Extract string `form:"extract" enum:"true,false"` // Extract .tar.gz/.tgz/.tar/.zip onto the FTP server
+}
+
+// FTPUploadStreamResponse mirrors FileUploadResponse for FTP
+type FTPUploadStreamResponse struct {
+	Success   bool               `json:"success"`
+	Path      string             `json:"path"` // Uploaded file, or the directory the archive was extracted into
+	Size      int64              `json:"size"` // Bytes received
+	Transfer  *ftp.Transfer      `json:"transfer,omitempty"`
+	Extracted *ftp.ExtractResult `json:"extracted,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// handleFTPUploadStream pipes a multipart file straight into STOR without
+// buffering it, optionally extracting an archive onto the FTP server
+func (s *Server) handleFTPUploadStream(c *gin.Context) {
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("multipart/form-data body is required: %v", err), legacyUpload)
+		return
+	}
+
+	pathB64 := c.Query("path")
+	extract := c.Query("extract")
+	var filePart *multipart.Part
+	for filePart == nil {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.fail(c, http.StatusBadRequest, invalidRequest("invalid multipart body: %v", err), legacyUpload)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			filePart = part
+		case "path", "extract":
+			value, err := io.ReadAll(io.LimitReader(part, 64<<10))
+			if err != nil {
+				s.fail(c, http.StatusBadRequest, invalidRequest("invalid multipart body: %v", err), legacyUpload)
+				return
+			}
+			if part.FormName() == "path" {
+				pathB64 = string(value)
+			} else {
+				extract = string(value)
+			}
+		}
+	}
+
+	if pathB64 == "" {
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required (before the file part)"), legacyUpload)
+		return
+	}
+	destPath, err := encoder.Decode(pathB64)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyUpload)
+		return
+	}
+	if filePart == nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("file is required"), legacyUpload)
+		return
+	}
+	defer filePart.Close()
+
+	// A trailing slash or an existing directory receives the file under its own name
+	fullPath := destPath
+	if strings.HasSuffix(destPath, "/") {
+		fullPath = path.Join(destPath, filePart.FileName())
+	} else if info, err := s.ftpService.Stat(destPath); err == nil && info.IsDir {
+		fullPath = path.Join(destPath, filePart.FileName())
 	}
+
+	if extract == "true" {
+		extractDir := path.Dir(fullPath)
+		requestLog(c, s.log).Debugw("Extracting streamed archive to ftp", "archive", filePart.FileName(), "destDir", extractDir)
+		result, err := s.ftpService.ExtractArchive(c.Request.Context(), filePart.FileName(), filePart, extractDir)
+		if err != nil {
+			apiErr := *toAPIError(err)
+			apiErr.Message = "extract failed: " + err.Error()
+			apiErr.Details = result
+			s.fail(c, http.StatusInternalServerError, &apiErr, legacyUpload)
+			return
+		}
+		c.JSON(http.StatusOK, FTPUploadStreamResponse{Success: true, Path: extractDir, Size: result.Bytes, Extracted: &result})
+		return
+	}
+
+	// Like /api/file/upload, create the destination directory if needed
+	if err := s.ftpService.Mkdir(path.Dir(fullPath)); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyUpload)
+		return
+	}
+
+	transfer, err := s.ftpService.UploadFrom(fullPath, filePart, ftp.UploadOptions{})
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, transferError(c, err, transfer), legacyUpload)
+		return
+	}
+
+	requestLog(c, s.log).Infow("File streamed to ftp", "path", fullPath, "size", transfer.Offset)
+	c.Header(transferIDHeader, transfer.ID)
+	c.JSON(http.StatusOK, FTPUploadStreamResponse{Success: true, Path: fullPath, Size: transfer.Offset, Transfer: &transfer})
 }
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/encoder"
+	"ssh-ftp-proxy/internal/service/ftp"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFTPUnknownTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(Options{Config: &config.Config{}})
+	defer s.Close()
+
+	// The transfer is looked up before connecting, so no FTP server is needed
+	for _, tt := range []struct{ path, body string }{
+		{"/api/ftp/upload", `{"path": "L3g=", "content": "eA==", "transfer_id": "transfer_0_0"}`},
+		{"/api/ftp/download", `{"path": "L3g=", "transfer_id": "transfer_0_0"}`},
+		{"/api/v2/ftp/download", `{"path": "L3g=", "transfer_id": "transfer_0_0"}`},
+	} {
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s with unknown transfer_id: status %d, want 404", tt.path, w.Code)
+		}
+	}
+}
+
+// extractFTP records the archives it is asked to extract and fails them
+// with err
+type extractFTP struct {
+	FTPService
+	name, destDir string
+	archive       []byte
+	err           error
+}
+
+func (f *extractFTP) ExtractArchive(ctx context.Context, name string, r io.Reader, destDir string) (ftp.ExtractResult, error) {
+	f.name, f.destDir = name, destDir
+	archive, err := io.ReadAll(r)
+	f.archive = archive
+	if err != nil {
+		return ftp.ExtractResult{}, err
+	}
+	return ftp.ExtractResult{Files: 1, Bytes: int64(len(archive))}, f.err
+}
+
+func (f *extractFTP) Close() {}
+
+func TestFTPUploadStreamExtract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	archive := []byte("\x1f\x8b archive bytes")
+
+	// part is one multipart field; file parts have a file name
+	type part struct{ name, fileName, value string }
+	upload := func(t *testing.T, s *Server, url string, parts ...part) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, p := range parts {
+			var w io.Writer
+			var err error
+			if p.fileName != "" {
+				w, err = mw.CreateFormFile(p.name, p.fileName)
+			} else {
+				w, err = mw.CreateFormField(p.name)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, p.value)
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, url, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		return w
+	}
+	newServer := func(t *testing.T, err error) (*Server, *extractFTP) {
+		ftpSvc := &extractFTP{err: err}
+		s := NewServer(Options{Config: &config.Config{}, FTP: ftpSvc})
+		t.Cleanup(s.Close)
+		return s, ftpSvc
+	}
+	pathPart := part{name: "path", value: encoder.Encode("/www/")}
+	extractPart := part{name: "extract", value: "true"}
+	filePart := part{name: "file", fileName: "site.tar.gz", value: string(archive)}
+
+	t.Run("extracted", func(t *testing.T) {
+		s, ftpSvc := newServer(t, nil)
+		w := upload(t, s, "/api/v2/ftp/upload/stream", pathPart, extractPart, filePart)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var resp FTPUploadStreamResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Path != "/www" || resp.Extracted == nil || resp.Size != int64(len(archive)) {
+			t.Errorf("response = %+v, want the archive extracted into /www", resp)
+		}
+		if ftpSvc.name != "site.tar.gz" || ftpSvc.destDir != "/www" || !bytes.Equal(ftpSvc.archive, archive) {
+			t.Errorf("extracted %q (%d bytes) into %q, want site.tar.gz streamed into /www", ftpSvc.name, len(ftpSvc.archive), ftpSvc.destDir)
+		}
+	})
+
+	t.Run("query parameters", func(t *testing.T) {
+		s, ftpSvc := newServer(t, nil)
+		url := "/api/ftp/upload/stream?extract=true&path=" + encoder.Encode("/www/")
+		if w := upload(t, s, url, filePart); w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		if ftpSvc.destDir != "/www" {
+			t.Errorf("extracted into %q, want /www", ftpSvc.destDir)
+		}
+	})
+
+	t.Run("unsafe entry", func(t *testing.T) {
+		s, _ := newServer(t, fmt.Errorf("%w: ../x", ftp.ErrUnsafePath))
+		w := upload(t, s, "/api/v2/ftp/upload/stream", pathPart, extractPart, filePart)
+		var resp ErrorEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+			t.Fatalf("status %d: %s, want an error envelope", w.Code, w.Body)
+		}
+		if w.Code != http.StatusForbidden || resp.Error.Code != CodePathOutsideSandbox {
+			t.Errorf("status %d, code %s, want 403 %s", w.Code, resp.Error.Code, CodePathOutsideSandbox)
+		}
+	})
+
+	// Fields after the file part arrive too late to apply to it
+	for _, url := range []string{"/api/ftp/upload/stream", "/api/v2/ftp/upload/stream"} {
+		t.Run("path after file "+url, func(t *testing.T) {
+			s, ftpSvc := newServer(t, nil)
+			w := upload(t, s, url, extractPart, filePart, pathPart)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "before the file part") {
+				t.Errorf("status %d: %s, want 400 asking for path before the file", w.Code, w.Body)
+			}
+			if ftpSvc.name != "" {
+				t.Error("archive extracted although its path came after it")
+			}
+		})
+	}
+}
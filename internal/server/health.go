@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ComponentStatus is the probe result for one backend
+type ComponentStatus struct {
+	Name      string `json:"name"`   // ssh, ftp, file
+	Target    string `json:"target"` // host:port or directory
+	Status    string `json:"status"` // ok, error
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	Details   any    `json:"details,omitempty"`
+}
+
+// ReadinessResponse is returned by /api/health/ready
+type ReadinessResponse struct {
+	Status     string            `json:"status"` // ok when every component is ok, otherwise unavailable
+	Version    string            `json:"version"`
+	CheckedAt  time.Time         `json:"checked_at"`
+	Cached     bool              `json:"cached"`
+	Components []ComponentStatus `json:"components"`
+}
+
+// readiness caches probe results so frequent polling does not hammer the backends
+type readiness struct {
+	mu      sync.Mutex
+	last    *ReadinessResponse
+	expires time.Time
+}
+
+var errProbeTimeout = errors.New("probe timed out")
+
+// handleHealthReady actively probes every backend and reports per-component status
+func (s *Server) handleHealthReady(c *gin.Context) {
+	s.settingsMu.RLock()
+	cfg := s.health
+	s.settingsMu.RUnlock()
+	resp := s.checkReadiness(cfg)
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+func (s *Server) checkReadiness(cfg config.HealthConfig) ReadinessResponse {
+	// Holding the lock while probing also coalesces concurrent callers into one probe
+	s.ready.mu.Lock()
+	defer s.ready.mu.Unlock()
+
+	if s.ready.last != nil && time.Now().Before(s.ready.expires) {
+		cached := *s.ready.last
+		cached.Cached = true
+		return cached
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	roots := cfg.FileRoots
+	if len(roots) == 0 {
+		// Multipart uploads are spooled to the temp dir before reaching the file service
+		roots = []string{os.TempDir()}
+	}
+
+	type probe struct {
+		name, target string
+		fn           func() error
+		details      func() any
+	}
+	probes := []probe{
+		{"ssh", s.sshService.Target(), s.sshService.Ping, func() any { return s.sshService.PoolStats() }},
+		{"ftp", s.ftpService.Target(), s.ftpService.Ping, func() any { return s.ftpService.PoolStats() }},
+	}
+	for _, root := range roots {
+		probes = append(probes, probe{"file", root, func() error { return s.fileService.CheckWritable(root) }, nil})
+	}
+
+	components := make([]ComponentStatus, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = runProbe(p.name, p.target, p.fn, timeout)
+			if p.details != nil {
+				components[i].Details = p.details()
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp := ReadinessResponse{
+		Status:     "ok",
+		Version:    Version,
+		CheckedAt:  time.Now(),
+		Components: components,
+	}
+	for _, comp := range components {
+		if comp.Status != "ok" {
+			resp.Status = "unavailable"
+		}
+	}
+
+	ttl := cfg.CacheTTL
+	if ttl < 0 {
+		ttl = 0
+	}
+	s.ready.last = &resp
+	s.ready.expires = time.Now().Add(ttl)
+	return resp
+}
+
+// runProbe runs fn with a timeout. A probe that times out keeps running in the
+// background, but its result is discarded.
+func runProbe(name, target string, fn func() error, timeout time.Duration) ComponentStatus {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = errProbeTimeout
+	}
+
+	comp := ComponentStatus{
+		Name:      name,
+		Target:    target,
+		Status:    "ok",
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		comp.Status = "error"
+		comp.Error = err.Error()
+	}
+	return comp
+}
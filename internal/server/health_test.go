@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probeSSH, probeFTP and probeFile count pings; block makes a ping hang until
+// it is closed. Only what the readiness probe and Close use is implemented.
+type (
+	probeSSH struct {
+		SSHService
+		pings atomic.Int32
+		block chan struct{}
+	}
+	probeFTP struct {
+		FTPService
+		pings atomic.Int32
+	}
+	probeFile struct {
+		FileService
+		pings atomic.Int32
+	}
+)
+
+func (p *probeSSH) Ping() error {
+	p.pings.Add(1)
+	if p.block != nil {
+		<-p.block
+	}
+	return nil
+}
+func (p *probeSSH) Target() string           { return "ssh.test:22" }
+func (p *probeSSH) PoolStats() ssh.PoolStats { return ssh.PoolStats{} }
+func (p *probeSSH) CloseForwards()           {}
+
+func (p *probeFTP) Ping() error              { p.pings.Add(1); return nil }
+func (p *probeFTP) Target() string           { return "ftp.test:21" }
+func (p *probeFTP) PoolStats() ftp.PoolStats { return ftp.PoolStats{} }
+func (p *probeFTP) Close()                   {}
+
+func (p *probeFile) CheckWritable(dir string) error { p.pings.Add(1); return nil }
+
+func TestHealthReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ready := func(t *testing.T, s *Server) (int, ReadinessResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/health/ready", nil))
+		var resp ReadinessResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode readiness: %v", err)
+		}
+		return w.Code, resp
+	}
+	newServer := func(t *testing.T, health config.HealthConfig, sshSvc *probeSSH) (*Server, *probeFTP, *probeFile) {
+		ftpSvc, fileSvc := &probeFTP{}, &probeFile{}
+		health.FileRoots = []string{t.TempDir()}
+		s := NewServer(Options{
+			Config: &config.Config{Health: health},
+			SSH:    sshSvc,
+			FTP:    ftpSvc,
+			File:   fileSvc,
+		})
+		t.Cleanup(s.Close)
+		return s, ftpSvc, fileSvc
+	}
+
+	t.Run("cached within ttl", func(t *testing.T) {
+		sshSvc := &probeSSH{}
+		s, ftpSvc, fileSvc := newServer(t, config.HealthConfig{CacheTTL: 100 * time.Millisecond, Timeout: time.Second}, sshSvc)
+
+		code, resp := ready(t, s)
+		if code != http.StatusOK || resp.Status != "ok" || resp.Cached || len(resp.Components) != 3 {
+			t.Fatalf("first probe: %d %+v, want ok, uncached, 3 components", code, resp)
+		}
+		_, resp = ready(t, s)
+		if !resp.Cached {
+			t.Error("second probe within the TTL was not cached")
+		}
+		if sshSvc.pings.Load() != 1 || ftpSvc.pings.Load() != 1 || fileSvc.pings.Load() != 1 {
+			t.Errorf("pings = %d/%d/%d, want each backend probed once",
+				sshSvc.pings.Load(), ftpSvc.pings.Load(), fileSvc.pings.Load())
+		}
+
+		time.Sleep(150 * time.Millisecond)
+		_, resp = ready(t, s)
+		if resp.Cached || sshSvc.pings.Load() != 2 {
+			t.Errorf("probe after the TTL: cached %v, %d ssh pings, want a fresh probe", resp.Cached, sshSvc.pings.Load())
+		}
+	})
+
+	t.Run("no cache", func(t *testing.T) {
+		sshSvc := &probeSSH{}
+		s, _, _ := newServer(t, config.HealthConfig{Timeout: time.Second}, sshSvc)
+		ready(t, s)
+		_, resp := ready(t, s)
+		if resp.Cached || sshSvc.pings.Load() != 2 {
+			t.Errorf("cached %v after %d ssh pings, want every request probed", resp.Cached, sshSvc.pings.Load())
+		}
+	})
+
+	t.Run("component timeout", func(t *testing.T) {
+		sshSvc := &probeSSH{block: make(chan struct{})}
+		defer close(sshSvc.block)
+		s, _, _ := newServer(t, config.HealthConfig{Timeout: 50 * time.Millisecond}, sshSvc)
+
+		start := time.Now()
+		code, resp := ready(t, s)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("readiness took %s with a 50ms probe timeout", elapsed)
+		}
+		if code != http.StatusServiceUnavailable || resp.Status != "unavailable" {
+			t.Fatalf("readiness = %d %q, want 503 unavailable", code, resp.Status)
+		}
+		for _, comp := range resp.Components {
+			switch {
+			case comp.Name == "ssh" && (comp.Status != "error" || comp.Error != errProbeTimeout.Error()):
+				t.Errorf("ssh component = %+v, want a probe timeout", comp)
+			case comp.Name != "ssh" && comp.Status != "ok":
+				t.Errorf("%s component = %+v, want ok despite the ssh timeout", comp.Name, comp)
+			}
+		}
+	})
+}
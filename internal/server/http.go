@@ -1,11 +1,13 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,61 +15,163 @@ import (
 	"ssh-ftp-proxy/internal/config"
 	"ssh-ftp-proxy/internal/encoder"
 	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/metrics"
+	"ssh-ftp-proxy/internal/redact"
 	"ssh-ftp-proxy/internal/service/file"
 	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/sftp"
 	"ssh-ftp-proxy/internal/service/ssh"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 type Server struct {
 	engine      *gin.Engine
-	sshService  *ssh.Service
-	ftpService  *ftp.Service
-	fileService *file.Service
+	log         *zap.SugaredLogger
+	addr        string
+	sshManager  *ssh.Manager // Set when the server owns it
+	redactor    *redact.Redactor
+	sshService  SSHService
+	ftpService  FTPService
+	sftpService *sftp.Service
+	fileService FileService
 	tasks       sync.Map // async task store: taskID -> *AsyncTask
 	taskCounter int64
 	taskMu      sync.Mutex
+	ready       readiness
+
+	tunnelTransport *http.Transport
+
+	// Settings Reload may change; services update themselves
+	settingsMu   sync.RWMutex
+	tunnelTarget string
+	health       config.HealthConfig
 }
 
-func NewServer() *Server {
+// NewServer creates the HTTP API server from opts. Servers given the same
+// SSHManager share their SSH connections.
+func NewServer(opts Options) *Server {
+	opts, owned := opts.withDefaults()
+	cfg := opts.Config
+
 	engine := gin.New()
 	engine.Use(gin.Recovery())
 	engine.Use(CompatibilityMiddleware())
-	engine.Use(LoggerMiddleware())
+	engine.Use(MetricsMiddleware())
+	engine.Use(RequestIDMiddleware(opts.Logger))
+	engine.Use(LoggerMiddleware(opts.Logger))
 
 	s := &Server{
 		engine:      engine,
-		sshService:  ssh.NewService(config.GlobalConfig.SSHServer),
-		ftpService:  ftp.NewService(config.GlobalConfig.FTPServer),
-		fileService: file.NewService(),
+		log:         opts.Logger,
+		addr:        fmt.Sprintf("%s:%d", cfg.Server.BindIP, cfg.Server.HTTPPort),
+		redactor:    opts.Redactor,
+		sshService:  opts.SSH,
+		ftpService:  opts.FTP,
+		fileService: opts.File,
+	}
+	if owned {
+		s.sshManager = opts.SSHManager
+	}
+	if s.sshService == nil {
+		s.sshService = ssh.NewService(cfg.SSHServer, opts.SSHManager)
+	}
+	if s.ftpService == nil {
+		s.ftpService = ftp.NewService(cfg.FTPServer, opts.Logger)
 	}
+	if s.fileService == nil {
+		s.fileService = file.NewService(opts.Logger)
+	}
+	// SFTP shares the SSH connection instead of dialing again
+	s.sftpService = sftp.NewService(s.sshService, opts.Logger)
+	s.tunnelTarget = cfg.SSHServer.HTTPTunnel
+	s.health = cfg.Health
+	s.tunnelTransport = s.newTunnelTransport()
 
 	s.setupRoutes()
 	return s
 }
 
+// Handler returns the HTTP API handler, for serving it from an existing
+// http.Server instead of Run
+func (s *Server) Handler() http.Handler {
+	return s.engine
+}
+
+// Close stops port forwards and closes the SFTP session and FTP connections.
+// SSH connections are closed only if the server created their ssh.Manager.
+func (s *Server) Close() {
+	s.sshService.CloseForwards()
+	s.tunnelTransport.CloseIdleConnections()
+	s.sftpService.Close()
+	s.ftpService.Close()
+	if s.sshManager != nil {
+		s.sshManager.Close()
+	}
+}
+
 func (s *Server) setupRoutes() {
-	s.engine.GET("/api/health", s.handleHealth)
+	s.engine.GET("/api/openapi.json", s.handleOpenAPI)
+	s.engine.GET("/metrics", gin.WrapH(metrics.Handler()))
 
-	sshGroup := s.engine.Group("/api/ssh")
+	// /api keeps the legacy per-handler error shapes, /api/v2 returns ErrorEnvelope everywhere
+	s.registerAPI(s.engine.Group("/api"))
+	s.registerAPI(s.engine.Group("/api/v2", apiV2Middleware()))
+}
+
+func (s *Server) registerAPI(api *gin.RouterGroup) {
+	api.GET("/health", s.handleHealth)
+	api.GET("/health/ready", s.handleHealthReady)
+
+	sshGroup := api.Group("/ssh")
 	{
 		sshGroup.POST("/exec", s.handleSSHExec)
 		sshGroup.GET("/exec", s.handleSSHExecGet)
 		sshGroup.POST("/exec/async", s.handleSSHExecAsync)
 		sshGroup.GET("/task/:id", s.handleSSHTaskStatus)
 		sshGroup.POST("/script", s.handleSSHScript)
+		sshGroup.POST("/forwards", s.handleSSHForwardCreate)
+		sshGroup.GET("/forwards", s.handleSSHForwardList)
+		sshGroup.DELETE("/forwards/:id", s.handleSSHForwardDelete)
+		for _, method := range tunnelMethods {
+			sshGroup.Handle(method, "/tunnel/http/*path", s.handleSSHTunnelHTTP)
+		}
 	}
 
-	ftpGroup := s.engine.Group("/api/ftp")
+	ftpGroup := api.Group("/ftp")
 	{
 		ftpGroup.POST("/list", s.handleFTPList)
 		ftpGroup.POST("/upload", s.handleFTPUpload)
+		ftpGroup.POST("/upload/stream", s.handleFTPUploadStream)
 		ftpGroup.POST("/download", s.handleFTPDownload)
+		ftpGroup.GET("/transfer/:id", s.handleFTPTransfer)
+		ftpGroup.POST("/mkdir", s.handleFTPMkdir)
+		ftpGroup.POST("/delete", s.handleFTPDelete)
+		ftpGroup.POST("/rmdir", s.handleFTPRmdir)
+		ftpGroup.POST("/rename", s.handleFTPRename)
+		ftpGroup.POST("/stat", s.handleFTPStat)
+		ftpGroup.POST("/batch/delete", s.handleFTPBatchDelete)
+		ftpGroup.POST("/sync", s.handleFTPSync)
+		ftpGroup.GET("/sync/:id", s.handleFTPSyncStatus)
+	}
+
+	sftpGroup := api.Group("/sftp")
+	{
+		sftpGroup.POST("/list", s.handleSFTPList)
+		sftpGroup.POST("/stat", s.handleSFTPStat)
+		sftpGroup.POST("/upload", s.handleSFTPUpload)
+		sftpGroup.POST("/download", s.handleSFTPDownload)
+		sftpGroup.POST("/mkdir", s.handleSFTPMkdir)
+		sftpGroup.POST("/rename", s.handleSFTPRename)
+		sftpGroup.POST("/remove", s.handleSFTPRemove)
+		sftpGroup.POST("/chmod", s.handleSFTPChmod)
+		sftpGroup.POST("/symlink", s.handleSFTPSymlink)
+		sftpGroup.POST("/readlink", s.handleSFTPReadlink)
 	}
 
 	// New file API (HTTP multipart upload)
-	fileGroup := s.engine.Group("/api/file")
+	fileGroup := api.Group("/file")
 	{
 		fileGroup.POST("/upload", s.handleFileUpload)
 		fileGroup.POST("/list", s.handleFileList)
@@ -82,17 +186,16 @@ func (s *Server) setupRoutes() {
 	}
 }
 
-func (s *Server) Run() error {
-	addr := fmt.Sprintf("%s:%d", config.GlobalConfig.Server.BindIP, config.GlobalConfig.Server.HTTPPort)
-	logger.Log.Info("Starting HTTP Server", "addr", addr)
-	return s.engine.Run(addr)
+// Addr is the listen address from server.bind_ip and server.http_port
+func (s *Server) Addr() string {
+	return s.addr
 }
 
-func LoggerMiddleware() gin.HandlerFunc {
+func LoggerMiddleware(log *zap.SugaredLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
 		c.Next()
-		logger.Log.Info("Request",
+		requestLog(c, log).Infow("Request",
 			"method", c.Request.Method,
 			"path", path,
 			"status", c.Writer.Status(),
@@ -101,6 +204,20 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// MetricsMiddleware records request counts and latency per route pattern
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
 // CompatibilityMiddleware fixes chunked transfer and connection issues with PowerShell
 func CompatibilityMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -110,49 +227,59 @@ func CompatibilityMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Version is reported by /api/health and the OpenAPI document.
+// Release builds override it with -ldflags "-X ssh-ftp-proxy/internal/server.Version=x.y.z".
+var Version = "1.7.0"
+
+type HealthResponse struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
 func (s *Server) handleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "version": "1.7.0"})
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok", Version: Version})
+}
+
+// ErrorResponse is the plain error body returned by the file and task endpoints
+type ErrorResponse struct {
+	Error string `json:"error"`
 }
 
 type SSHExecRequest struct {
-	Command string `json:"command" binding:"required"` // Base64 encoded
+	Command string `json:"command" binding:"required" format:"byte"` // Base64 encoded
 }
 
 type SSHExecResponse struct {
-	Stdout   string `json:"stdout"` // Base64 encoded
-	Stderr   string `json:"stderr"` // Base64 encoded
+	Stdout   string `json:"stdout" format:"byte"` // Base64 encoded
+	Stderr   string `json:"stderr" format:"byte"` // Base64 encoded
 	ExitCode int    `json:"exit_code"`
-	Error    string `json:"error,omitempty"` // Base64 encoded
+	Error    string `json:"error,omitempty" format:"byte"` // Base64 encoded
 }
 
 func (s *Server) handleSSHExec(c *gin.Context) {
 	var req SSHExecRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, s.newErrorResponse(fmt.Sprintf("Invalid request: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacySSH)
 		return
 	}
 
 	// 1. Decode Command
 	cmd, err := encoder.Decode(req.Command)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, s.newErrorResponse(fmt.Sprintf("Invalid base64 command: %v", err)))
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 command: %v", err), legacySSH)
 		return
 	}
 
-	logger.Log.Debug("Executing SSH command", "command", cmd)
+	requestLog(c, s.log).Debugw("Executing SSH command", "command", cmd)
 
 	// 2. Execute
-	stdout, stderr, exitCode, execErr := s.sshService.Exec(cmd)
+	stdout, stderr, exitCode, execErr := s.sshService.Exec(c.Request.Context(), cmd)
 
 	// 3. Encode Response
-	resp := SSHExecResponse{
-		Stdout:   encoder.Encode(stdout),
-		Stderr:   encoder.Encode(stderr),
-		ExitCode: exitCode,
-	}
-
-	if execErr != nil {
-		resp.Error = encoder.Encode(execErr.Error())
+	resp, err := execResponse(isV2(c), stdout, stderr, exitCode, execErr)
+	if err != nil {
+		s.fail(c, http.StatusOK, err, legacySSH)
+		return
 	}
 
 	c.JSON(http.StatusOK, resp)
@@ -163,49 +290,69 @@ func (s *Server) handleSSHExec(c *gin.Context) {
 func (s *Server) handleSSHExecGet(c *gin.Context) {
 	cmdB64 := c.Query("cmd")
 	if cmdB64 == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "cmd query parameter is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("cmd query parameter is required"), legacyPlain)
 		return
 	}
 
 	cmd, err := encoder.Decode(cmdB64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid base64 cmd: %v", err)})
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 cmd: %v", err), legacyPlain)
 		return
 	}
 
-	logger.Log.Debug("Executing SSH command (GET)", "command", cmd)
+	requestLog(c, s.log).Debugw("Executing SSH command (GET)", "command", cmd)
+
+	stdout, stderr, exitCode, execErr := s.sshService.Exec(c.Request.Context(), cmd)
 
-	stdout, stderr, exitCode, execErr := s.sshService.Exec(cmd)
+	resp, err := execResponse(isV2(c), stdout, stderr, exitCode, execErr)
+	if err != nil {
+		s.fail(c, http.StatusOK, err, legacySSH)
+		return
+	}
 
+	c.JSON(http.StatusOK, resp)
+}
+
+// execResponse encodes the outcome of one command. On /api/v2 only a failure to run the
+// command is returned as an error; a non-zero exit status is reported through ExitCode alone.
+func execResponse(v2 bool, stdout, stderr string, exitCode int, execErr error) (SSHExecResponse, error) {
 	resp := SSHExecResponse{
 		Stdout:   encoder.Encode(stdout),
 		Stderr:   encoder.Encode(stderr),
 		ExitCode: exitCode,
 	}
-
-	if execErr != nil {
-		resp.Error = encoder.Encode(execErr.Error())
+	if execErr == nil {
+		return resp, nil
 	}
-
-	c.JSON(http.StatusOK, resp)
-}
-
-func (s *Server) newErrorResponse(msg string) SSHExecResponse {
-	return SSHExecResponse{
-		Error:    encoder.Encode(msg),
-		ExitCode: 1,
+	if v2 {
+		if ssh.IsExitError(execErr) {
+			return resp, nil
+		}
+		return resp, execErr
 	}
+	resp.Error = encoder.Encode(execErr.Error())
+	return resp, nil
 }
 
 // ============ Async SSH Execution ============
 
 type AsyncTask struct {
 	ID        string           `json:"id"`
-	Status    string           `json:"status"` // running, done, error
-	Command   string           `json:"command"`
+	Status    string           `json:"status"`               // running, done, error
+	Command   string           `json:"command"`              // With secrets masked
+	RequestID string           `json:"request_id,omitempty"` // X-Request-ID of the request that started it
 	Result    *SSHExecResponse `json:"result,omitempty"`
+	Error     *APIError        `json:"error,omitempty"` // /api/v2 only: why the command could not run
 	CreatedAt time.Time        `json:"created_at"`
 	DoneAt    *time.Time       `json:"done_at,omitempty"`
+
+	err error // raw execution error, rendered per API version
+}
+
+type SSHExecAsyncResponse struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
+	Poll   string `json:"poll"` // URL to poll for the result
 }
 
 func (s *Server) nextTaskID() string {
@@ -219,13 +366,13 @@ func (s *Server) nextTaskID() string {
 func (s *Server) handleSSHExecAsync(c *gin.Context) {
 	var req SSHExecRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyPlain)
 		return
 	}
 
 	cmd, err := encoder.Decode(req.Command)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid base64 command: %v", err)})
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 command: %v", err), legacyPlain)
 		return
 	}
 
@@ -233,15 +380,19 @@ func (s *Server) handleSSHExecAsync(c *gin.Context) {
 	task := &AsyncTask{
 		ID:        taskID,
 		Status:    "running",
-		Command:   cmd,
+		Command:   s.redactor.String(cmd),
+		RequestID: c.GetString(requestIDKey),
 		CreatedAt: time.Now(),
 	}
 	s.tasks.Store(taskID, task)
+	metrics.AsyncTasks.WithLabelValues("running").Inc()
 
-	logger.Log.Debug("Async SSH command started", "task_id", taskID, "command", cmd)
+	log := requestLog(c, s.log)
+	log.Debugw("Async SSH command started", "task_id", taskID, "command", cmd)
 
 	go func() {
-		stdout, stderr, exitCode, execErr := s.sshService.Exec(cmd)
+		// The task outlives the request: keep its logger, not its context
+		stdout, stderr, exitCode, execErr := s.sshService.Exec(logger.NewContext(context.Background(), log), cmd)
 		now := time.Now()
 		resp := &SSHExecResponse{
 			Stdout:   encoder.Encode(stdout),
@@ -251,20 +402,31 @@ func (s *Server) handleSSHExecAsync(c *gin.Context) {
 		if execErr != nil {
 			resp.Error = encoder.Encode(execErr.Error())
 		}
-		task.Result = resp
-		task.DoneAt = &now
+		// Pollers may be reading the running task: store a finished copy
+		// instead of mutating it
+		done := *task
+		done.Result = resp
+		done.err = execErr
+		done.DoneAt = &now
 		if execErr != nil {
-			task.Status = "error"
+			done.Status = "error"
 		} else {
-			task.Status = "done"
+			done.Status = "done"
 		}
-		logger.Log.Debug("Async SSH command done", "task_id", taskID, "exit_code", exitCode)
+		s.tasks.Store(taskID, &done)
+		metrics.AsyncTasks.WithLabelValues("running").Dec()
+		metrics.AsyncTasks.WithLabelValues(done.Status).Inc()
+		log.Debugw("Async SSH command done", "task_id", taskID, "exit_code", exitCode)
 	}()
 
-	c.JSON(http.StatusAccepted, gin.H{
-		"task_id": taskID,
-		"status":  "running",
-		"poll":    fmt.Sprintf("/api/ssh/task/%s", taskID),
+	poll := fmt.Sprintf("/api/ssh/task/%s", taskID)
+	if isV2(c) {
+		poll = fmt.Sprintf("/api/v2/ssh/task/%s", taskID)
+	}
+	c.JSON(http.StatusAccepted, SSHExecAsyncResponse{
+		TaskID: taskID,
+		Status: "running",
+		Poll:   poll,
 	})
 }
 
@@ -273,18 +435,31 @@ func (s *Server) handleSSHTaskStatus(c *gin.Context) {
 	taskID := c.Param("id")
 	val, ok := s.tasks.Load(taskID)
 	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		s.fail(c, http.StatusNotFound, newAPIError(CodeNotFound, "Task not found"), legacyPlain)
 		return
 	}
 	task := val.(*AsyncTask)
-	c.JSON(http.StatusOK, task)
+	if !isV2(c) || task.Result == nil {
+		c.JSON(http.StatusOK, task)
+		return
+	}
+
+	// v2: drop the Base64 error string and report run failures as an APIError
+	view := *task
+	result := *task.Result
+	result.Error = ""
+	view.Result = &result
+	if task.err != nil && !ssh.IsExitError(task.err) {
+		view.Error = toAPIError(task.err)
+	}
+	c.JSON(http.StatusOK, view)
 }
 
 // ============ Script Execution ============
 
 type SSHScriptRequest struct {
-	Script   string   `json:"script"`   // Base64 encoded bash script
-	Commands []string `json:"commands"` // Alternative: array of Base64 encoded commands
+	Script   string   `json:"script" format:"byte"`   // Base64 encoded bash script
+	Commands []string `json:"commands" format:"byte"` // Alternative: array of Base64 encoded commands
 }
 
 type SSHScriptResponse struct {
@@ -297,29 +472,27 @@ type SSHScriptResponse struct {
 func (s *Server) handleSSHScript(c *gin.Context) {
 	var req SSHScriptRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyPlain)
 		return
 	}
+	v2 := isV2(c)
 
 	// Mode 1: Execute a single script block
 	if req.Script != "" {
 		script, err := encoder.Decode(req.Script)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid base64 script: %v", err)})
+			s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 script: %v", err), legacyPlain)
 			return
 		}
 		// Wrap in bash -c for multi-line script
 		wrappedCmd := fmt.Sprintf("bash -c %s", shellQuote(script))
-		logger.Log.Debug("Executing SSH script", "length", len(script))
+		requestLog(c, s.log).Debugw("Executing SSH script", "length", len(script))
 
-		stdout, stderr, exitCode, execErr := s.sshService.Exec(wrappedCmd)
-		resp := SSHExecResponse{
-			Stdout:   encoder.Encode(stdout),
-			Stderr:   encoder.Encode(stderr),
-			ExitCode: exitCode,
-		}
-		if execErr != nil {
-			resp.Error = encoder.Encode(execErr.Error())
+		stdout, stderr, exitCode, execErr := s.sshService.Exec(c.Request.Context(), wrappedCmd)
+		resp, err := execResponse(v2, stdout, stderr, exitCode, execErr)
+		if err != nil {
+			s.fail(c, http.StatusOK, err, legacyPlain)
+			return
 		}
 		c.JSON(http.StatusOK, SSHScriptResponse{
 			Results: []SSHExecResponse{resp},
@@ -331,10 +504,20 @@ func (s *Server) handleSSHScript(c *gin.Context) {
 
 	// Mode 2: Execute array of commands sequentially
 	if len(req.Commands) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either 'script' or 'commands' is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("Either 'script' or 'commands' is required"), legacyPlain)
 		return
 	}
 
+	// v2 rejects the whole request up front instead of reporting bad items inline
+	if v2 {
+		for i, cmdB64 := range req.Commands {
+			if _, err := encoder.Decode(cmdB64); err != nil {
+				s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 in commands[%d]: %v", i, err), legacyPlain)
+				return
+			}
+		}
+	}
+
 	var results []SSHExecResponse
 	failed := 0
 	for _, cmdB64 := range req.Commands {
@@ -347,14 +530,15 @@ func (s *Server) handleSSHScript(c *gin.Context) {
 			failed++
 			continue
 		}
-		stdout, stderr, exitCode, execErr := s.sshService.Exec(cmd)
-		resp := SSHExecResponse{
-			Stdout:   encoder.Encode(stdout),
-			Stderr:   encoder.Encode(stderr),
-			ExitCode: exitCode,
+		stdout, stderr, exitCode, execErr := s.sshService.Exec(c.Request.Context(), cmd)
+		resp, err := execResponse(v2, stdout, stderr, exitCode, execErr)
+		if err != nil {
+			apiErr := toAPIError(err)
+			apiErr.Details = gin.H{"completed": results}
+			s.fail(c, http.StatusOK, apiErr, legacyPlain)
+			return
 		}
-		if execErr != nil {
-			resp.Error = encoder.Encode(execErr.Error())
+		if execErr != nil || (v2 && exitCode != 0) {
 			failed++
 		}
 		results = append(results, resp)
@@ -388,39 +572,46 @@ type FileUploadResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// FileUploadForm documents the multipart fields accepted by handleFileUpload
+type FileUploadForm struct {
+	Path    string `form:"path" binding:"required" format:"byte"` // Base64 encoded destination file or directory
+	File    []byte `form:"file" binding:"required" format:"binary"`
+	Extract string `form:"extract" enum:"true,false"` // Extract .tar.gz/.tgz/.tar/.zip after upload
+}
+
 // handleFileUpload handles multipart file upload
 // Supports optional auto-extract for tar.gz/zip files
 func (s *Server) handleFileUpload(c *gin.Context) {
 	// Get destination path (base64 encoded)
 	pathB64 := c.PostForm("path")
 	if pathB64 == "" {
-		c.JSON(http.StatusBadRequest, FileUploadResponse{Error: "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyUpload)
 		return
 	}
 
 	destPath, err := encoder.Decode(pathB64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, FileUploadResponse{Error: "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyUpload)
 		return
 	}
 
-	logger.Log.Debug("File upload request", "destPath", destPath)
+	requestLog(c, s.log).Debugw("File upload request", "destPath", destPath)
 
 	// Get file from form
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		logger.Log.Error("Failed to get file from form", "error", err)
-		c.JSON(http.StatusBadRequest, FileUploadResponse{Error: "file is required: " + err.Error()})
+		requestLog(c, s.log).Errorw("Failed to get file from form", "error", err)
+		s.fail(c, http.StatusBadRequest, invalidRequest("file is required: %v", err), legacyUpload)
 		return
 	}
 
-	logger.Log.Debug("Received file", "filename", fileHeader.Filename, "size", fileHeader.Size)
+	requestLog(c, s.log).Debugw("Received file", "filename", fileHeader.Filename, "size", fileHeader.Size)
 
 	// Open uploaded file
 	src, err := fileHeader.Open()
 	if err != nil {
-		logger.Log.Error("Failed to open uploaded file", "error", err)
-		c.JSON(http.StatusInternalServerError, FileUploadResponse{Error: err.Error()})
+		requestLog(c, s.log).Errorw("Failed to open uploaded file", "error", err)
+		s.fail(c, http.StatusInternalServerError, err, legacyUpload)
 		return
 	}
 	defer src.Close()
@@ -436,25 +627,32 @@ func (s *Server) handleFileUpload(c *gin.Context) {
 		fullPath = filepath.Join(destPath, fileHeader.Filename)
 	}
 
-	logger.Log.Debug("Saving file", "fullPath", fullPath)
+	requestLog(c, s.log).Debugw("Saving file", "fullPath", fullPath)
 
 	// Save file
-	if err := s.fileService.SaveFile(src, fullPath); err != nil {
-		logger.Log.Error("Failed to save file", "error", err, "path", fullPath)
-		c.JSON(http.StatusInternalServerError, FileUploadResponse{Error: err.Error()})
+	if err := s.fileService.SaveFile(c.Request.Context(), src, fullPath); err != nil {
+		requestLog(c, s.log).Errorw("Failed to save file", "error", err, "path", fullPath)
+		s.fail(c, http.StatusInternalServerError, err, legacyUpload)
 		return
 	}
 
-	logger.Log.Info("File saved", "path", fullPath, "size", fileHeader.Size)
+	requestLog(c, s.log).Infow("File saved", "path", fullPath, "size", fileHeader.Size)
 
 	// Check if auto-extract is requested
 	extract := c.PostForm("extract")
 	if extract == "true" {
 		// Extract to same directory as archive
 		extractDir := filepath.Dir(fullPath)
-		logger.Log.Debug("Extracting archive", "archive", fullPath, "destDir", extractDir)
-		if err := s.fileService.ExtractArchive(fullPath, extractDir); err != nil {
-			logger.Log.Error("Failed to extract archive", "error", err)
+		requestLog(c, s.log).Debugw("Extracting archive", "archive", fullPath, "destDir", extractDir)
+		if err := s.fileService.ExtractArchive(c.Request.Context(), fullPath, extractDir); err != nil {
+			requestLog(c, s.log).Errorw("Failed to extract archive", "error", err)
+			if isV2(c) {
+				apiErr := toAPIError(err)
+				apiErr.Message = "upload success but extract failed: " + err.Error()
+				apiErr.Details = FileUploadResponse{Success: true, Path: fullPath, Size: fileHeader.Size}
+				s.fail(c, http.StatusOK, apiErr, legacyUpload)
+				return
+			}
 			c.JSON(http.StatusOK, FileUploadResponse{
 				Success: true,
 				Path:    fullPath,
@@ -465,7 +663,7 @@ func (s *Server) handleFileUpload(c *gin.Context) {
 		}
 		// Delete archive after successful extraction
 		os.Remove(fullPath)
-		logger.Log.Info("File uploaded and extracted", "path", extractDir)
+		requestLog(c, s.log).Infow("File uploaded and extracted", "path", extractDir)
 	}
 
 	c.JSON(http.StatusOK, FileUploadResponse{
@@ -477,229 +675,256 @@ func (s *Server) handleFileUpload(c *gin.Context) {
 
 // FileListRequest represents the request for file listing
 type FileListRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileList lists directory contents
 func (s *Server) handleFileList(c *gin.Context) {
 	var req FileListRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyPlain)
 		return
 	}
 
 	dirPath, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyPlain)
 		return
 	}
 
 	files, err := s.fileService.ListDir(dirPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"files": files})
+	c.JSON(http.StatusOK, FileListResponse{Files: files})
+}
+
+type FileListResponse struct {
+	Files []file.FileInfo `json:"files"`
 }
 
 // FileDownloadRequest represents the request for file download
 type FileDownloadRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileDownload downloads a file
 func (s *Server) handleFileDownload(c *gin.Context) {
 	var req FileDownloadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyPlain)
 		return
 	}
 
 	filePath, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyPlain)
 		return
 	}
 
 	// Check if file exists
 	info, err := os.Stat(filePath)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		s.fail(c, http.StatusNotFound, newAPIError(CodeNotFound, "file not found"), legacyPlain)
 		return
 	}
 
 	if info.IsDir() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot download directory"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("cannot download directory"), legacyPlain)
 		return
 	}
 
 	// Open and read file
 	file, err := os.Open(filePath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"content": encoder.EncodeBytes(content),
-		"name":    filepath.Base(filePath),
-		"size":    info.Size(),
+	metrics.FileBytes.WithLabelValues("download").Add(float64(len(content)))
+	c.JSON(http.StatusOK, FileDownloadResponse{
+		Content: encoder.EncodeBytes(content),
+		Name:    filepath.Base(filePath),
+		Size:    info.Size(),
 	})
 }
 
+type FileDownloadResponse struct {
+	Content string `json:"content" format:"byte"` // Base64 encoded
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+}
+
 // FileDeleteRequest represents the request for file deletion
 type FileDeleteRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileDelete deletes a file or directory
 func (s *Server) handleFileDelete(c *gin.Context) {
 	var req FileDeleteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyPlain)
 		return
 	}
 
 	filePath, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyPlain)
 		return
 	}
 
 	// Remove file or directory
 	if err := os.RemoveAll(filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+type SuccessResponse struct {
+	Success bool `json:"success"`
 }
 
 // FileMkdirRequest represents the request for mkdir
 type FileMkdirRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileMkdir creates a directory
 func (s *Server) handleFileMkdir(c *gin.Context) {
 	var req FileMkdirRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyPlain)
 		return
 	}
 
 	dirPath, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyPlain)
 		return
 	}
 
-	if err := s.fileService.Mkdir(dirPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.fileService.Mkdir(c.Request.Context(), dirPath); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "path": dirPath})
+	c.JSON(http.StatusOK, FileMkdirResponse{Success: true, Path: dirPath})
+}
+
+type FileMkdirResponse struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path"`
 }
 
 // FileRenameRequest represents the request for rename/move
 type FileRenameRequest struct {
-	Src string `json:"src" binding:"required"` // Base64 encoded
-	Dst string `json:"dst" binding:"required"` // Base64 encoded
+	Src string `json:"src" binding:"required" format:"byte"` // Base64 encoded
+	Dst string `json:"dst" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileRename moves/renames a file or directory
 func (s *Server) handleFileRename(c *gin.Context) {
 	var req FileRenameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "src and dst are required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("src and dst are required"), legacyPlain)
 		return
 	}
 
 	srcPath, err := encoder.Decode(req.Src)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 src"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 src"), legacyPlain)
 		return
 	}
 
 	dstPath, err := encoder.Decode(req.Dst)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 dst"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 dst"), legacyPlain)
 		return
 	}
 
-	if err := s.fileService.Rename(srcPath, dstPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.fileService.Rename(c.Request.Context(), srcPath, dstPath); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "src": srcPath, "dst": dstPath})
+	c.JSON(http.StatusOK, FileMoveResponse{Success: true, Src: srcPath, Dst: dstPath})
+}
+
+// FileMoveResponse is returned by rename and copy
+type FileMoveResponse struct {
+	Success bool   `json:"success"`
+	Src     string `json:"src"`
+	Dst     string `json:"dst"`
 }
 
 // FileCopyRequest represents the request for copy
 type FileCopyRequest struct {
-	Src string `json:"src" binding:"required"` // Base64 encoded
-	Dst string `json:"dst" binding:"required"` // Base64 encoded
+	Src string `json:"src" binding:"required" format:"byte"` // Base64 encoded
+	Dst string `json:"dst" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileCopy copies a file or directory
 func (s *Server) handleFileCopy(c *gin.Context) {
 	var req FileCopyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "src and dst are required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("src and dst are required"), legacyPlain)
 		return
 	}
 
 	srcPath, err := encoder.Decode(req.Src)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 src"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 src"), legacyPlain)
 		return
 	}
 
 	dstPath, err := encoder.Decode(req.Dst)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 dst"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 dst"), legacyPlain)
 		return
 	}
 
-	if err := s.fileService.Copy(srcPath, dstPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.fileService.Copy(c.Request.Context(), srcPath, dstPath); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "src": srcPath, "dst": dstPath})
+	c.JSON(http.StatusOK, FileMoveResponse{Success: true, Src: srcPath, Dst: dstPath})
 }
 
 // FileInfoRequest represents the request for file info
 type FileInfoRequest struct {
-	Path string `json:"path" binding:"required"` // Base64 encoded
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
 }
 
 // handleFileInfo returns detailed file information
 func (s *Server) handleFileInfo(c *gin.Context) {
 	var req FileInfoRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("path is required"), legacyPlain)
 		return
 	}
 
 	filePath, err := encoder.Decode(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 path"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path"), legacyPlain)
 		return
 	}
 
 	info, err := s.fileService.GetInfo(filePath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, http.StatusInternalServerError, err, legacyPlain)
 		return
 	}
 
@@ -708,14 +933,14 @@ func (s *Server) handleFileInfo(c *gin.Context) {
 
 // FileBatchDeleteRequest represents the request for batch delete
 type FileBatchDeleteRequest struct {
-	Paths []string `json:"paths" binding:"required"` // Array of Base64 encoded paths
+	Paths []string `json:"paths" binding:"required" format:"byte"` // Array of Base64 encoded paths
 }
 
 // handleFileBatchDelete deletes multiple files/directories
 func (s *Server) handleFileBatchDelete(c *gin.Context) {
 	var req FileBatchDeleteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "paths array is required"})
+		s.fail(c, http.StatusBadRequest, invalidRequest("paths array is required"), legacyPlain)
 		return
 	}
 
@@ -724,12 +949,12 @@ func (s *Server) handleFileBatchDelete(c *gin.Context) {
 	for _, p := range req.Paths {
 		decoded, err := encoder.Decode(p)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid base64 path: %s", p)})
+			s.fail(c, http.StatusBadRequest, invalidRequest("invalid base64 path: %s", p), legacyPlain)
 			return
 		}
 		decodedPaths = append(decodedPaths, decoded)
 	}
 
-	result := s.fileService.BatchDelete(decodedPaths)
+	result := s.fileService.BatchDelete(c.Request.Context(), decodedPaths)
 	c.JSON(http.StatusOK, result)
 }
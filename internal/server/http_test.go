@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/encoder"
+	"ssh-ftp-proxy/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsRouteLabels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(Options{Config: &config.Config{}})
+	defer s.Close()
+
+	counted := func(method, route, status string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(method, route, status))
+	}
+	before := counted("GET", "/api/ssh/task/:id", "404")
+	for _, path := range []string{"/api/ssh/task/a", "/api/ssh/task/b", "/api/v2/ssh/task/c", "/no/such/route"} {
+		s.engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics: status %d", w.Code)
+	}
+	body := w.Body.String()
+
+	// Requests are counted per route pattern, never per raw path
+	if n := counted("GET", "/api/ssh/task/:id", "404") - before; n != 2 {
+		t.Errorf("counted %v requests to /api/ssh/task/:id, want 2", n)
+	}
+	for _, want := range []string{
+		`ssh_ftp_proxy_http_requests_total{method="GET",route="/api/ssh/task/:id",status="404"}`,
+		`ssh_ftp_proxy_http_requests_total{method="GET",route="/api/v2/ssh/task/:id",status="404"}`,
+		`ssh_ftp_proxy_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`ssh_ftp_proxy_http_request_duration_seconds_count{method="GET",route="/api/ssh/task/:id"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+	if strings.Contains(body, "/api/ssh/task/a") || strings.Contains(body, "/no/such/route") {
+		t.Error("/metrics labels a raw request path")
+	}
+}
+
+// slowSSH runs every command until release is closed
+type slowSSH struct {
+	SSHService
+	release chan struct{}
+}
+
+func (s slowSSH) Exec(ctx context.Context, cmd string) (string, string, int, error) {
+	<-s.release
+	return "out", "", 0, nil
+}
+
+func (slowSSH) CloseForwards() {}
+
+func TestSSHExecAsyncPoll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sshSvc := slowSSH{release: make(chan struct{})}
+	s := NewServer(Options{Config: &config.Config{}, SSH: sshSvc})
+	defer s.Close()
+
+	body := `{"command": "` + encoder.Encode("sleep 1") + `"}`
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v2/ssh/exec/async", strings.NewReader(body)))
+	var started SSHExecAsyncResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil || w.Code != http.StatusAccepted {
+		t.Fatalf("start: %d %s", w.Code, w.Body)
+	}
+
+	poll := func(path string) AsyncTask {
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var task AsyncTask
+		if err := json.Unmarshal(w.Body.Bytes(), &task); err != nil {
+			t.Errorf("poll %s: %d %s", path, w.Code, w.Body)
+		}
+		return task
+	}
+
+	// Poll from both API versions while the command finishes; -race catches
+	// the result being written under a reader
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				poll("/api/ssh/task/" + started.TaskID)
+				poll(started.Poll)
+			}
+		}
+	}()
+	if task := poll(started.Poll); task.Status != "running" || task.Result != nil {
+		t.Errorf("before the command ends: %+v, want running without a result", task)
+	}
+	close(sshSvc.release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	task := poll(started.Poll)
+	for task.Status == "running" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		task = poll(started.Poll)
+	}
+	close(stop)
+	<-polled
+
+	if task.Status != "done" || task.DoneAt == nil || task.Result == nil {
+		t.Fatalf("finished task = %+v, want done with a result", task)
+	}
+	if stdout, _ := encoder.Decode(task.Result.Stdout); stdout != "out" {
+		t.Errorf("stdout = %q, want out", stdout)
+	}
+}
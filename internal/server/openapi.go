@@ -0,0 +1,355 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/service/file"
+	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/sftp"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiOperation documents one route registered in setupRoutes.
+// Request/Response hold zero values of the Go types used by the handler;
+// their JSON schemas are derived by reflection so the document follows the code.
+type apiOperation struct {
+	Method      string
+	Path        string // gin syntax, e.g. /api/ssh/task/:id
+	Tag         string
+	Summary     string
+	Query       []apiParam
+	Request     any // JSON request body
+	Form        any // multipart/form-data request body
+	Status      int // success status, defaults to 200
+	Response    any
+	ContentType string // success content type, defaults to application/json
+	Errors      any    // legacy error body, defaults to ErrorResponse
+	Unversioned bool   // not mirrored under /api/v2
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Format      string
+}
+
+// apiOperations lists every /api route; versionedOperations adds their /api/v2 mirrors.
+// openapi_test.go fails when a route in setupRoutes is missing here.
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/api/health", Tag: "system", Summary: "Liveness check", Response: HealthResponse{}},
+	{Method: http.MethodGet, Path: "/api/health/ready", Tag: "system", Summary: "Readiness: probe SSH, FTP and file roots (cached)", Response: ReadinessResponse{}, Errors: ReadinessResponse{}},
+	{Method: http.MethodGet, Path: "/api/openapi.json", Tag: "system", Summary: "This OpenAPI document", Response: map[string]any{}, Unversioned: true},
+	{Method: http.MethodGet, Path: "/metrics", Tag: "system", Summary: "Prometheus metrics", Response: "", ContentType: "text/plain", Unversioned: true},
+
+	{Method: http.MethodPost, Path: "/api/ssh/exec", Tag: "ssh", Summary: "Execute a command", Request: SSHExecRequest{}, Response: SSHExecResponse{}, Errors: SSHExecResponse{}},
+	{Method: http.MethodGet, Path: "/api/ssh/exec", Tag: "ssh", Summary: "Execute a command (query string variant for PowerShell)",
+		Query: []apiParam{{Name: "cmd", Description: "Base64 encoded command", Required: true, Format: "byte"}}, Response: SSHExecResponse{}},
+	{Method: http.MethodPost, Path: "/api/ssh/exec/async", Tag: "ssh", Summary: "Start a command in the background", Request: SSHExecRequest{}, Status: http.StatusAccepted, Response: SSHExecAsyncResponse{}},
+	{Method: http.MethodGet, Path: "/api/ssh/task/:id", Tag: "ssh", Summary: "Get the status and result of an async task", Response: AsyncTask{}},
+	{Method: http.MethodPost, Path: "/api/ssh/forwards", Tag: "ssh", Summary: "Start a local, remote or dynamic (SOCKS5) port forward", Request: SSHForwardRequest{}, Status: http.StatusCreated, Response: ssh.Forward{}},
+	{Method: http.MethodGet, Path: "/api/ssh/forwards", Tag: "ssh", Summary: "List port forwards", Response: SSHForwardListResponse{}},
+	{Method: http.MethodDelete, Path: "/api/ssh/forwards/:id", Tag: "ssh", Summary: "Stop and remove a port forward", Response: StatusResponse{}},
+	{Method: http.MethodPost, Path: "/api/ssh/script", Tag: "ssh", Summary: "Run a bash script or a list of commands", Request: SSHScriptRequest{}, Response: SSHScriptResponse{}},
+
+	{Method: http.MethodPost, Path: "/api/ftp/list", Tag: "ftp", Summary: "List an FTP directory", Request: FTPListRequest{}, Response: FTPListResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/upload", Tag: "ftp", Summary: "Upload a file over FTP", Request: FTPUploadRequest{}, Response: FTPUploadResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/upload/stream", Tag: "ftp", Summary: "Stream a multipart file to FTP, optionally extracting archives", Form: FTPUploadStreamForm{}, Response: FTPUploadStreamResponse{}, Errors: FileUploadResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/download", Tag: "ftp", Summary: "Download a file over FTP", Request: FTPDownloadRequest{}, Response: FTPDownloadResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodGet, Path: "/api/ftp/transfer/:id", Tag: "ftp", Summary: "Get the progress of a resumable upload or download", Response: ftp.Transfer{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/mkdir", Tag: "ftp", Summary: "Create an FTP directory with parents", Request: FTPMkdirRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/delete", Tag: "ftp", Summary: "Delete an FTP file", Request: FTPDeleteRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/rmdir", Tag: "ftp", Summary: "Remove an FTP directory, optionally recursively", Request: FTPRmdirRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/rename", Tag: "ftp", Summary: "Move or rename an FTP file or directory", Request: FTPRenameRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/stat", Tag: "ftp", Summary: "Get size and modification time of an FTP path", Request: FTPStatRequest{}, Response: ftp.FileInfo{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/batch/delete", Tag: "ftp", Summary: "Delete several FTP files or directories", Request: FTPBatchDeleteRequest{}, Response: ftp.BatchDeleteResult{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/ftp/sync", Tag: "ftp", Summary: "Start mirroring a local directory to FTP or back", Request: FTPSyncRequest{}, Status: http.StatusAccepted, Response: FTPSyncResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodGet, Path: "/api/ftp/sync/:id", Tag: "ftp", Summary: "Get the progress of a sync", Response: ftp.SyncTask{}, Errors: FTPErrorResponse{}},
+
+	{Method: http.MethodPost, Path: "/api/sftp/list", Tag: "sftp", Summary: "List an SFTP directory", Request: SFTPPathRequest{}, Response: SFTPListResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/stat", Tag: "sftp", Summary: "Describe an SFTP path without following links", Request: SFTPPathRequest{}, Response: sftp.FileInfo{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/upload", Tag: "sftp", Summary: "Upload a file over SFTP", Request: SFTPUploadRequest{}, Response: SFTPUploadResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/download", Tag: "sftp", Summary: "Download a file over SFTP", Request: SFTPPathRequest{}, Response: SFTPDownloadResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/mkdir", Tag: "sftp", Summary: "Create an SFTP directory", Request: SFTPMkdirRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/rename", Tag: "sftp", Summary: "Move or rename an SFTP file or directory", Request: SFTPRenameRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/remove", Tag: "sftp", Summary: "Remove an SFTP file, link or directory", Request: SFTPRemoveRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/chmod", Tag: "sftp", Summary: "Change SFTP permissions", Request: SFTPChmodRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/symlink", Tag: "sftp", Summary: "Create an SFTP symbolic link", Request: SFTPSymlinkRequest{}, Response: StatusResponse{}, Errors: FTPErrorResponse{}},
+	{Method: http.MethodPost, Path: "/api/sftp/readlink", Tag: "sftp", Summary: "Read an SFTP link target", Request: SFTPPathRequest{}, Response: SFTPReadlinkResponse{}, Errors: FTPErrorResponse{}},
+
+	{Method: http.MethodPost, Path: "/api/file/upload", Tag: "file", Summary: "Upload a file, optionally extracting archives", Form: FileUploadForm{}, Response: FileUploadResponse{}, Errors: FileUploadResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/list", Tag: "file", Summary: "List a directory", Request: FileListRequest{}, Response: FileListResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/download", Tag: "file", Summary: "Download a file", Request: FileDownloadRequest{}, Response: FileDownloadResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/delete", Tag: "file", Summary: "Delete a file or directory", Request: FileDeleteRequest{}, Response: SuccessResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/mkdir", Tag: "file", Summary: "Create a directory with parents", Request: FileMkdirRequest{}, Response: FileMkdirResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/rename", Tag: "file", Summary: "Move or rename a file or directory", Request: FileRenameRequest{}, Response: FileMoveResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/copy", Tag: "file", Summary: "Copy a file or directory", Request: FileCopyRequest{}, Response: FileMoveResponse{}},
+	{Method: http.MethodPost, Path: "/api/file/info", Tag: "file", Summary: "Get file metadata", Request: FileInfoRequest{}, Response: file.DetailedFileInfo{}},
+	{Method: http.MethodPost, Path: "/api/file/batch/delete", Tag: "file", Summary: "Delete several files or directories", Request: FileBatchDeleteRequest{}, Response: file.BatchDeleteResult{}},
+}
+
+func init() {
+	// The tunnel accepts any of tunnelMethods and passes the body through untouched
+	for _, method := range tunnelMethods {
+		apiOperations = append(apiOperations, apiOperation{
+			Method: method, Path: "/api/ssh/tunnel/http/*path", Tag: "ssh",
+			Summary:  "Proxy an HTTP request to ssh_server.http_tunnel through an SSH channel",
+			Response: "", ContentType: "*/*",
+		})
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+// handleOpenAPI serves the OpenAPI 3 document describing the HTTP API
+func (s *Server) handleOpenAPI(c *gin.Context) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = buildOpenAPI(versionedOperations())
+	})
+	c.JSON(http.StatusOK, openAPIDoc)
+}
+
+// versionedOperations returns apiOperations followed by their /api/v2 copies,
+// which share the success types but always fail with ErrorEnvelope.
+func versionedOperations() []apiOperation {
+	ops := append([]apiOperation{}, apiOperations...)
+	for _, op := range apiOperations {
+		if op.Unversioned {
+			continue
+		}
+		op.Path = "/api/v2" + strings.TrimPrefix(op.Path, "/api")
+		op.Errors = ErrorEnvelope{}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+var ginParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// openAPIPath converts a gin route path to OpenAPI path template syntax
+func openAPIPath(path string) string {
+	return ginParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// buildOpenAPI renders ops as an OpenAPI 3.0 document
+func buildOpenAPI(ops []apiOperation) map[string]any {
+	g := &schemaGen{components: map[string]any{}, types: map[string]reflect.Type{}}
+	paths := map[string]any{}
+
+	for _, op := range ops {
+		operation := map[string]any{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+		}
+
+		var params []any
+		for _, m := range ginParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, q := range op.Query {
+			schema := map[string]any{"type": "string"}
+			if q.Format != "" {
+				schema["format"] = q.Format
+			}
+			params = append(params, map[string]any{
+				"name": q.Name, "in": "query", "required": q.Required, "description": q.Description, "schema": schema,
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		switch {
+		case op.Request != nil:
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": g.schemaFor(reflect.TypeOf(op.Request))}},
+			}
+		case op.Form != nil:
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"multipart/form-data": map[string]any{"schema": g.inlineStruct(reflect.TypeOf(op.Form), "form")}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		errBody := op.Errors
+		if errBody == nil {
+			errBody = ErrorResponse{}
+		}
+		errSchema := map[string]any{"application/json": map[string]any{"schema": g.schemaFor(reflect.TypeOf(errBody))}}
+		responses := map[string]any{
+			strconv.Itoa(status): map[string]any{
+				"description": http.StatusText(status),
+				"content":     map[string]any{contentType: map[string]any{"schema": g.schemaFor(reflect.TypeOf(op.Response))}},
+			},
+			"default": map[string]any{"description": "Error", "content": errSchema},
+		}
+		operation["responses"] = responses
+
+		p := openAPIPath(op.Path)
+		item, ok := paths[p].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[p] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "AI SSH/FTP Proxy API",
+			"version":     Version,
+			"description": "HTTP API for executing SSH commands and transferring files. Fields with format \"byte\" are Base64 encoded.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.components},
+	}
+}
+
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == '.' || r == ':' || r == '*' }) {
+		if part == "api" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaGen derives JSON schemas from Go types, collecting named structs as components
+type schemaGen struct {
+	components map[string]any
+	types      map[string]reflect.Type // component name -> Go type, to detect name clashes
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schemaFor(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.inlineStruct(t, "json")
+		}
+		if prev, ok := g.types[name]; ok && prev != t {
+			// Same type name in two packages (file.BatchDeleteResult, ftp.BatchDeleteResult)
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		g.types[name] = t
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = map[string]any{} // placeholder for recursive types
+			g.components[name] = g.inlineStruct(t, "json")
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]any{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Interface:
+		return map[string]any{}
+	}
+	return primitiveSchema(t)
+}
+
+func primitiveSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{"type": "string"}
+}
+
+// inlineStruct renders a struct as an object schema using the given tag (json or form) for field names.
+// Struct tags `format` and `enum` refine the field schema; `binding:"required"` marks it required.
+func (g *schemaGen) inlineStruct(t reflect.Type, tagKey string) map[string]any {
+	props := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get(tagKey), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := g.inlineStruct(f.Type, tagKey)
+			for k, v := range embedded["properties"].(map[string]any) {
+				props[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := g.schemaFor(f.Type)
+		if format := f.Tag.Get("format"); format != "" {
+			if schema["type"] == "array" {
+				schema = map[string]any{"type": "array", "items": map[string]any{"type": "string", "format": format}}
+			} else {
+				schema = map[string]any{"type": "string", "format": format}
+			}
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		props[name] = schema
+
+		if strings.Contains(f.Tag.Get("binding"), "required") && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPICoversAllRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewServer(Options{Config: &config.Config{}})
+
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json: status %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid OpenAPI JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi version = %q, want 3.x", doc.OpenAPI)
+	}
+
+	registered := map[string]bool{}
+	for _, r := range s.engine.Routes() {
+		key := r.Method + " " + openAPIPath(r.Path)
+		registered[key] = true
+		if _, ok := doc.Paths[openAPIPath(r.Path)][strings.ToLower(r.Method)]; !ok {
+			t.Errorf("route %s %s is registered in setupRoutes but missing from apiOperations", r.Method, r.Path)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("apiOperations documents %s %s but no such route is registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIComponentRefsResolve(t *testing.T) {
+	doc := buildOpenAPI(versionedOperations())
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	const prefix = `"$ref":"#/components/schemas/`
+	for rest := string(data); ; {
+		i := strings.Index(rest, prefix)
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len(prefix):]
+		name := rest[:strings.IndexByte(rest, '"')]
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("unresolved $ref to %q", name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"ssh-ftp-proxy/internal/config"
+)
+
+// Reload applies cfg to the running server: SSH and FTP targets and
+// credentials, the HTTP tunnel, health checks and redact patterns. Services
+// passed in Options follow only if they have an Update method. Connections
+// made with settings that changed are replaced. Listen addresses are not
+// reloadable.
+func (s *Server) Reload(cfg *config.Config) {
+	var sshChanged bool
+	if u, ok := s.sshService.(sshUpdater); ok {
+		sshChanged = u.Update(cfg.SSHServer)
+	}
+	if u, ok := s.ftpService.(ftpUpdater); ok {
+		u.Update(cfg.FTPServer)
+	}
+	if sshChanged {
+		// The SFTP session pins its connection; the next request opens a new one
+		s.sftpService.Close()
+	}
+
+	if err := s.redactor.Update(cfg.Redact.Patterns); err != nil {
+		s.log.Warnw("Invalid redact patterns, keeping the current ones", "error", err)
+	}
+
+	s.settingsMu.Lock()
+	tunnelChanged := s.tunnelTarget != cfg.SSHServer.HTTPTunnel
+	s.tunnelTarget, s.health = cfg.SSHServer.HTTPTunnel, cfg.Health
+	s.settingsMu.Unlock()
+	if sshChanged || tunnelChanged {
+		s.tunnelTransport.CloseIdleConnections()
+	}
+
+	// A cached probe may describe the old targets
+	s.ready.mu.Lock()
+	s.ready.last = nil
+	s.ready.mu.Unlock()
+}
+
+// Reload applies the SSH settings of cfg to the running server. Open shells
+// keep their connection until they exit.
+func (s *WSServer) Reload(cfg *config.Config) {
+	if u, ok := s.sshService.(sshUpdater); ok {
+		u.Update(cfg.SSHServer)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"ssh-ftp-proxy/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "request_id"
+
+// RequestIDMiddleware takes the caller's X-Request-ID, or generates one,
+// echoes it in the response and attaches a logger tagged with it to the
+// request context, which handlers pass on to the services
+func RequestIDMiddleware(log *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set(requestIDKey, id)
+		ctx := logger.NewContext(c.Request.Context(), log.With("request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// requestLog returns the logger of the request, tagged with its ID. Capture it
+// before handing work to a goroutine: c must not outlive the handler.
+func requestLog(c *gin.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	return logger.FromContext(c.Request.Context(), fallback)
+}
+
+// validRequestID accepts short IDs of printable ASCII, so a caller can't
+// inject newlines or huge values into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RequestIDMiddleware(zap.NewNop().Sugar()))
+	engine.GET("/", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(requestIDKey)) })
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("deploy-42")
+	if got := w.Header().Get(RequestIDHeader); got != "deploy-42" || w.Body.String() != "deploy-42" {
+		t.Errorf("caller ID: header %q, body %q, want deploy-42", got, w.Body.String())
+	}
+
+	for _, id := range []string{"", "two words", strings.Repeat("x", 129)} {
+		w := get(id)
+		got := w.Header().Get(RequestIDHeader)
+		if got == id || len(got) != 32 || w.Body.String() != got {
+			t.Errorf("ID %q: header %q, body %q, want a new 32-char ID", id, got, w.Body.String())
+		}
+	}
+}
+
+func TestRequestIDReachesServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	s := NewServer(Options{Config: &config.Config{}, Logger: zap.New(core).Sugar()})
+	defer s.Close()
+
+	dir := filepath.Join(t.TempDir(), "made")
+	body := `{"path": "` + base64.StdEncoding.EncodeToString([]byte(dir)) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/file/mkdir", strings.NewReader(body))
+	req.Header.Set(RequestIDHeader, "mkdir-1")
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("mkdir: status %d: %s", w.Code, w.Body)
+	}
+
+	// Logged by the file service, not the handler
+	created := logs.FilterMessageSnippet("Directory created").All()
+	if len(created) != 1 {
+		t.Fatalf("got %d service log entries, want 1", len(created))
+	}
+	if id := created[0].ContextMap()["request_id"]; id != "mkdir-1" {
+		t.Errorf("service log request_id = %v, want mkdir-1", id)
+	}
+}
+
+// shellSSH answers the WebSocket shell by returning right away
+type shellSSH struct{ SSHService }
+
+func (shellSSH) StartInteractiveWithContext(ctx context.Context, ws *websocket.Conn) error {
+	return nil
+}
+
+func TestRequestIDWebSocketUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewWSServer(Options{Config: &config.Config{}, SSH: shellSSH{}})
+	defer s.Close()
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/ssh"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{RequestIDHeader: {"shell-1"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+	if got := resp.Header.Get(RequestIDHeader); got != "shell-1" {
+		t.Errorf("upgrade response %s = %q, want shell-1", RequestIDHeader, got)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/redact"
+	"ssh-ftp-proxy/internal/service/file"
+	"ssh-ftp-proxy/internal/service/ftp"
+	"ssh-ftp-proxy/internal/service/sftp"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// SSHService is what the servers use of ssh.Service. SFTP runs over its
+// connections.
+type SSHService interface {
+	sftp.ClientProvider
+	Exec(ctx context.Context, cmd string) (stdout string, stderr string, exitCode int, err error)
+	StartInteractiveWithContext(ctx context.Context, ws *websocket.Conn) error
+	StartForward(ctx context.Context, opts ssh.ForwardOptions) (*ssh.Forward, error)
+	Forwards() []ssh.Forward
+	StopForward(id string) error
+	CloseForwards()
+	DialContext(ctx context.Context, addr string) (net.Conn, error)
+	Ping() error
+	PoolStats() ssh.PoolStats
+	Target() string
+}
+
+// FTPService is what the HTTP server uses of ftp.Service
+type FTPService interface {
+	List(p string, opts ftp.ListOptions) ([]ftp.Entry, error)
+	Stat(p string) (*ftp.FileInfo, error)
+	Mkdir(p string) error
+	Delete(p string) error
+	RemoveDir(p string, recursive bool) error
+	Rename(src, dst string) error
+	BatchDelete(paths []string) (*ftp.BatchDeleteResult, error)
+	UploadFrom(p string, r io.Reader, opts ftp.UploadOptions) (ftp.Transfer, error)
+	DownloadRange(p string, opts ftp.DownloadOptions) ([]byte, ftp.Transfer, error)
+	Transfer(id string) (ftp.Transfer, error)
+	ExtractArchive(ctx context.Context, name string, r io.Reader, destDir string) (ftp.ExtractResult, error)
+	StartSync(ctx context.Context, opts ftp.SyncOptions) (ftp.SyncTask, error)
+	SyncTask(id string) (ftp.SyncTask, error)
+	Ping() error
+	PoolStats() ftp.PoolStats
+	Target() string
+	Close()
+}
+
+// FileService is what the HTTP server uses of file.Service
+type FileService interface {
+	SaveFile(ctx context.Context, content io.Reader, destPath string) error
+	ExtractArchive(ctx context.Context, archivePath, destDir string) error
+	CheckWritable(dir string) error
+	ListDir(path string) ([]file.FileInfo, error)
+	Mkdir(ctx context.Context, path string) error
+	Rename(ctx context.Context, src, dst string) error
+	Copy(ctx context.Context, src, dst string) error
+	GetInfo(path string) (*file.DetailedFileInfo, error)
+	BatchDelete(ctx context.Context, paths []string) *file.BatchDeleteResult
+}
+
+// Services that follow config reloads implement these
+type (
+	sshUpdater interface {
+		Update(cfg config.SSHConfig) bool
+	}
+	ftpUpdater interface {
+		Update(cfg config.FTPConfig)
+	}
+)
+
+// Options are the dependencies of NewServer and NewWSServer. Services left
+// nil are created from Config.
+type Options struct {
+	Config *config.Config
+	Logger *zap.SugaredLogger // Default: discard
+
+	// Redactor masks secrets in task listings and, when created here, in
+	// Logger's output. A Redactor passed in should already wrap Logger.
+	// Default: one with Config.Redact.Patterns.
+	Redactor *redact.Redactor
+
+	// SSHManager holds the SSH connections, shared by servers created with
+	// the same one. Default: a new one per server, closed by its Close.
+	SSHManager *ssh.Manager
+
+	SSH  SSHService
+	FTP  FTPService
+	File FileService
+}
+
+// withDefaults fills in the logger, the redactor and, if needed, the SSH
+// manager. owned is set when the manager was created here.
+func (o Options) withDefaults() (opts Options, owned bool) {
+	if o.Logger == nil {
+		o.Logger = zap.NewNop().Sugar()
+	}
+	if o.Redactor == nil {
+		r, err := redact.New(o.Config.Redact.Patterns)
+		if err != nil {
+			// Config.Validate reports bad patterns; keep the built-ins
+			o.Logger.Warnw("Ignoring invalid redact patterns", "error", err)
+			r, _ = redact.New(nil)
+		}
+		o.Redactor = r
+		o.Logger = r.Logger(o.Logger)
+	}
+	if o.SSH == nil && o.SSHManager == nil {
+		o.SSHManager = ssh.NewManager(o.Logger)
+		owned = true
+	}
+	return o, owned
+}
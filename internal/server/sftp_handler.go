@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+
+	"ssh-ftp-proxy/internal/encoder"
+	"ssh-ftp-proxy/internal/service/sftp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SFTP handlers follow the FTP ones: paths and contents are Base64 encoded
+// and legacy errors use the {"error": "BASE64"} shape.
+
+// decodeSFTPField decodes one Base64 request field, failing the request if it is invalid
+func (s *Server) decodeSFTPField(c *gin.Context, name, value string) (string, bool) {
+	decoded, err := encoder.Decode(value)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 %s: %v", name, err), legacyFTP)
+		return "", false
+	}
+	return decoded, true
+}
+
+// bindSFTP binds the JSON body, failing the request if it is invalid
+func (s *Server) bindSFTP(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid request: %v", err), legacyFTP)
+		return false
+	}
+	return true
+}
+
+type SFTPPathRequest struct {
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+}
+
+type SFTPListResponse struct {
+	Entries []sftp.FileInfo `json:"entries"`
+}
+
+func (s *Server) handleSFTPList(c *gin.Context) {
+	var req SFTPPathRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	entries, err := s.sftpService.List(path)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+	if entries == nil {
+		entries = []sftp.FileInfo{}
+	}
+
+	c.JSON(http.StatusOK, SFTPListResponse{Entries: entries})
+}
+
+// handleSFTPStat describes a path without following links
+func (s *Server) handleSFTPStat(c *gin.Context) {
+	var req SFTPPathRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	info, err := s.sftpService.Stat(path)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+type SFTPUploadRequest struct {
+	Path    string `json:"path" binding:"required" format:"byte"`    // Base64 encoded
+	Content string `json:"content" binding:"required" format:"byte"` // Base64 encoded
+	Mode    string `json:"mode"`                                     // Octal permissions applied after writing, e.g. "0644"
+}
+
+type SFTPUploadResponse struct {
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+}
+
+func (s *Server) handleSFTPUpload(c *gin.Context) {
+	var req SFTPUploadRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	// Manually decode content because it might be binary
+	content, err := encoder.DecodeBytes(req.Content)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid base64 content: %v", err), legacyFTP)
+		return
+	}
+
+	var mode os.FileMode
+	if req.Mode != "" {
+		if mode, err = sftp.ParseMode(req.Mode); err != nil {
+			s.fail(c, http.StatusBadRequest, invalidRequest("%v", err), legacyFTP)
+			return
+		}
+	}
+
+	n, err := s.sftpService.Upload(c.Request.Context(), path, bytes.NewReader(content), mode)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, SFTPUploadResponse{Status: "ok", Size: n})
+}
+
+type SFTPDownloadResponse struct {
+	Content string `json:"content" format:"byte"` // Base64 encoded
+}
+
+func (s *Server) handleSFTPDownload(c *gin.Context) {
+	var req SFTPPathRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	content, err := s.sftpService.Download(path)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, SFTPDownloadResponse{Content: encoder.EncodeBytes(content)})
+}
+
+type SFTPMkdirRequest struct {
+	Path    string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Parents bool   `json:"parents"`                               // Create missing parents, no error if it exists
+}
+
+func (s *Server) handleSFTPMkdir(c *gin.Context) {
+	var req SFTPMkdirRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	if err := s.sftpService.Mkdir(path, req.Parents); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type SFTPRenameRequest struct {
+	Src string `json:"src" binding:"required" format:"byte"` // Base64 encoded
+	Dst string `json:"dst" binding:"required" format:"byte"` // Base64 encoded
+}
+
+// handleSFTPRename moves src to dst, replacing dst where the server allows it
+func (s *Server) handleSFTPRename(c *gin.Context) {
+	var req SFTPRenameRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	src, ok := s.decodeSFTPField(c, "src", req.Src)
+	if !ok {
+		return
+	}
+	dst, ok := s.decodeSFTPField(c, "dst", req.Dst)
+	if !ok {
+		return
+	}
+
+	if err := s.sftpService.Rename(src, dst); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type SFTPRemoveRequest struct {
+	Path      string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Recursive bool   `json:"recursive"`                             // Remove directory contents too
+}
+
+func (s *Server) handleSFTPRemove(c *gin.Context) {
+	var req SFTPRemoveRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	if err := s.sftpService.Remove(path, req.Recursive); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type SFTPChmodRequest struct {
+	Path string `json:"path" binding:"required" format:"byte"` // Base64 encoded
+	Mode string `json:"mode" binding:"required"`               // Octal permissions, e.g. "0755" or "4755"
+}
+
+func (s *Server) handleSFTPChmod(c *gin.Context) {
+	var req SFTPChmodRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+	mode, err := sftp.ParseMode(req.Mode)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("%v", err), legacyFTP)
+		return
+	}
+
+	if err := s.sftpService.Chmod(path, mode); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type SFTPSymlinkRequest struct {
+	Target string `json:"target" binding:"required" format:"byte"` // Base64 encoded; stored as given, may be relative
+	Link   string `json:"link" binding:"required" format:"byte"`   // Base64 encoded
+}
+
+func (s *Server) handleSFTPSymlink(c *gin.Context) {
+	var req SFTPSymlinkRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	target, ok := s.decodeSFTPField(c, "target", req.Target)
+	if !ok {
+		return
+	}
+	link, ok := s.decodeSFTPField(c, "link", req.Link)
+	if !ok {
+		return
+	}
+
+	if err := s.sftpService.Symlink(target, link); err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+type SFTPReadlinkResponse struct {
+	Target string `json:"target" format:"byte"` // Base64 encoded
+}
+
+func (s *Server) handleSFTPReadlink(c *gin.Context) {
+	var req SFTPPathRequest
+	if !s.bindSFTP(c, &req) {
+		return
+	}
+	path, ok := s.decodeSFTPField(c, "path", req.Path)
+	if !ok {
+		return
+	}
+
+	target, err := s.sftpService.Readlink(path)
+	if err != nil {
+		s.fail(c, http.StatusInternalServerError, err, legacyFTP)
+		return
+	}
+
+	c.JSON(http.StatusOK, SFTPReadlinkResponse{Target: encoder.Encode(target)})
+}
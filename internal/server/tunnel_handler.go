@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tunnelMethods are the methods /api/ssh/tunnel/http/*path passes through
+var tunnelMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// tunnelPrefix precedes the proxied path in both /api and /api/v2 URLs
+const tunnelPrefix = "/ssh/tunnel/http"
+
+// newTunnelTransport dials every request through an SSH channel to the
+// target-side address. Idle connections are kept, each holding one channel.
+func (s *Server) newTunnelTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return s.sshService.DialContext(ctx, addr)
+		},
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+		// Bodies pass through with their original encoding
+		DisableCompression: true,
+	}
+}
+
+// handleSSHTunnelHTTP reverse-proxies the request to ssh_server.http_tunnel,
+// a host:port reached from the target, keeping method, headers and query and
+// streaming both bodies
+func (s *Server) handleSSHTunnelHTTP(c *gin.Context) {
+	s.settingsMu.RLock()
+	tunnelTarget := s.tunnelTarget
+	s.settingsMu.RUnlock()
+	if tunnelTarget == "" {
+		s.fail(c, http.StatusNotFound, newAPIError(CodeUnsupported, "HTTP tunnel is not configured (ssh_server.http_tunnel)"), legacyPlain)
+		return
+	}
+
+	// Keep the client's escaping, which c.Param("path") has already undone
+	escaped := c.Request.URL.EscapedPath()
+	_, rest, _ := strings.Cut(escaped, tunnelPrefix)
+	target, err := url.Parse(rest)
+	if err != nil {
+		s.fail(c, http.StatusBadRequest, invalidRequest("Invalid path: %v", err), legacyPlain)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: tunnelTarget})
+			pr.Out.URL.Path, pr.Out.URL.RawPath = target.Path, target.RawPath
+			pr.SetXForwarded()
+		},
+		Transport:     s.tunnelTransport,
+		FlushInterval: -1, // Stream responses such as server-sent events as they arrive
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.fail(c, http.StatusBadGateway, err, legacyPlain)
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
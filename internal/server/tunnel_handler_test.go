@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tunnelSSH connects every tunnel dial to backend, recording the address
+// asked for; with backend empty the dial fails like ssh.Service's
+type tunnelSSH struct {
+	SSHService
+	backend string
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (t *tunnelSSH) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	t.mu.Lock()
+	t.dialed = append(t.dialed, addr)
+	t.mu.Unlock()
+	if t.backend == "" {
+		return nil, fmt.Errorf("%w: %s: %w", ssh.ErrTunnel, addr, errors.New("ssh: rejected: connect failed (Connection refused)"))
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", t.backend)
+}
+
+func (t *tunnelSSH) CloseForwards() {}
+
+// tunnelEcho is what the backend reports about the request it received
+type tunnelEcho struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"` // Escaped
+	Query     string `json:"query"`
+	Body      string `json:"body"`
+	Forwarded string `json:"forwarded"`
+}
+
+func TestSSHTunnelHTTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(tunnelEcho{
+			Method:    r.Method,
+			Path:      r.URL.EscapedPath(),
+			Query:     r.URL.RawQuery,
+			Body:      string(body),
+			Forwarded: r.Header.Get("X-Forwarded-Host"),
+		})
+	}))
+	defer backend.Close()
+
+	// ReverseProxy needs a real connection (CloseNotifier), not a recorder
+	newServer := func(t *testing.T, tunnel string, sshSvc *tunnelSSH) *httptest.Server {
+		s := NewServer(Options{Config: &config.Config{SSHServer: config.SSHConfig{HTTPTunnel: tunnel}}, SSH: sshSvc})
+		t.Cleanup(s.Close)
+		front := httptest.NewServer(s.Handler())
+		t.Cleanup(front.Close)
+		return front
+	}
+	type response struct {
+		Code int
+		Body []byte
+	}
+	serve := func(front *httptest.Server, method, target, body string) response {
+		t.Helper()
+		req, err := http.NewRequest(method, front.URL+target, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := front.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return response{resp.StatusCode, data}
+	}
+
+	t.Run("proxied", func(t *testing.T) {
+		sshSvc := &tunnelSSH{backend: backend.Listener.Addr().String()}
+		s := newServer(t, "app.internal:8080", sshSvc)
+
+		tests := []struct {
+			method, target, body string
+			want                 tunnelEcho
+		}{
+			{
+				method: http.MethodGet,
+				target: "/api/ssh/tunnel/http/status",
+				want:   tunnelEcho{Method: http.MethodGet, Path: "/status"},
+			},
+			{
+				// Escaping survives: %2F must not become a path separator
+				method: http.MethodGet,
+				target: "/api/ssh/tunnel/http/files/a%2Fb/c%20d?page=2&q=x%2By",
+				want:   tunnelEcho{Method: http.MethodGet, Path: "/files/a%2Fb/c%20d", Query: "page=2&q=x%2By"},
+			},
+			{
+				method: http.MethodPost,
+				target: "/api/v2/ssh/tunnel/http/api/items?dry_run=1",
+				body:   `{"name": "x"}`,
+				want:   tunnelEcho{Method: http.MethodPost, Path: "/api/items", Query: "dry_run=1", Body: `{"name": "x"}`},
+			},
+		}
+		for _, tt := range tests {
+			w := serve(s, tt.method, tt.target, tt.body)
+			if w.Code != http.StatusOK {
+				t.Errorf("%s %s: status %d: %s", tt.method, tt.target, w.Code, w.Body)
+				continue
+			}
+			var got tunnelEcho
+			if err := json.Unmarshal(w.Body, &got); err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Forwarded = strings.TrimPrefix(s.URL, "http://")
+			if got != tt.want {
+				t.Errorf("%s %s reached the backend as %+v, want %+v", tt.method, tt.target, got, tt.want)
+			}
+		}
+
+		sshSvc.mu.Lock()
+		defer sshSvc.mu.Unlock()
+		for _, addr := range sshSvc.dialed {
+			if addr != "app.internal:8080" {
+				t.Errorf("dialed %s through ssh, want app.internal:8080", addr)
+			}
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		s := newServer(t, "", &tunnelSSH{})
+		if w := serve(s, http.MethodGet, "/api/ssh/tunnel/http/status", ""); w.Code != http.StatusNotFound {
+			t.Errorf("legacy: status %d, want 404", w.Code)
+		}
+		w := serve(s, http.MethodGet, "/api/v2/ssh/tunnel/http/status", "")
+		var resp ErrorEnvelope
+		if err := json.Unmarshal(w.Body, &resp); err != nil || resp.Error == nil {
+			t.Fatalf("v2: status %d: %s, want an error envelope", w.Code, w.Body)
+		}
+		if w.Code != http.StatusBadRequest || resp.Error.Code != CodeUnsupported {
+			t.Errorf("v2: status %d, code %s, want %s", w.Code, resp.Error.Code, CodeUnsupported)
+		}
+	})
+
+	t.Run("dial failure", func(t *testing.T) {
+		s := newServer(t, "app.internal:8080", &tunnelSSH{})
+		w := serve(s, http.MethodGet, "/api/ssh/tunnel/http/status", "")
+		if w.Code != http.StatusBadGateway || !strings.Contains(string(w.Body), "Connection refused") {
+			t.Errorf("legacy: status %d: %s, want 502 with the dial error", w.Code, w.Body)
+		}
+		w = serve(s, http.MethodGet, "/api/v2/ssh/tunnel/http/status", "")
+		var resp ErrorEnvelope
+		if err := json.Unmarshal(w.Body, &resp); err != nil || resp.Error == nil {
+			t.Fatalf("v2: status %d: %s, want an error envelope", w.Code, w.Body)
+		}
+		if w.Code != http.StatusBadGateway || resp.Error.Code != CodeUpstreamError {
+			t.Errorf("v2: status %d, code %s, want 502 %s", w.Code, resp.Error.Code, CodeUpstreamError)
+		}
+	})
+}
@@ -4,18 +4,21 @@ import (
 	"fmt"
 	"net/http"
 
-	"ssh-ftp-proxy/internal/config"
 	"ssh-ftp-proxy/internal/encoder"
-	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/metrics"
 	"ssh-ftp-proxy/internal/service/ssh"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
 )
 
 type WSServer struct {
 	engine     *gin.Engine
-	sshService *ssh.Service
+	log        *zap.SugaredLogger
+	addr       string
+	sshManager *ssh.Manager // Set when the server owns it
+	sshService SSHService
 }
 
 var upgrader = websocket.Upgrader{
@@ -24,40 +27,73 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func NewWSServer() *WSServer {
+// NewWSServer creates the WebSocket shell server from opts. Only opts.SSH
+// is used of the services.
+func NewWSServer(opts Options) *WSServer {
+	opts, owned := opts.withDefaults()
+	cfg := opts.Config
+
 	engine := gin.New()
 	engine.Use(gin.Recovery())
-	engine.Use(LoggerMiddleware())
+	engine.Use(MetricsMiddleware())
+	engine.Use(RequestIDMiddleware(opts.Logger))
+	engine.Use(LoggerMiddleware(opts.Logger))
 
 	s := &WSServer{
 		engine:     engine,
-		sshService: ssh.NewService(config.GlobalConfig.SSHServer),
+		log:        opts.Logger,
+		addr:       fmt.Sprintf("%s:%d", cfg.Server.BindIP, cfg.Server.WSPort),
+		sshService: opts.SSH,
+	}
+	if owned {
+		s.sshManager = opts.SSHManager
+	}
+	if s.sshService == nil {
+		s.sshService = ssh.NewService(cfg.SSHServer, opts.SSHManager)
 	}
 
 	s.setupRoutes()
 	return s
 }
 
+// Handler returns the WebSocket handler, for serving it from an existing
+// http.Server instead of Run
+func (s *WSServer) Handler() http.Handler {
+	return s.engine
+}
+
+// Close closes the SSH connections if the server created their ssh.Manager
+func (s *WSServer) Close() {
+	if s.sshManager != nil {
+		s.sshManager.Close()
+	}
+}
+
 func (s *WSServer) setupRoutes() {
 	s.engine.GET("/ws/ssh", s.handleSSHInteractive)
 }
 
-func (s *WSServer) Run() error {
-	addr := fmt.Sprintf("%s:%d", config.GlobalConfig.Server.BindIP, config.GlobalConfig.Server.WSPort)
-	logger.Log.Info("Starting WebSocket Server", "addr", addr)
-	return s.engine.Run(addr)
+// Addr is the listen address from server.bind_ip and server.ws_port
+func (s *WSServer) Addr() string {
+	return s.addr
 }
 
 func (s *WSServer) handleSSHInteractive(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// The upgrade response is written by the upgrader, not from c.Writer's
+	// headers, so the request ID has to be passed along
+	header := http.Header{RequestIDHeader: {c.GetString(requestIDKey)}}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, header)
 	if err != nil {
-		logger.Log.Error("Failed to upgrade websocket", "error", err)
+		requestLog(c, s.log).Errorw("Failed to upgrade websocket", "error", err)
 		return
 	}
 	defer conn.Close()
 
-	if err := s.sshService.StartInteractive(conn); err != nil {
-		logger.Log.Error("SSH Interactive session failed", "error", err)
+	metrics.WSSessions.Inc()
+	defer metrics.WSSessions.Dec()
+
+	if err := s.sshService.StartInteractiveWithContext(c.Request.Context(), conn); err != nil {
+		requestLog(c, s.log).Errorw("SSH Interactive session failed", "error", err)
 		conn.WriteJSON(gin.H{"type": "error", "payload": encoder.Encode(err.Error())})
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,18 +13,34 @@ import (
 	"strings"
 
 	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/metrics"
+
+	"go.uber.org/zap"
 )
 
+// ErrUnsafePath is returned when an archive entry would be written outside the extraction directory
+var ErrUnsafePath = errors.New("invalid file path")
+
+// ErrUnsupportedArchive is returned by ExtractArchive for unknown archive formats
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
 // Service handles file operations via SSH
-type Service struct{}
+type Service struct {
+	log *zap.SugaredLogger
+}
 
 // NewService creates a new file service
-func NewService() *Service {
-	return &Service{}
+func NewService(log *zap.SugaredLogger) *Service {
+	return &Service{log: log}
+}
+
+// logger returns the logger carried by ctx, falling back to the service's
+func (s *Service) logger(ctx context.Context) *zap.SugaredLogger {
+	return logger.FromContext(ctx, s.log)
 }
 
 // SaveFile saves uploaded file to the specified path
-func (s *Service) SaveFile(content io.Reader, destPath string) error {
+func (s *Service) SaveFile(ctx context.Context, content io.Reader, destPath string) error {
 	// Ensure directory exists
 	dir := filepath.Dir(destPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -41,29 +59,32 @@ func (s *Service) SaveFile(content io.Reader, destPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+	metrics.FileBytes.WithLabelValues("upload").Add(float64(written))
 
-	logger.Log.Info("File saved", "path", destPath, "size", written)
+	s.logger(ctx).Infow("File saved", "path", destPath, "size", written)
 	return nil
 }
 
 // ExtractArchive extracts tar.gz or zip files to destination directory
-func (s *Service) ExtractArchive(archivePath, destDir string) error {
+func (s *Service) ExtractArchive(ctx context.Context, archivePath, destDir string) error {
+	log := s.logger(ctx)
+
 	// Detect archive type
 	ext := strings.ToLower(filepath.Ext(archivePath))
 
 	switch {
 	case strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz"):
-		return s.extractTarGz(archivePath, destDir)
+		return extractTarGz(log, archivePath, destDir)
 	case ext == ".zip":
-		return s.extractZip(archivePath, destDir)
+		return extractZip(log, archivePath, destDir)
 	case ext == ".tar":
-		return s.extractTar(archivePath, destDir)
+		return extractTar(log, archivePath, destDir)
 	default:
-		return fmt.Errorf("unsupported archive format: %s", ext)
+		return fmt.Errorf("%w: %s", ErrUnsupportedArchive, ext)
 	}
 }
 
-func (s *Service) extractTarGz(archivePath, destDir string) error {
+func extractTarGz(log *zap.SugaredLogger, archivePath, destDir string) error {
 	file, err := os.Open(archivePath)
 	if err != nil {
 		return err
@@ -76,20 +97,20 @@ func (s *Service) extractTarGz(archivePath, destDir string) error {
 	}
 	defer gzr.Close()
 
-	return s.extractTarReader(tar.NewReader(gzr), destDir)
+	return extractTarReader(log, tar.NewReader(gzr), destDir)
 }
 
-func (s *Service) extractTar(archivePath, destDir string) error {
+func extractTar(log *zap.SugaredLogger, archivePath, destDir string) error {
 	file, err := os.Open(archivePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	return s.extractTarReader(tar.NewReader(file), destDir)
+	return extractTarReader(log, tar.NewReader(file), destDir)
 }
 
-func (s *Service) extractTarReader(tr *tar.Reader, destDir string) error {
+func extractTarReader(log *zap.SugaredLogger, tr *tar.Reader, destDir string) error {
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -103,7 +124,7 @@ func (s *Service) extractTarReader(tr *tar.Reader, destDir string) error {
 
 		// Security: prevent path traversal
 		if !strings.HasPrefix(filepath.Clean(target), filepath.Clean(destDir)) {
-			return fmt.Errorf("invalid file path: %s", header.Name)
+			return fmt.Errorf("%w: %s", ErrUnsafePath, header.Name)
 		}
 
 		switch header.Typeflag {
@@ -127,11 +148,11 @@ func (s *Service) extractTarReader(tr *tar.Reader, destDir string) error {
 		}
 	}
 
-	logger.Log.Info("Archive extracted", "path", destDir)
+	log.Infow("Archive extracted", "path", destDir)
 	return nil
 }
 
-func (s *Service) extractZip(archivePath, destDir string) error {
+func extractZip(log *zap.SugaredLogger, archivePath, destDir string) error {
 	r, err := zip.OpenReader(archivePath)
 	if err != nil {
 		return err
@@ -143,7 +164,7 @@ func (s *Service) extractZip(archivePath, destDir string) error {
 
 		// Security: prevent path traversal
 		if !strings.HasPrefix(filepath.Clean(target), filepath.Clean(destDir)) {
-			return fmt.Errorf("invalid file path: %s", f.Name)
+			return fmt.Errorf("%w: %s", ErrUnsafePath, f.Name)
 		}
 
 		if f.FileInfo().IsDir() {
@@ -174,10 +195,21 @@ func (s *Service) extractZip(archivePath, destDir string) error {
 		}
 	}
 
-	logger.Log.Info("Zip extracted", "path", destDir)
+	log.Infow("Zip extracted", "path", destDir)
 	return nil
 }
 
+// CheckWritable verifies that a file can be created in dir
+func (s *Service) CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ssh-ftp-proxy-health-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
 // DeleteFile removes a file
 func (s *Service) DeleteFile(path string) error {
 	return os.Remove(path)
@@ -225,16 +257,16 @@ type DetailedFileInfo struct {
 }
 
 // Mkdir creates a directory (with parents if needed)
-func (s *Service) Mkdir(path string) error {
+func (s *Service) Mkdir(ctx context.Context, path string) error {
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
-	logger.Log.Info("Directory created", "path", path)
+	s.logger(ctx).Infow("Directory created", "path", path)
 	return nil
 }
 
 // Rename moves/renames a file or directory
-func (s *Service) Rename(src, dst string) error {
+func (s *Service) Rename(ctx context.Context, src, dst string) error {
 	// Ensure destination directory exists
 	dstDir := filepath.Dir(dst)
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
@@ -244,24 +276,25 @@ func (s *Service) Rename(src, dst string) error {
 	if err := os.Rename(src, dst); err != nil {
 		return fmt.Errorf("failed to rename: %w", err)
 	}
-	logger.Log.Info("File renamed", "src", src, "dst", dst)
+	s.logger(ctx).Infow("File renamed", "src", src, "dst", dst)
 	return nil
 }
 
 // Copy copies a file or directory
-func (s *Service) Copy(src, dst string) error {
+func (s *Service) Copy(ctx context.Context, src, dst string) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("source not found: %w", err)
 	}
 
+	log := s.logger(ctx)
 	if srcInfo.IsDir() {
-		return s.copyDir(src, dst)
+		return copyDir(log, src, dst)
 	}
-	return s.copyFile(src, dst)
+	return copyFile(log, src, dst)
 }
 
-func (s *Service) copyFile(src, dst string) error {
+func copyFile(log *zap.SugaredLogger, src, dst string) error {
 	// Ensure destination directory exists
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
@@ -287,11 +320,11 @@ func (s *Service) copyFile(src, dst string) error {
 	srcInfo, _ := os.Stat(src)
 	os.Chmod(dst, srcInfo.Mode())
 
-	logger.Log.Info("File copied", "src", src, "dst", dst)
+	log.Infow("File copied", "src", src, "dst", dst)
 	return nil
 }
 
-func (s *Service) copyDir(src, dst string) error {
+func copyDir(log *zap.SugaredLogger, src, dst string) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -311,17 +344,17 @@ func (s *Service) copyDir(src, dst string) error {
 		dstPath := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
-			if err := s.copyDir(srcPath, dstPath); err != nil {
+			if err := copyDir(log, srcPath, dstPath); err != nil {
 				return err
 			}
 		} else {
-			if err := s.copyFile(srcPath, dstPath); err != nil {
+			if err := copyFile(log, srcPath, dstPath); err != nil {
 				return err
 			}
 		}
 	}
 
-	logger.Log.Info("Directory copied", "src", src, "dst", dst)
+	log.Infow("Directory copied", "src", src, "dst", dst)
 	return nil
 }
 
@@ -347,7 +380,7 @@ func (s *Service) DeleteDir(path string) error {
 	if err := os.RemoveAll(path); err != nil {
 		return fmt.Errorf("failed to delete directory: %w", err)
 	}
-	logger.Log.Info("Directory deleted", "path", path)
+	s.log.Infow("Directory deleted", "path", path)
 	return nil
 }
 
@@ -364,7 +397,7 @@ type BatchDeleteError struct {
 }
 
 // BatchDelete deletes multiple files/directories
-func (s *Service) BatchDelete(paths []string) *BatchDeleteResult {
+func (s *Service) BatchDelete(ctx context.Context, paths []string) *BatchDeleteResult {
 	result := &BatchDeleteResult{
 		Success: []string{},
 		Failed:  []BatchDeleteError{},
@@ -390,6 +423,6 @@ func (s *Service) BatchDelete(paths []string) *BatchDeleteResult {
 		}
 	}
 
-	logger.Log.Info("Batch delete completed", "success", len(result.Success), "failed", len(result.Failed))
+	s.logger(ctx).Infow("Batch delete completed", "success", len(result.Success), "failed", len(result.Failed))
 	return result
 }
@@ -0,0 +1,186 @@
+package ftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"ssh-ftp-proxy/internal/metrics"
+)
+
+var (
+	// ErrUnsafePath is matched by archive entries that would land outside the target directory
+	ErrUnsafePath = errors.New("invalid file path")
+	// ErrUnsupportedArchive is matched when the archive format is not recognised
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+)
+
+// ExtractResult summarises an archive extracted onto the FTP server
+type ExtractResult struct {
+	Files int   `json:"files"` // Regular files written
+	Bytes int64 `json:"bytes"` // Archive bytes read from the client
+}
+
+// ExtractArchive extracts a .tar.gz/.tgz/.tar/.zip stream (format chosen by
+// name) into destDir on the FTP server. Tar archives are extracted while they
+// arrive; zip needs its trailing central directory, so it is spooled to a
+// temporary file first. Nothing is held in memory.
+func (s *Service) ExtractArchive(ctx context.Context, name string, r io.Reader, destDir string) (ExtractResult, error) {
+	var result ExtractResult
+	lower := strings.ToLower(name)
+	isTarGz := strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+	if !isTarGz && !strings.HasSuffix(lower, ".tar") && !strings.HasSuffix(lower, ".zip") {
+		return result, fmt.Errorf("%w: %s", ErrUnsupportedArchive, path.Ext(lower))
+	}
+
+	counted := &progressReader{r: r, progress: func(int64) {}}
+	destDir = path.Clean(destDir)
+	err := s.withConn(func(c *conn) error {
+		x := &ftpExtractor{c: c, destDir: destDir, made: map[string]bool{}, result: &result}
+		if err := x.mkdir(destDir); err != nil {
+			return err
+		}
+
+		switch {
+		case isTarGz:
+			gzr, err := gzip.NewReader(counted)
+			if err != nil {
+				return err
+			}
+			defer gzr.Close()
+			return x.tar(tar.NewReader(gzr))
+		case strings.HasSuffix(lower, ".tar"):
+			return x.tar(tar.NewReader(counted))
+		default:
+			return x.zip(counted)
+		}
+	})
+	result.Bytes = counted.n
+	metrics.FTPBytes.WithLabelValues("upload").Add(float64(counted.n))
+	if err != nil {
+		return result, err
+	}
+
+	s.logger(ctx).Infow("Archive extracted to ftp", "path", destDir, "files", result.Files)
+	return result, nil
+}
+
+type ftpExtractor struct {
+	c       *conn
+	destDir string
+	made    map[string]bool // directories known to exist
+	result  *ExtractResult
+}
+
+// target resolves an entry name inside destDir, rejecting path traversal and
+// absolute names
+func (x *ftpExtractor) target(name string) (string, error) {
+	target := path.Join(x.destDir, name)
+	if path.IsAbs(name) || target != x.destDir && !strings.HasPrefix(target, strings.TrimSuffix(x.destDir, "/")+"/") {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return target, nil
+}
+
+func (x *ftpExtractor) mkdir(dir string) error {
+	if x.made[dir] {
+		return nil
+	}
+	if err := mkdirAll(x.c, dir); err != nil {
+		return fmt.Errorf("mkdir failed: %w", err)
+	}
+	// mkdirAll created every parent too
+	x.made[dir] = true
+	for d := path.Dir(dir); !x.made[d] && d != "/" && d != "."; d = path.Dir(d) {
+		x.made[d] = true
+	}
+	return nil
+}
+
+func (x *ftpExtractor) store(target string, r io.Reader) error {
+	if err := x.mkdir(path.Dir(target)); err != nil {
+		return err
+	}
+	if err := x.c.Stor(target, r); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	x.result.Files++
+	return nil
+}
+
+func (x *ftpExtractor) tar(tr *tar.Reader) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := x.target(header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(target)
+		case tar.TypeReg:
+			err = x.store(target, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *ftpExtractor) zip(r io.Reader) error {
+	spool, err := os.CreateTemp("", "ssh-ftp-proxy-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(spool, size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		target, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := x.mkdir(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = x.store(target, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package ftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// archiveEntry is a file, or a directory when its name ends in /
+type archiveEntry struct{ name, content string }
+
+func tarGz(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.name[len(e.name)-1] == '/' {
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{"site/", ""},
+		{"site/index.html", "<h1>hi</h1>"},
+		{"site/assets/app.js", "run()"},
+		{"empty/", ""},
+	}
+	for name, archive := range map[string][]byte{
+		"site.tar.gz": tarGz(t, entries...),
+		"site.zip":    zipArchive(t, entries...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv, cfg := serveMemFTP(t)
+			svc := NewService(cfg, zap.NewNop().Sugar())
+			defer svc.Close()
+
+			result, err := svc.ExtractArchive(context.Background(), name, bytes.NewReader(archive), "/www/")
+			if err != nil {
+				t.Fatalf("ExtractArchive: %v", err)
+			}
+			if result.Files != 2 || result.Bytes != int64(len(archive)) {
+				t.Errorf("result = %+v, want 2 files and %d bytes", result, len(archive))
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			want := map[string]string{"/www/site/index.html": "<h1>hi</h1>", "/www/site/assets/app.js": "run()"}
+			if !maps.Equal(srv.files, want) {
+				t.Errorf("files = %v, want %v", srv.files, want)
+			}
+			dirs := slices.Sorted(maps.Keys(srv.dirs))
+			if want := []string{"/", "/www", "/www/empty", "/www/site", "/www/site/assets"}; !slices.Equal(dirs, want) {
+				t.Errorf("dirs = %v, want %v", dirs, want)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveUnsafePath(t *testing.T) {
+	srv, cfg := serveMemFTP(t)
+	svc := NewService(cfg, zap.NewNop().Sugar())
+	defer svc.Close()
+
+	for _, name := range []string{"../x", "site/../../x", "/etc/cron.d/job"} {
+		for archiveName, archive := range map[string][]byte{
+			"evil.tgz": tarGz(t, archiveEntry{"ok.txt", "ok"}, archiveEntry{name, "pwned"}),
+			"evil.zip": zipArchive(t, archiveEntry{"ok.txt", "ok"}, archiveEntry{name, "pwned"}),
+		} {
+			_, err := svc.ExtractArchive(context.Background(), archiveName, bytes.NewReader(archive), "/www")
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("%s with entry %q: %v, want %v", archiveName, name, err, ErrUnsafePath)
+			}
+		}
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for p, content := range srv.files {
+		if p != "/www/ok.txt" {
+			t.Errorf("extraction wrote %s (%q) outside /www", p, content)
+		}
+	}
+
+	if _, err := svc.ExtractArchive(context.Background(), "site.rar", bytes.NewReader(nil), "/www"); !errors.Is(err, ErrUnsupportedArchive) {
+		t.Errorf("rar archive: %v, want %v", err, ErrUnsupportedArchive)
+	}
+}
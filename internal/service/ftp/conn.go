@@ -0,0 +1,480 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"golang.org/x/text/encoding"
+)
+
+// conn is a logged-in FTP connection together with the dialer that owns its
+// sockets. Paths go through the configured filename encoding: the methods
+// below shadow the ftp.ServerConn ones that take or return names.
+type conn struct {
+	*ftp.ServerConn
+	dialer  *connDialer
+	charset encoding.Encoding // nil for UTF-8
+}
+
+// encode converts a path to the server's filename encoding. A name the
+// encoding cannot represent is refused like the server would (553), so the
+// connection stays usable.
+func (c *conn) encode(p string) (string, error) {
+	if c.charset == nil {
+		return p, nil
+	}
+	s, err := c.charset.NewEncoder().String(p)
+	if err != nil {
+		return "", &textproto.Error{Code: ftp.StatusBadFileName, Msg: fmt.Sprintf("%s: not representable in the server encoding", p)}
+	}
+	return s, nil
+}
+
+func (c *conn) decode(s string) string {
+	if c.charset == nil {
+		return s
+	}
+	if d, err := c.charset.NewDecoder().String(s); err == nil {
+		return d
+	}
+	return s
+}
+
+func (c *conn) List(p string) ([]*ftp.Entry, error) {
+	p, err := c.encode(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.ServerConn.List(p)
+	for _, e := range entries {
+		e.Name, e.Target = c.decode(e.Name), c.decode(e.Target)
+	}
+	return entries, err
+}
+
+func (c *conn) ChangeDir(p string) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.ChangeDir(p)
+}
+
+func (c *conn) CurrentDir() (string, error) {
+	dir, err := c.ServerConn.CurrentDir()
+	return c.decode(dir), err
+}
+
+func (c *conn) FileSize(p string) (int64, error) {
+	p, err := c.encode(p)
+	if err != nil {
+		return 0, err
+	}
+	return c.ServerConn.FileSize(p)
+}
+
+func (c *conn) GetTime(p string) (time.Time, error) {
+	p, err := c.encode(p)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.ServerConn.GetTime(p)
+}
+
+func (c *conn) SetTime(p string, t time.Time) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.SetTime(p, t)
+}
+
+func (c *conn) Retr(p string) (*ftp.Response, error) {
+	return c.RetrFrom(p, 0)
+}
+
+func (c *conn) RetrFrom(p string, offset uint64) (*ftp.Response, error) {
+	p, err := c.encode(p)
+	if err != nil {
+		return nil, err
+	}
+	return c.ServerConn.RetrFrom(p, offset)
+}
+
+func (c *conn) Stor(p string, r io.Reader) error {
+	return c.StorFrom(p, r, 0)
+}
+
+func (c *conn) StorFrom(p string, r io.Reader, offset uint64) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.StorFrom(p, r, offset)
+}
+
+func (c *conn) Append(p string, r io.Reader) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.Append(p, r)
+}
+
+func (c *conn) Rename(from, to string) error {
+	from, err := c.encode(from)
+	if err != nil {
+		return err
+	}
+	if to, err = c.encode(to); err != nil {
+		return err
+	}
+	return c.ServerConn.Rename(from, to)
+}
+
+func (c *conn) Delete(p string) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.Delete(p)
+}
+
+func (c *conn) MakeDir(p string) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.MakeDir(p)
+}
+
+func (c *conn) RemoveDir(p string) error {
+	p, err := c.encode(p)
+	if err != nil {
+		return err
+	}
+	return c.ServerConn.RemoveDir(p)
+}
+
+// connDialer dials the control connection and then every data connection of
+// one ServerConn. Owning the sockets lets it apply TLS, timeouts and active
+// mode itself, and lets List read the raw listing, which ftp.Entry reduces to
+// name, type, size and time.
+type connDialer struct {
+	net            net.Dialer
+	tlsConfig      *tls.Config // nil for plain FTP
+	tlsMode        string
+	active         bool   // Turn the library's PASV into PORT/EPRT
+	activeAddr     string // Address announced in PORT (default: local end of the control connection)
+	commandTimeout time.Duration
+	dataTimeout    time.Duration
+
+	control  *controlConn
+	listener net.Listener // Active mode: waiting for the server's data connection
+	capture  io.Writer    // Receives a copy of everything read from data connections while set
+}
+
+// dial is passed to ftp.DialWithDialFunc. The first call opens the control
+// connection, every later one a data connection to the address the library
+// got from EPSV/PASV.
+func (d *connDialer) dial(network, addr string) (net.Conn, error) {
+	if d.control == nil {
+		return d.dialControl(network, addr)
+	}
+
+	var nc net.Conn
+	if d.listener != nil {
+		nc = &activeConn{ln: d.listener, timeout: d.dataTimeout}
+		d.listener = nil
+	} else {
+		var err error
+		if nc, err = d.net.Dial(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	// The client is the TLS client on data connections in both directions (RFC 4217)
+	if d.tlsConfig != nil {
+		nc = tls.Client(nc, d.tlsConfig)
+	}
+	return &dataConn{Conn: nc, d: d}, nil
+}
+
+// dialControl connects and, for FTPS, finishes the TLS handshake before the
+// library sees the connection; for explicit TLS that means sending AUTH TLS
+// here and replaying the greeting afterwards.
+func (d *connDialer) dialControl(network, addr string) (net.Conn, error) {
+	nc, err := d.net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	// The greeting and handshake get the dial timeout
+	if d.net.Timeout > 0 {
+		nc.SetDeadline(time.Now().Add(d.net.Timeout))
+	}
+
+	var greeting string
+	switch d.tlsMode {
+	case TLSModeImplicit:
+		nc = tls.Client(nc, d.tlsConfig)
+	case TLSModeExplicit:
+		r := textproto.NewReader(bufio.NewReader(nc))
+		code, msg, err := r.ReadResponse(ftp.StatusReady)
+		if err == nil {
+			fmt.Fprint(nc, "AUTH TLS\r\n")
+			_, _, err = r.ReadResponse(ftp.StatusAuthOK)
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		greeting = formatReply(code, msg)
+		nc = tls.Client(nc, d.tlsConfig)
+	}
+	if tc, ok := nc.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	d.control = &controlConn{Conn: nc, r: bufio.NewReader(nc), d: d, pending: greeting}
+	return d.control, nil
+}
+
+// formatReply turns a parsed reply back into wire format
+func formatReply(code int, msg string) string {
+	lines := strings.Split(msg, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		fmt.Fprintf(&b, "%d%s%s\r\n", code, sep, line)
+	}
+	return b.String()
+}
+
+// controlConn is the control connection as the library sees it. Every
+// command gets commandTimeout to be answered, and in active mode a PASV is
+// sent as PORT (EPRT over IPv6) with a matching PASV reply handed back.
+type controlConn struct {
+	net.Conn
+	r       *bufio.Reader
+	d       *connDialer
+	pending string // Reply to return before reading from the server
+	portOut bool   // A PORT/EPRT reply is due
+	err     error  // First I/O error; after a timeout the replies are out of step
+}
+
+func (c *controlConn) extendDeadline() {
+	if c.d.commandTimeout > 0 {
+		c.Conn.SetDeadline(time.Now().Add(c.d.commandTimeout))
+	}
+}
+
+func (c *controlConn) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.extendDeadline()
+	if c.d.active && string(p) == "PASV\r\n" {
+		cmd, err := c.d.listen(c.Conn.LocalAddr())
+		if err != nil {
+			return 0, err
+		}
+		if _, c.err = io.WriteString(c.Conn, cmd); c.err != nil {
+			return 0, c.err
+		}
+		c.portOut = true
+		return len(p), nil
+	}
+	var n int
+	n, c.err = c.Conn.Write(p)
+	return n, c.err
+}
+
+func (c *controlConn) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.portOut {
+		c.portOut = false
+		var line string
+		if line, c.err = c.r.ReadString('\n'); c.err != nil {
+			return 0, c.err
+		}
+		if strings.HasPrefix(line, "2") {
+			// The address is not used: dial hands out the listener instead
+			line = "227 Entering Passive Mode (127,0,0,1,0,0).\r\n"
+		} else {
+			c.d.listener.Close()
+			c.d.listener = nil
+		}
+		c.pending = line
+	}
+	if c.pending != "" {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	var n int
+	n, c.err = c.r.Read(p)
+	return n, c.err
+}
+
+// listen opens the active-mode listener and returns the PORT or EPRT command announcing it
+func (d *connDialer) listen(local net.Addr) (string, error) {
+	host := d.activeAddr
+	if host == "" {
+		host, _, _ = net.SplitHostPort(local.String())
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", fmt.Errorf("active mode listen: %w", err)
+	}
+	d.listener = ln
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		return fmt.Sprintf("PORT %d,%d,%d,%d,%d,%d\r\n", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff), nil
+	}
+	return fmt.Sprintf("EPRT |2|%s|%s|\r\n", host, strconv.Itoa(port)), nil
+}
+
+// dataConn applies dataTimeout to a data connection (an idle limit, renewed
+// by every read and write) and copies reads to the capture writer.
+type dataConn struct {
+	net.Conn
+	d *connDialer
+}
+
+func (c *dataConn) Read(p []byte) (int, error) {
+	if c.d.dataTimeout > 0 {
+		c.Conn.SetDeadline(time.Now().Add(c.d.dataTimeout))
+	}
+	n, err := c.Conn.Read(p)
+	if c.d.capture != nil {
+		c.d.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+func (c *dataConn) Write(p []byte) (int, error) {
+	if c.d.dataTimeout > 0 {
+		c.Conn.SetDeadline(time.Now().Add(c.d.dataTimeout))
+	}
+	return c.Conn.Write(p)
+}
+
+// Close also gives the control connection a fresh commandTimeout: the
+// transfer may have outlasted it, and the library reads the final reply next.
+func (c *dataConn) Close() error {
+	err := c.Conn.Close()
+	c.d.control.extendDeadline()
+	return err
+}
+
+// Handshake is called by StorFrom for empty uploads, which never write
+func (c *dataConn) Handshake() error {
+	if h, ok := c.Conn.(interface{ Handshake() error }); ok {
+		return h.Handshake()
+	}
+	return nil
+}
+
+// activeConn is the data connection of active mode. The server only connects
+// after receiving the transfer command, which the library sends after dialing,
+// so the connection is accepted on first use.
+type activeConn struct {
+	ln      net.Listener
+	timeout time.Duration
+	once    sync.Once
+	conn    net.Conn
+	err     error
+}
+
+func (a *activeConn) accept() error {
+	a.once.Do(func() {
+		defer a.ln.Close()
+		if a.timeout > 0 {
+			a.ln.(*net.TCPListener).SetDeadline(time.Now().Add(a.timeout))
+		}
+		if a.conn, a.err = a.ln.Accept(); a.err != nil {
+			a.err = fmt.Errorf("active mode: server did not connect: %w", a.err)
+		}
+	})
+	return a.err
+}
+
+func (a *activeConn) Read(p []byte) (int, error) {
+	if err := a.accept(); err != nil {
+		return 0, err
+	}
+	return a.conn.Read(p)
+}
+
+func (a *activeConn) Write(p []byte) (int, error) {
+	if err := a.accept(); err != nil {
+		return 0, err
+	}
+	return a.conn.Write(p)
+}
+
+// Handshake makes an empty plain-FTP upload accept the connection too
+func (a *activeConn) Handshake() error {
+	return a.accept()
+}
+
+func (a *activeConn) Close() error {
+	// Stop waiting if the transfer command failed
+	a.once.Do(func() { a.err = net.ErrClosed; a.ln.Close() })
+	if a.conn != nil {
+		return a.conn.Close()
+	}
+	return nil
+}
+
+func (a *activeConn) LocalAddr() net.Addr {
+	if a.conn != nil {
+		return a.conn.LocalAddr()
+	}
+	return a.ln.Addr()
+}
+
+func (a *activeConn) RemoteAddr() net.Addr {
+	if a.conn != nil {
+		return a.conn.RemoteAddr()
+	}
+	return a.ln.Addr()
+}
+
+func (a *activeConn) SetDeadline(t time.Time) error {
+	if a.conn != nil {
+		return a.conn.SetDeadline(t)
+	}
+	return nil
+}
+
+func (a *activeConn) SetReadDeadline(t time.Time) error {
+	if a.conn != nil {
+		return a.conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (a *activeConn) SetWriteDeadline(t time.Time) error {
+	if a.conn != nil {
+		return a.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
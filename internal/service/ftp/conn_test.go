@@ -0,0 +1,352 @@
+package ftp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"github.com/jlaffaye/ftp"
+	"go.uber.org/zap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// memFTP is an in-memory FTP server. Paths are kept as the raw bytes the
+// client sent, so tests see names exactly as they went over the wire.
+type memFTP struct {
+	mu    sync.Mutex
+	files map[string]string // Absolute path -> content
+	dirs  map[string]bool   // Absolute paths of directories, "/" included
+	cmds  []string          // Every command received
+	fail  map[string]string // Command line -> reply sent instead of running it; "" drops the connection
+}
+
+// serveMemFTP starts a memFTP with an empty root and returns a config for it
+func serveMemFTP(t *testing.T) (*memFTP, config.FTPConfig) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	m := &memFTP{files: map[string]string{}, dirs: map[string]bool{"/": true}, fail: map[string]string{}}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(nc)
+		}
+	}()
+	cfg := config.FTPConfig{
+		Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, User: "u", Password: "p",
+		Pool: config.FTPPoolConfig{MaxConns: 1, WaitTimeout: time.Second},
+	}
+	return m, cfg
+}
+
+// commands returns the received commands that start with one of prefixes
+func (m *memFTP) commands(prefixes ...string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var cmds []string
+	for _, cmd := range m.cmds {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(cmd, prefix) {
+				cmds = append(cmds, cmd)
+				break
+			}
+		}
+	}
+	return cmds
+}
+
+func (m *memFTP) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	reply := func(format string, args ...any) { fmt.Fprintf(nc, format+"\r\n", args...) }
+
+	cwd := "/"
+	abs := func(p string) string {
+		if !strings.HasPrefix(p, "/") {
+			p = path.Join(cwd, p)
+		}
+		return path.Clean(p)
+	}
+	var data net.Listener
+	transfer := func(fn func(dc net.Conn)) {
+		if data == nil {
+			reply("425 use EPSV first")
+			return
+		}
+		reply("150 opening data connection")
+		dc, err := data.Accept()
+		data.Close()
+		data = nil
+		if err != nil {
+			return
+		}
+		fn(dc)
+		dc.Close()
+		reply("226 done")
+	}
+	var renameFrom string
+
+	reply("220 ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		m.mu.Lock()
+		m.cmds = append(m.cmds, line)
+		failReply, fail := m.fail[line]
+		m.mu.Unlock()
+		if fail {
+			if failReply == "" {
+				return
+			}
+			reply("%s", failReply)
+			continue
+		}
+
+		m.mu.Lock()
+		switch p := abs(arg); strings.ToUpper(cmd) {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			reply("230 logged in")
+		case "FEAT":
+			reply("211 no features")
+		case "TYPE", "NOOP":
+			reply("200 ok")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 cannot open data connection")
+				break
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "PWD":
+			reply(`257 "%s" is the current directory`, cwd)
+		case "CWD":
+			if !m.dirs[p] {
+				reply("550 no such directory")
+				break
+			}
+			cwd = p
+			reply("250 ok")
+		case "SIZE":
+			content, ok := m.files[p]
+			if !ok {
+				reply("550 not a plain file")
+				break
+			}
+			reply("213 %d", len(content))
+		case "MKD":
+			if m.dirs[p] || m.files[p] != "" || !m.dirs[path.Dir(p)] {
+				reply("550 cannot create directory")
+				break
+			}
+			m.dirs[p] = true
+			reply(`257 "%s" created`, p)
+		case "RMD":
+			if !m.dirs[p] || p == "/" || len(m.children(p)) > 0 {
+				reply("550 cannot remove directory")
+				break
+			}
+			delete(m.dirs, p)
+			reply("250 ok")
+		case "DELE":
+			if _, ok := m.files[p]; !ok {
+				reply("550 no such file")
+				break
+			}
+			delete(m.files, p)
+			reply("250 ok")
+		case "RNFR":
+			if _, ok := m.files[p]; !ok {
+				reply("550 no such file")
+				break
+			}
+			renameFrom = p
+			reply("350 ready for RNTO")
+		case "RNTO":
+			m.files[p] = m.files[renameFrom]
+			delete(m.files, renameFrom)
+			reply("250 ok")
+		case "STOR":
+			if !m.dirs[path.Dir(p)] {
+				reply("553 no such directory")
+				break
+			}
+			m.mu.Unlock()
+			var content []byte
+			transfer(func(dc net.Conn) { content, _ = io.ReadAll(dc) })
+			m.mu.Lock()
+			m.files[p] = string(content)
+		case "RETR":
+			content, ok := m.files[p]
+			if !ok {
+				reply("550 no such file")
+				break
+			}
+			m.mu.Unlock()
+			transfer(func(dc net.Conn) { io.WriteString(dc, content) })
+			m.mu.Lock()
+		case "LIST":
+			if !m.dirs[p] {
+				reply("550 no such directory")
+				break
+			}
+			var listing strings.Builder
+			for _, child := range m.children(p) {
+				if m.dirs[child] {
+					fmt.Fprintf(&listing, "drwxr-xr-x 1 user group 0 Jan 01 00:00 %s\r\n", path.Base(child))
+				} else {
+					fmt.Fprintf(&listing, "-rw-r--r-- 1 user group %d Jan 01 00:00 %s\r\n", len(m.files[child]), path.Base(child))
+				}
+			}
+			m.mu.Unlock()
+			transfer(func(dc net.Conn) { io.WriteString(dc, listing.String()) })
+			m.mu.Lock()
+		case "QUIT":
+			reply("221 bye")
+			m.mu.Unlock()
+			return
+		default:
+			reply("502 not implemented")
+		}
+		m.mu.Unlock()
+	}
+}
+
+// children returns the sorted paths directly inside dir. m.mu must be held.
+func (m *memFTP) children(dir string) []string {
+	var paths []string
+	for p := range m.files {
+		if path.Dir(p) == dir {
+			paths = append(paths, p)
+		}
+	}
+	for p := range m.dirs {
+		if p != "/" && path.Dir(p) == dir {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestFilenameEncoding(t *testing.T) {
+	srv, cfg := serveMemFTP(t)
+	cfg.Encoding = "gbk"
+	svc := NewService(cfg, zap.NewNop().Sugar())
+	defer svc.Close()
+
+	gbk := func(s string) string {
+		encoded, err := simplifiedchinese.GBK.NewEncoder().String(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	srv.dirs[gbk("/报告")] = true
+	srv.files[gbk("/报告/数据.txt")] = "hello"
+
+	// Listings are decoded
+	entries, err := svc.List("/报告", ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "数据.txt" || entries[0].Size != 5 {
+		t.Fatalf("List = %+v, want 数据.txt", entries)
+	}
+
+	// Names sent to the server are encoded
+	if err := svc.Upload("/报告/新建.txt", []byte("new")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if err := svc.Rename("/报告/新建.txt", "/报告/改名.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := svc.Delete("/报告/数据.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	want := []string{
+		"STOR " + gbk("/报告/新建.txt"),
+		"RNFR " + gbk("/报告/新建.txt"),
+		"RNTO " + gbk("/报告/改名.txt"),
+		"DELE " + gbk("/报告/数据.txt"),
+	}
+	if got := srv.commands("STOR", "RNFR", "RNTO", "DELE"); !slices.Equal(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	srv.mu.Lock()
+	content, ok := srv.files[gbk("/报告/改名.txt")]
+	srv.mu.Unlock()
+	if !ok || content != "new" {
+		t.Errorf("server has %q (%v) under the GBK name, want the uploaded file", content, ok)
+	}
+
+	// A name GBK cannot represent is refused before anything is sent, and
+	// the connection stays usable
+	for name, op := range map[string]func() error{
+		"Upload": func() error { return svc.Upload("/报告/😀.txt", []byte("x")) },
+		"Delete": func() error { return svc.Delete("/😀") },
+		"Rename": func() error { return svc.Rename("/报告/改名.txt", "/😀") },
+	} {
+		err := op()
+		var reply *textproto.Error
+		if !errors.As(err, &reply) || reply.Code != ftp.StatusBadFileName {
+			t.Errorf("%s of an unrepresentable name: %v, want a %d reply", name, err, ftp.StatusBadFileName)
+		}
+	}
+	if got := srv.commands("STOR", "RNFR", "DELE"); len(got) != 3 {
+		t.Errorf("commands = %q, want nothing sent for unrepresentable names", got)
+	}
+	if _, err := svc.List("/报告", ListOptions{}); err != nil {
+		t.Errorf("List after refused names: %v", err)
+	}
+	if dials := svc.PoolStats().Dials; dials != 1 {
+		t.Errorf("dials = %d, want the connection kept", dials)
+	}
+}
+
+func TestFilenameCharset(t *testing.T) {
+	for _, name := range []string{"", "utf-8", "UTF8"} {
+		if enc, err := filenameCharset(name); enc != nil || err != nil {
+			t.Errorf("filenameCharset(%q) = %v, %v, want no conversion", name, enc, err)
+		}
+	}
+	if _, err := filenameCharset("klingon"); err == nil {
+		t.Error("unknown encoding accepted")
+	}
+
+	enc, err := filenameCharset("gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &conn{charset: enc}
+	encoded, err := c.encode("目录/文件")
+	if err != nil || encoded != "\xc4\xbf\xc2\xbc/\xce\xc4\xbc\xfe" {
+		t.Errorf("encode = %q, %v, want GBK bytes", encoded, err)
+	}
+	if got := c.decode(encoded); got != "目录/文件" {
+		t.Errorf("decode = %q, want 目录/文件", got)
+	}
+}
@@ -0,0 +1,280 @@
+package ftp
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// defaultListDepth bounds recursive listings that do not set MaxDepth
+const defaultListDepth = 10
+
+type Entry struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"` // Relative to the listed directory; set for recursive listings
+	Type   string `json:"type" enum:"file,dir,link"`
+	Size   uint64 `json:"size"`
+	Time   string `json:"time"`
+	Target string `json:"target,omitempty"` // Link target, when the server reports it
+	Mode   string `json:"mode,omitempty"`   // Unix permission bits in octal, e.g. "0755"
+	Owner  string `json:"owner,omitempty"`
+	Group  string `json:"group,omitempty"`
+}
+
+// ListOptions controls how far List descends
+type ListOptions struct {
+	Recursive bool
+	MaxDepth  int // Directory levels below the listed one (default 10)
+}
+
+// List lists a directory, using MLSD when the server supports it and LIST
+// otherwise. Links are reported but never followed.
+func (s *Service) List(p string, opts ListOptions) ([]Entry, error) {
+	depth := 0
+	if opts.Recursive {
+		depth = opts.MaxDepth
+		if depth <= 0 {
+			depth = defaultListDepth
+		}
+	}
+
+	var result []Entry
+	err := s.withConn(func(c *conn) error {
+		var walk func(rel string, level int) error
+		walk = func(rel string, level int) error {
+			entries, err := listDir(c, path.Join(p, rel))
+			if err != nil {
+				if rel != "" {
+					return fmt.Errorf("list failed: %s: %w", rel, err)
+				}
+				return fmt.Errorf("list failed: %w", err)
+			}
+			for _, e := range entries {
+				entry := e.toEntry()
+				if opts.Recursive {
+					entry.Path = path.Join(rel, e.Name)
+				}
+				result = append(result, entry)
+				if e.Type == ftp.EntryTypeFolder && level < depth {
+					if err := walk(path.Join(rel, e.Name), level+1); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		return walk("", 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// remoteEntry is an ftp.Entry plus the facts it has no field for
+type remoteEntry struct {
+	*ftp.Entry
+	listFacts
+}
+
+type listFacts struct {
+	link   bool
+	target string
+	mode   string
+	owner  string
+	group  string
+}
+
+func (e remoteEntry) toEntry() Entry {
+	entryType := "file"
+	switch e.Type {
+	case ftp.EntryTypeFolder:
+		entryType = "dir"
+	case ftp.EntryTypeLink:
+		entryType = "link"
+	}
+	return Entry{
+		Name:   e.Name,
+		Type:   entryType,
+		Size:   e.Size,
+		Time:   e.Time.Format(time.RFC3339),
+		Target: e.Target,
+		Mode:   e.mode,
+		Owner:  e.owner,
+		Group:  e.group,
+	}
+}
+
+// listDir lists one directory. The library parses names, types, sizes and
+// times; the raw listing is captured alongside and parsed again for what
+// ftp.Entry drops: symlinks in MLSD, permissions and ownership. Names are
+// matched before they are decoded from the server encoding.
+func listDir(c *conn, dir string) ([]remoteEntry, error) {
+	encoded, err := c.encode(dir)
+	if err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	c.dialer.capture = &raw
+	entries, err := c.ServerConn.List(encoded)
+	c.dialer.capture = nil
+	if err != nil {
+		return nil, err
+	}
+
+	parse := parseLSFacts
+	if c.IsTimePreciseInList() {
+		parse = parseMLSDFacts
+	}
+	facts := map[string]listFacts{}
+	for _, line := range strings.Split(raw.String(), "\n") {
+		if name, f, ok := parse(strings.TrimRight(line, "\r")); ok {
+			facts[name] = f
+		}
+	}
+
+	result := make([]remoteEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		f := facts[e.Name]
+		if f.link {
+			e.Type = ftp.EntryTypeLink
+		}
+		if e.Target == "" {
+			e.Target = f.target
+		}
+		e.Name, e.Target = c.decode(e.Name), c.decode(e.Target)
+		f.owner, f.group = c.decode(f.owner), c.decode(f.group)
+		result = append(result, remoteEntry{Entry: e, listFacts: f})
+	}
+	return result, nil
+}
+
+// parseMLSDFacts reads an RFC 3659 line such as
+// "type=OS.unix=slink:/srv;unix.mode=0755;unix.owner=www; name"
+func parseMLSDFacts(line string) (string, listFacts, bool) {
+	var f listFacts
+	facts, name, ok := strings.Cut(line, " ")
+	if !ok || !strings.Contains(facts, ";") {
+		return "", f, false
+	}
+
+	var uid, gid string
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, ok := strings.Cut(fact, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "type":
+			// Unix servers report links as OS.unix=symlink or OS.unix=slink:<target>
+			lower := strings.ToLower(value)
+			if lower == "os.unix=symlink" || strings.HasPrefix(lower, "os.unix=slink") {
+				f.link = true
+				_, f.target, _ = strings.Cut(value, ":")
+			}
+		case "unix.mode":
+			if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+				f.mode = fmt.Sprintf("%04o", mode&07777)
+			}
+		case "unix.owner", "unix.ownername":
+			f.owner = value
+		case "unix.group", "unix.groupname":
+			f.group = value
+		case "unix.uid":
+			uid = value
+		case "unix.gid":
+			gid = value
+		}
+	}
+	// Numeric IDs only when no name was given
+	if f.owner == "" {
+		f.owner = uid
+	}
+	if f.group == "" {
+		f.group = gid
+	}
+	return name, f, true
+}
+
+// parseLSFacts reads an "ls -l" style line such as
+// "lrwxrwxrwx 1 owner group 4 Jan 01 00:00 name -> target". The group
+// column is missing on some servers.
+func parseLSFacts(line string) (string, listFacts, bool) {
+	var f listFacts
+	fields := strings.Fields(line)
+	if len(fields) < 8 || len(fields[0]) < 10 || !strings.ContainsRune("-dlbcps", rune(fields[0][0])) {
+		return "", f, false
+	}
+
+	// mode links owner [group] size month day time|year name
+	var columns int
+	switch {
+	case len(fields) >= 9 && isMonth(fields[5]):
+		columns = 8
+		f.owner, f.group = fields[2], fields[3]
+	case isMonth(fields[4]):
+		columns = 7
+		f.owner = fields[2]
+	default:
+		return "", f, false
+	}
+	name, ok := skipFields(line, columns)
+	if !ok {
+		return "", f, false
+	}
+
+	f.mode = fmt.Sprintf("%04o", lsMode(fields[0][1:10]))
+	if fields[0][0] == 'l' {
+		f.link = true
+		name, f.target, _ = strings.Cut(name, " -> ")
+	}
+	return name, f, true
+}
+
+// skipFields returns what follows the first n space-separated fields
+func skipFields(line string, n int) (string, bool) {
+	rest := line
+	for range n {
+		rest = strings.TrimLeft(rest, " ")
+		i := strings.IndexByte(rest, ' ')
+		if i < 0 {
+			return "", false
+		}
+		rest = rest[i:]
+	}
+	rest = strings.TrimLeft(rest, " ")
+	return rest, rest != ""
+}
+
+func isMonth(s string) bool {
+	_, err := time.Parse("Jan", s)
+	return err == nil
+}
+
+// lsMode converts "rwxr-sr-t" to permission bits, including setuid, setgid and sticky
+func lsMode(perms string) uint32 {
+	var mode uint32
+	for i, ch := range perms {
+		if ch != '-' && ch != 'S' && ch != 'T' {
+			mode |= 1 << (8 - i)
+		}
+	}
+	if perms[2] == 's' || perms[2] == 'S' {
+		mode |= 04000
+	}
+	if perms[5] == 's' || perms[5] == 'S' {
+		mode |= 02000
+	}
+	if perms[8] == 't' || perms[8] == 'T' {
+		mode |= 01000
+	}
+	return mode
+}
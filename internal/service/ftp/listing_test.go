@@ -0,0 +1,38 @@
+package ftp
+
+import "testing"
+
+func TestParseListFacts(t *testing.T) {
+	tests := []struct {
+		parse func(string) (string, listFacts, bool)
+		line  string
+		name  string
+		want  listFacts
+	}{
+		{parseMLSDFacts, "type=file;size=5;modify=20240101000000;UNIX.mode=0640;UNIX.owner=www;UNIX.group=web; a b.txt",
+			"a b.txt", listFacts{mode: "0640", owner: "www", group: "web"}},
+		{parseMLSDFacts, "type=OS.unix=slink:/srv/data;unix.mode=0777;unix.uid=0;unix.gid=0; data",
+			"data", listFacts{link: true, target: "/srv/data", mode: "0777", owner: "0", group: "0"}},
+		{parseMLSDFacts, "type=OS.unix=symlink;size=4; link",
+			"link", listFacts{link: true}},
+		{parseLSFacts, "drwxr-sr-x    2 alice    staff        4096 Jan 02 10:00 my dir",
+			"my dir", listFacts{mode: "2755", owner: "alice", group: "staff"}},
+		{parseLSFacts, "lrwxrwxrwx 1 root root 4 Mar 01  2023 www -> /var/www",
+			"www", listFacts{link: true, target: "/var/www", mode: "0777", owner: "root", group: "root"}},
+		{parseLSFacts, "-rw-r--r-T 1 ftp 12 Dec 31 23:59 no-group.txt",
+			"no-group.txt", listFacts{mode: "1644", owner: "ftp"}},
+	}
+
+	for _, tt := range tests {
+		name, got, ok := tt.parse(tt.line)
+		if !ok || name != tt.name || got != tt.want {
+			t.Errorf("%q: got %q %+v %v, want %q %+v", tt.line, name, got, ok, tt.name, tt.want)
+		}
+	}
+
+	for _, line := range []string{"total 12", "01-02-24  10:00AM       <DIR>          dos", ""} {
+		if _, _, ok := parseLSFacts(line); ok {
+			t.Errorf("parseLSFacts(%q) accepted a non-ls line", line)
+		}
+	}
+}
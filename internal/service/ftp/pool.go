@@ -0,0 +1,281 @@
+package ftp
+
+import (
+	"errors"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPoolTimeout is returned when no pooled connection became available in time
+	ErrPoolTimeout = errors.New("timed out waiting for an ftp connection")
+	// ErrPoolClosed is returned by checkouts after the pool was closed
+	ErrPoolClosed = errors.New("ftp connection pool closed")
+)
+
+// PoolStats is a snapshot of the connection pool, reported by /api/health/ready
+type PoolStats struct {
+	MaxConns int   `json:"max_conns"`
+	Open     int   `json:"open"`
+	Idle     int   `json:"idle"`
+	InUse    int   `json:"in_use"`
+	Dials    int64 `json:"dials"`    // Connections created (dial + login)
+	Reuses   int64 `json:"reuses"`   // Checkouts served by an idle connection
+	Discards int64 `json:"discards"` // Connections closed as broken, idle or expired
+	Waits    int64 `json:"waits"`    // Checkouts that had to wait for a connection
+}
+
+// pooledConn is an authenticated connection owned by the pool. Only one caller
+// holds it at a time, since the FTP control channel is strictly sequential.
+type pooledConn struct {
+	*conn
+	created  time.Time
+	lastUsed time.Time
+}
+
+// pool keeps up to maxConns logged-in connections. sem holds a token for every
+// open connection, idle or in use; idle connections wait in the idle channel,
+// which is large enough to never block put.
+type pool struct {
+	dial        func() (*conn, error)
+	sem         chan struct{}
+	idle        chan *pooledConn
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	waitTimeout time.Duration
+
+	dials, reuses, discards, waits atomic.Int64
+
+	mu        sync.Mutex // Orders returns to idle against Close
+	closed    bool
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newPool(dial func() (*conn, error), maxConns int, idleTimeout, maxLifetime, waitTimeout time.Duration) *pool {
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+	p := &pool{
+		dial:        dial,
+		sem:         make(chan struct{}, maxConns),
+		idle:        make(chan *pooledConn, maxConns),
+		idleTimeout: idleTimeout,
+		maxLifetime: maxLifetime,
+		waitTimeout: waitTimeout,
+		done:        make(chan struct{}),
+	}
+	if idleTimeout > 0 || maxLifetime > 0 {
+		go p.reap()
+	}
+	return p
+}
+
+// get returns an exclusive connection: an idle one that still answers NOOP,
+// a new one if the pool has room, or whichever comes first after waiting.
+func (p *pool) get() (*pooledConn, error) {
+	var timeout <-chan time.Time
+	waited := false
+
+	for {
+		if p.isClosed() {
+			return nil, ErrPoolClosed
+		}
+		// Prefer idle connections over dialing
+		select {
+		case pc := <-p.idle:
+			if c := p.check(pc); c != nil {
+				return c, nil
+			}
+			continue
+		default:
+		}
+
+		select {
+		case pc := <-p.idle:
+			if c := p.check(pc); c != nil {
+				return c, nil
+			}
+			continue
+		case p.sem <- struct{}{}:
+			return p.open()
+		default:
+		}
+
+		if !waited {
+			waited = true
+			p.waits.Add(1)
+			if p.waitTimeout > 0 {
+				timer := time.NewTimer(p.waitTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+		}
+		select {
+		case pc := <-p.idle:
+			if c := p.check(pc); c != nil {
+				return c, nil
+			}
+		case p.sem <- struct{}{}:
+			return p.open()
+		case <-timeout:
+			return nil, ErrPoolTimeout
+		case <-p.done:
+			return nil, ErrPoolClosed
+		}
+	}
+}
+
+// put hands a connection back. opErr is the error of the operation that used
+// it: FTP replies (4xx/5xx) leave the control channel usable, anything else
+// (network errors, aborted transfers) gets the connection closed.
+func (p *pool) put(pc *pooledConn, opErr error) {
+	var reply *textproto.Error
+	if opErr != nil && !errors.As(opErr, &reply) {
+		p.discard(pc)
+		return
+	}
+	pc.lastUsed = time.Now()
+	if p.expired(pc, pc.lastUsed) {
+		p.discard(pc)
+		return
+	}
+	p.toIdle(pc)
+}
+
+// toIdle parks a connection in the idle channel, or closes it if the pool is
+// closed. The check and the send happen under mu, so a connection can't slip
+// in after Close has drained the channel.
+func (p *pool) toIdle(pc *pooledConn) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.discard(pc)
+		return
+	}
+	p.idle <- pc
+	p.mu.Unlock()
+}
+
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Stats returns a snapshot of the pool counters
+func (p *pool) Stats() PoolStats {
+	stats := PoolStats{
+		MaxConns: cap(p.sem),
+		Open:     len(p.sem),
+		Idle:     len(p.idle),
+		Dials:    p.dials.Load(),
+		Reuses:   p.reuses.Load(),
+		Discards: p.discards.Load(),
+		Waits:    p.waits.Load(),
+	}
+	stats.InUse = max(stats.Open-stats.Idle, 0)
+	return stats
+}
+
+// Close quits all idle connections and stops the reaper. Connections still in
+// use are closed when they are returned.
+func (p *pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.closeOnce.Do(func() { close(p.done) })
+	for {
+		select {
+		case pc := <-p.idle:
+			p.discard(pc)
+		default:
+			return
+		}
+	}
+}
+
+// open dials a new connection; the caller already holds its sem token
+func (p *pool) open() (*pooledConn, error) {
+	if p.isClosed() {
+		<-p.sem
+		return nil, ErrPoolClosed
+	}
+	c, err := p.dial()
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	if p.isClosed() {
+		// Closed while dialing: nobody would return it
+		c.Quit()
+		<-p.sem
+		return nil, ErrPoolClosed
+	}
+	p.dials.Add(1)
+	now := time.Now()
+	return &pooledConn{conn: c, created: now, lastUsed: now}, nil
+}
+
+// check validates an idle connection before reuse, discarding it if it has
+// expired or no longer answers NOOP
+func (p *pool) check(pc *pooledConn) *pooledConn {
+	if p.expired(pc, time.Now()) || pc.NoOp() != nil {
+		p.discard(pc)
+		return nil
+	}
+	p.reuses.Add(1)
+	return pc
+}
+
+func (p *pool) expired(pc *pooledConn, now time.Time) bool {
+	if p.maxLifetime > 0 && now.Sub(pc.created) >= p.maxLifetime {
+		return true
+	}
+	return p.idleTimeout > 0 && now.Sub(pc.lastUsed) >= p.idleTimeout
+}
+
+// discard closes a connection and frees its sem token
+func (p *pool) discard(pc *pooledConn) {
+	pc.Quit()
+	p.discards.Add(1)
+	<-p.sem
+}
+
+// reap periodically closes idle connections past their idle timeout or lifetime
+func (p *pool) reap() {
+	interval := p.idleTimeout
+	if interval <= 0 || (p.maxLifetime > 0 && p.maxLifetime < interval) {
+		interval = p.maxLifetime
+	}
+	interval = max(interval/2, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			// Only look at the connections idle right now; ones returned
+			// meanwhile are fresh anyway
+			for n := len(p.idle); n > 0; n-- {
+				var pc *pooledConn
+				select {
+				case pc = <-p.idle:
+				default:
+				}
+				if pc == nil {
+					break
+				}
+				if p.expired(pc, now) {
+					p.discard(pc)
+				} else {
+					p.toIdle(pc)
+				}
+			}
+		}
+	}
+}
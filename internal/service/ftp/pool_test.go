@@ -0,0 +1,33 @@
+package ftp
+
+import (
+	"errors"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+)
+
+func TestPoolClose(t *testing.T) {
+	port := serveFTPS(t, TLSModeNone, nil)
+	cfg := config.FTPConfig{Host: "127.0.0.1", Port: port, User: "u", Password: "p"}
+	p := newPool(func() (*conn, error) { return connect(cfg) }, 2, 0, 0, 0)
+
+	pc, err := p.get()
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	p.Close()
+
+	// Returned after Close: quit, not parked in the drained idle channel
+	p.put(pc, nil)
+	if stats := p.Stats(); stats.Open != 0 || stats.Idle != 0 {
+		t.Errorf("after put on a closed pool: %+v, want nothing open", stats)
+	}
+
+	if _, err := p.get(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("get after Close: %v, want ErrPoolClosed", err)
+	}
+	if dials := p.Stats().Dials; dials != 1 {
+		t.Errorf("dials = %d, want no dial after Close", dials)
+	}
+}
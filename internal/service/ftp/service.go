@@ -2,105 +2,417 @@ package ftp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"time"
+	"net"
+	"net/textproto"
+	"path"
+	"reflect"
+	"sync"
 
 	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/logger"
 
 	"github.com/jlaffaye/ftp"
+	"go.uber.org/zap"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	// ErrConnect is matched (errors.Is) by failures to reach the FTP server
+	ErrConnect = errors.New("failed to dial ftp")
+	// ErrAuth is matched by FTP login failures
+	ErrAuth = errors.New("failed to login ftp")
 )
 
 type Service struct {
+	log       *zap.SugaredLogger
+	transfers transferStore
+	syncs     syncStore
+
+	mu     sync.RWMutex // Update swaps config and pool together
 	config config.FTPConfig
+	pool   *pool
 }
 
-func NewService(cfg config.FTPConfig) *Service {
+func NewService(cfg config.FTPConfig, log *zap.SugaredLogger) *Service {
 	return &Service{
+		log:    log,
 		config: cfg,
+		pool:   newServicePool(cfg),
 	}
 }
 
-func (s *Service) connect() (*ftp.ServerConn, error) {
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial ftp: %w", err)
+func newServicePool(cfg config.FTPConfig) *pool {
+	dial := func() (*conn, error) { return connect(cfg) }
+	return newPool(dial, cfg.Pool.MaxConns, cfg.Pool.IdleTimeout, cfg.Pool.MaxLifetime, cfg.Pool.WaitTimeout)
+}
+
+// Update switches the service to cfg. If anything changed, new requests use
+// fresh connections; connections in use are quit when handed back.
+func (s *Service) Update(cfg config.FTPConfig) {
+	s.mu.Lock()
+	if reflect.DeepEqual(cfg, s.config) {
+		s.mu.Unlock()
+		return
 	}
+	old := s.pool
+	s.config, s.pool = cfg, newServicePool(cfg)
+	s.mu.Unlock()
+	old.Close()
+}
 
-	if err := c.Login(s.config.User, s.config.Password); err != nil {
-		c.Quit()
-		return nil, fmt.Errorf("failed to login ftp: %w", err)
+// logger returns the logger carried by ctx, falling back to the service's
+func (s *Service) logger(ctx context.Context) *zap.SugaredLogger {
+	return logger.FromContext(ctx, s.log)
+}
+
+func (s *Service) settings() config.FTPConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// conns returns the current pool. Connections go back to the pool they came
+// from, even if Update replaced it meanwhile.
+func (s *Service) conns() *pool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
+// checkout takes a connection from the current pool. A pool closed by Update
+// between looking it up and taking from it is retried on its replacement.
+func (s *Service) checkout() (*pool, *pooledConn, error) {
+	for {
+		p := s.conns()
+		pc, err := p.get()
+		if errors.Is(err, ErrPoolClosed) && s.conns() != p {
+			continue
+		}
+		return p, pc, err
 	}
+}
 
-	return c, nil
+// withConn runs fn on a pooled connection and hands it back afterwards
+func (s *Service) withConn(fn func(c *conn) error) error {
+	p, pc, err := s.checkout()
+	if err != nil {
+		return err
+	}
+	err = fn(pc.conn)
+	p.put(pc, err)
+	return err
+}
+
+// PoolStats reports the state of the connection pool
+func (s *Service) PoolStats() PoolStats {
+	return s.conns().Stats()
 }
 
-type Entry struct {
-	Name string `json:"name"`
-	Type string `json:"type"` // "file" or "dir"
-	Size uint64 `json:"size"`
-	Time string `json:"time"`
+// Close quits all pooled connections
+func (s *Service) Close() {
+	s.conns().Close()
 }
 
-func (s *Service) List(path string) ([]Entry, error) {
-	c, err := s.connect()
+func connect(cfg config.FTPConfig) (*conn, error) {
+	tlsConfig, err := tlsClientConfig(cfg)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrConnect, err)
+	}
+	charset, err := filenameCharset(cfg.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnect, err)
+	}
+	d := &connDialer{
+		net:            net.Dialer{Timeout: cfg.DialTimeout},
+		tlsConfig:      tlsConfig,
+		tlsMode:        cfg.TLSMode,
+		active:         cfg.Active,
+		activeAddr:     cfg.ActiveAddr,
+		commandTimeout: cfg.CommandTimeout,
+		dataTimeout:    cfg.DataTimeout,
+	}
+	opts := []ftp.DialOption{
+		ftp.DialWithDialFunc(d.dial),
+		// Active mode rewrites PASV, so the library must not try EPSV first
+		ftp.DialWithDisabledEPSV(cfg.DisableEPSV || cfg.Active),
+		// Names are converted here; asking the server for UTF-8 would defeat that
+		ftp.DialWithDisabledUTF8(charset != nil),
+	}
+	if tlsConfig != nil {
+		// The dialer does the handshake; this makes Login protect data connections
+		opts = append(opts, ftp.DialWithTLS(tlsConfig))
 	}
-	defer c.Quit()
 
-	entries, err := c.List(path)
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	sc, err := ftp.Dial(addr, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("list failed: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrConnect, err)
 	}
+	c := &conn{ServerConn: sc, dialer: d, charset: charset}
 
-	var result []Entry
-	for _, e := range entries {
-		entryType := "file"
-		if e.Type == ftp.EntryTypeFolder {
-			entryType = "dir"
+	if err := c.Login(cfg.User, cfg.Password); err != nil {
+		c.Quit()
+		if isTLSError(err) {
+			return nil, fmt.Errorf("%w: %w", ErrConnect, err)
 		}
-		result = append(result, Entry{
-			Name: e.Name,
-			Type: entryType,
-			Size: e.Size,
-			Time: e.Time.Format(time.RFC3339),
-		})
+		return nil, fmt.Errorf("%w: %w", ErrAuth, err)
 	}
-	return result, nil
+
+	return c, nil
 }
 
-func (s *Service) Upload(path string, content []byte) error {
-	c, err := s.connect()
+// filenameCharset looks up ftp_server.encoding (a WHATWG name such as gbk,
+// gb18030 or big5). UTF-8 needs no conversion and returns nil.
+func filenameCharset(name string) (encoding.Encoding, error) {
+	if name == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	if enc == unicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// Ping dials, logs in and sends NOOP to verify the FTP server is usable.
+// It bypasses the pool so a healthy idle connection cannot mask login failures.
+func (s *Service) Ping() error {
+	c, err := connect(s.settings())
 	if err != nil {
 		return err
 	}
 	defer c.Quit()
 
-	reader := bytes.NewReader(content)
-	if err := c.Stor(path, reader); err != nil {
-		return fmt.Errorf("upload failed: %w", err)
+	if err := c.NoOp(); err != nil {
+		return fmt.Errorf("noop failed: %w", err)
 	}
 	return nil
 }
 
+// Target returns the host:port of the FTP server
+func (s *Service) Target() string {
+	cfg := s.settings()
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+func (s *Service) Upload(path string, content []byte) error {
+	_, err := s.UploadFrom(path, bytes.NewReader(content), UploadOptions{Size: int64(len(content))})
+	return err
+}
+
 func (s *Service) Download(path string) ([]byte, error) {
-	c, err := s.connect()
+	buf, _, err := s.DownloadRange(path, DownloadOptions{})
+	return buf, err
+}
+
+// FileInfo describes a single remote file or directory
+type FileInfo struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	IsDir   bool   `json:"is_dir"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"` // Unix seconds, 0 if the server has no MDTM
+}
+
+// Stat returns size (SIZE) and modification time (MDTM) of a path
+func (s *Service) Stat(p string) (*FileInfo, error) {
+	p = path.Clean(p)
+	info := &FileInfo{Name: path.Base(p), Path: p}
+	err := s.withConn(func(c *conn) error {
+		size, err := c.FileSize(p)
+		if err != nil {
+			// SIZE is refused for directories
+			var reply *textproto.Error
+			if !errors.As(err, &reply) {
+				return fmt.Errorf("stat failed: %w", err)
+			}
+			dir, dirErr := isDir(c, p)
+			if dirErr != nil {
+				return dirErr
+			}
+			if !dir {
+				return fmt.Errorf("stat failed: %w", err)
+			}
+			info.IsDir = true
+		}
+		info.Size = size
+		if c.IsGetTimeSupported() {
+			if t, err := c.GetTime(p); err == nil {
+				info.ModTime = t.Unix()
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer c.Quit()
+	return info, nil
+}
+
+// Mkdir creates a directory (with parents if needed)
+func (s *Service) Mkdir(p string) error {
+	return s.withConn(func(c *conn) error {
+		if err := mkdirAll(c, path.Clean(p)); err != nil {
+			return fmt.Errorf("mkdir failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// Delete removes a single file
+func (s *Service) Delete(p string) error {
+	return s.withConn(func(c *conn) error {
+		if err := c.Delete(p); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// RemoveDir removes a directory; with recursive it removes its contents first
+func (s *Service) RemoveDir(p string, recursive bool) error {
+	return s.withConn(func(c *conn) error {
+		var err error
+		if recursive {
+			err = removeAll(c, path.Clean(p))
+		} else {
+			err = c.RemoveDir(p)
+		}
+		if err != nil {
+			return fmt.Errorf("rmdir failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// Rename moves or renames a file or directory
+func (s *Service) Rename(src, dst string) error {
+	return s.withConn(func(c *conn) error {
+		if err := c.Rename(src, dst); err != nil {
+			return fmt.Errorf("rename failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// BatchDeleteResult represents the result of batch delete
+type BatchDeleteResult struct {
+	Success []string           `json:"success"`
+	Failed  []BatchDeleteError `json:"failed"`
+}
+
+// BatchDeleteError represents a single delete error
+type BatchDeleteError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BatchDelete deletes multiple files/directories (directories recursively)
+// over one connection
+func (s *Service) BatchDelete(paths []string) (*BatchDeleteResult, error) {
+	result := &BatchDeleteResult{
+		Success: []string{},
+		Failed:  []BatchDeleteError{},
+	}
 
-	r, err := c.Retr(path)
+	err := s.withConn(func(c *conn) error {
+		var reply *textproto.Error
+		for i, p := range paths {
+			err := c.Delete(p)
+			if err != nil && errors.As(err, &reply) {
+				// DELE refuses directories
+				dir, dirErr := isDir(c, p)
+				switch {
+				case dirErr != nil:
+					err = dirErr
+				case dir:
+					err = removeAll(c, path.Clean(p))
+				}
+			}
+
+			if err == nil {
+				result.Success = append(result.Success, p)
+				continue
+			}
+			if errors.As(err, &reply) {
+				result.Failed = append(result.Failed, BatchDeleteError{Path: p, Error: err.Error()})
+				continue
+			}
+			// The connection itself failed, so the remaining paths fail too
+			for _, rest := range paths[i:] {
+				result.Failed = append(result.Failed, BatchDeleteError{Path: rest, Error: err.Error()})
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil && len(result.Failed) == 0 {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isDir reports whether p is a directory by changing into it. The working
+// directory is restored afterwards so pooled connections stay interchangeable.
+func isDir(c *conn, p string) (bool, error) {
+	cwd, err := c.CurrentDir()
 	if err != nil {
-		return nil, fmt.Errorf("download failed: %w", err)
+		return false, err
+	}
+	if err := c.ChangeDir(p); err != nil {
+		return false, nil
+	}
+	if err := c.ChangeDir(cwd); err != nil {
+		// Not wrapped: a connection stuck in another directory must not be reused
+		return true, fmt.Errorf("failed to restore working directory: %v", err)
+	}
+	return true, nil
+}
+
+// mkdirAll is mkdir -p over FTP
+func mkdirAll(c *conn, p string) error {
+	err := c.MakeDir(p)
+	if err == nil {
+		return nil
 	}
-	defer r.Close()
+	if dir, dirErr := isDir(c, p); dirErr != nil || dir {
+		return dirErr
+	}
+	parent := path.Dir(p)
+	if parent == p || parent == "." || parent == "/" {
+		return err
+	}
+	if err := mkdirAll(c, parent); err != nil {
+		return err
+	}
+	return c.MakeDir(p)
+}
 
-	buf, err := io.ReadAll(r)
+// removeAll deletes a directory tree using absolute paths. Unlike
+// ServerConn.RemoveDirRecur it never changes the working directory.
+func removeAll(c *conn, dir string) error {
+	entries, err := listDir(c, dir)
 	if err != nil {
-		return nil, fmt.Errorf("read failed: %w", err)
+		return err
+	}
+	for _, e := range entries {
+		child := path.Join(dir, e.Name)
+		if e.Type == ftp.EntryTypeFolder {
+			err = removeAll(c, child)
+		} else {
+			err = c.Delete(child)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return buf, nil
+	return c.RemoveDir(dir)
 }
@@ -0,0 +1,160 @@
+package ftp
+
+import (
+	"errors"
+	"maps"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// dialMemFTP connects to a fresh memFTP holding dirs and files
+func dialMemFTP(t *testing.T, dirs []string, files map[string]string) (*memFTP, *conn) {
+	t.Helper()
+	srv, cfg := serveMemFTP(t)
+	for _, d := range dirs {
+		srv.dirs[d] = true
+	}
+	maps.Copy(srv.files, files)
+	c, err := connect(cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { c.Quit() })
+	return srv, c
+}
+
+func TestIsDir(t *testing.T) {
+	srv, c := dialMemFTP(t, []string{"/home", "/home/u"}, map[string]string{"/home/u/a.txt": "a"})
+	if err := c.ChangeDir("/home"); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[string]bool{"/home/u": true, "/home/u/a.txt": false, "/missing": false, "u": true} {
+		dir, err := isDir(c, p)
+		if err != nil || dir != want {
+			t.Errorf("isDir(%s) = %v, %v, want %v", p, dir, err, want)
+		}
+		if cwd, err := c.CurrentDir(); err != nil || cwd != "/home" {
+			t.Errorf("working directory after isDir(%s) = %q, %v, want /home", p, cwd, err)
+		}
+	}
+
+	// A directory that cannot be changed back to leaves the connection
+	// unusable, which must not pass for an FTP reply
+	srv.mu.Lock()
+	srv.fail["CWD /home"] = "550 gone"
+	srv.mu.Unlock()
+	dir, err := isDir(c, "/home/u")
+	var reply *textproto.Error
+	if !dir || err == nil || errors.As(err, &reply) {
+		t.Errorf("isDir with the old directory gone = %v, %v, want true and an unwrapped error", dir, err)
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	srv, c := dialMemFTP(t, []string{"/a"}, map[string]string{"/a/file": "x"})
+
+	if err := mkdirAll(c, "/a/b/c/d"); err != nil {
+		t.Fatalf("mkdirAll: %v", err)
+	}
+	srv.mu.Lock()
+	for _, d := range []string{"/a/b", "/a/b/c", "/a/b/c/d"} {
+		if !srv.dirs[d] {
+			t.Errorf("%s was not created", d)
+		}
+	}
+	srv.mu.Unlock()
+	// Existing directories are fine, files in the way are not
+	if err := mkdirAll(c, "/a/b"); err != nil {
+		t.Errorf("mkdirAll of an existing directory: %v", err)
+	}
+	if err := mkdirAll(c, "/a/file/sub"); err == nil {
+		t.Error("mkdirAll through a file succeeded")
+	}
+	if cwd, _ := c.CurrentDir(); cwd != "/" {
+		t.Errorf("working directory = %q, want / restored", cwd)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	srv, c := dialMemFTP(t,
+		[]string{"/keep", "/tree", "/tree/sub", "/tree/sub/deep", "/tree/empty"},
+		map[string]string{"/keep/k": "k", "/tree/a": "a", "/tree/sub/b": "b", "/tree/sub/deep/c": "c"})
+
+	if err := removeAll(c, "/tree"); err != nil {
+		t.Fatalf("removeAll: %v", err)
+	}
+	srv.mu.Lock()
+	dirs := slices.Sorted(maps.Keys(srv.dirs))
+	files := slices.Sorted(maps.Keys(srv.files))
+	srv.mu.Unlock()
+	if !slices.Equal(dirs, []string{"/", "/keep"}) || !slices.Equal(files, []string{"/keep/k"}) {
+		t.Errorf("left dirs %v and files %v, want only /keep/k", dirs, files)
+	}
+	// Absolute paths only: the working directory is never changed
+	if cwds := srv.commands("CWD"); len(cwds) != 0 {
+		t.Errorf("removeAll changed directory: %q", cwds)
+	}
+
+	if err := removeAll(c, "/missing"); err == nil {
+		t.Error("removeAll of a missing directory succeeded")
+	}
+}
+
+func TestBatchDelete(t *testing.T) {
+	srv, cfg := serveMemFTP(t)
+	for _, d := range []string{"/d", "/d/sub"} {
+		srv.dirs[d] = true
+	}
+	maps.Copy(srv.files, map[string]string{"/f1": "1", "/f2": "2", "/f3": "3", "/d/x": "x", "/d/sub/y": "y"})
+	svc := NewService(cfg, zap.NewNop().Sugar())
+	defer svc.Close()
+
+	// Files, a tree and a missing path; a failed reply does not stop the batch
+	result, err := svc.BatchDelete([]string{"/f1", "/d", "/missing", "/f2"})
+	if err != nil {
+		t.Fatalf("BatchDelete: %v", err)
+	}
+	if !slices.Equal(result.Success, []string{"/f1", "/d", "/f2"}) {
+		t.Errorf("success = %v, want /f1 /d /f2", result.Success)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Path != "/missing" {
+		t.Errorf("failed = %+v, want /missing", result.Failed)
+	}
+	srv.mu.Lock()
+	if files := slices.Collect(maps.Keys(srv.files)); !slices.Equal(files, []string{"/f3"}) {
+		t.Errorf("left %v, want /f3", files)
+	}
+	if srv.dirs["/d"] {
+		t.Error("/d was not removed")
+	}
+
+	// The connection dropping fails the path it happened on and every one after it
+	srv.files["/f1"], srv.files["/f2"] = "1", "2"
+	srv.fail["DELE /f2"] = ""
+	srv.mu.Unlock()
+	result, err = svc.BatchDelete([]string{"/f1", "/f2", "/f3"})
+	if err != nil {
+		t.Fatalf("BatchDelete: %v", err)
+	}
+	if !slices.Equal(result.Success, []string{"/f1"}) {
+		t.Errorf("success = %v, want /f1", result.Success)
+	}
+	var failed []string
+	for _, f := range result.Failed {
+		failed = append(failed, f.Path)
+		if f.Error == "" || strings.Contains(f.Error, "550") {
+			t.Errorf("%s failed with %q, want the connection error", f.Path, f.Error)
+		}
+	}
+	if !slices.Equal(failed, []string{"/f2", "/f3"}) {
+		t.Errorf("failed = %v, want /f2 /f3", failed)
+	}
+	if stats := svc.PoolStats(); stats.Open != 0 {
+		t.Errorf("pool = %+v, want the broken connection discarded", stats)
+	}
+}
@@ -0,0 +1,531 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/metrics"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// ErrSyncNotFound is returned for unknown sync task IDs
+var ErrSyncNotFound = errors.New("sync task not found")
+
+// Sync directions
+const (
+	SyncUpload   = "upload"   // local -> FTP
+	SyncDownload = "download" // FTP -> local
+)
+
+// SyncOptions describes a mirror between a local and an FTP directory
+type SyncOptions struct {
+	Local     string
+	Remote    string
+	Direction string   // SyncUpload (default) or SyncDownload
+	DryRun    bool     // Only plan, change nothing
+	Delete    bool     // Remove destination entries missing from the source
+	Include   []string // Only files matching one of these globs (default: all); directories follow their files
+	Exclude   []string // Skip (and never delete) entries matching these globs
+}
+
+// SyncTask is the state of an async sync, polled through /api/ftp/sync/:id
+type SyncTask struct {
+	ID        string       `json:"id"`
+	Status    string       `json:"status" enum:"running,done,error"`
+	Direction string       `json:"direction" enum:"upload,download"`
+	Local     string       `json:"local"`
+	Remote    string       `json:"remote"`
+	DryRun    bool         `json:"dry_run"`
+	Progress  SyncProgress `json:"progress"`
+	Actions   []SyncAction `json:"actions"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	DoneAt    *time.Time   `json:"done_at,omitempty"`
+}
+
+// SyncProgress counts planned and completed actions
+type SyncProgress struct {
+	Total      int   `json:"total"`
+	Done       int   `json:"done"`
+	Failed     int   `json:"failed"`
+	Bytes      int64 `json:"bytes"`       // Bytes copied so far
+	TotalBytes int64 `json:"total_bytes"` // Bytes to copy
+}
+
+// SyncAction is one planned change to the destination
+type SyncAction struct {
+	Op     string `json:"op" enum:"mkdir,copy,delete"`
+	Path   string `json:"path"` // Relative to both roots
+	Size   int64  `json:"size,omitempty"`
+	Status string `json:"status" enum:"planned,pending,done,failed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// syncEntry is a file or directory found on either side
+type syncEntry struct {
+	isDir bool
+	size  int64
+	mtime time.Time
+}
+
+// syncRetention is how long finished syncs can still be polled
+const syncRetention = 24 * time.Hour
+
+type syncStore struct {
+	mu      sync.Mutex
+	counter int64
+	tasks   map[string]*SyncTask
+}
+
+// update runs fn with the store locked, for changes to a running task
+func (ss *syncStore) update(fn func()) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	fn()
+}
+
+// StartSync validates opts and runs the sync in the background. ctx only
+// supplies the logger: the sync outlives the request that started it.
+func (s *Service) StartSync(ctx context.Context, opts SyncOptions) (SyncTask, error) {
+	if opts.Direction == "" {
+		opts.Direction = SyncUpload
+	}
+	if opts.Direction != SyncUpload && opts.Direction != SyncDownload {
+		return SyncTask{}, fmt.Errorf("unknown sync direction %q", opts.Direction)
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return SyncTask{}, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+	opts.Local = filepath.Clean(opts.Local)
+	opts.Remote = path.Clean(opts.Remote)
+
+	ss := &s.syncs
+	ss.mu.Lock()
+	now := time.Now()
+	if ss.tasks == nil {
+		ss.tasks = map[string]*SyncTask{}
+	}
+	for id, t := range ss.tasks {
+		if t.DoneAt != nil && now.Sub(*t.DoneAt) > syncRetention {
+			delete(ss.tasks, id)
+			metrics.AsyncTasks.WithLabelValues(t.Status).Dec()
+		}
+	}
+	ss.counter++
+	task := &SyncTask{
+		ID:        fmt.Sprintf("sync_%d_%d", now.Unix(), ss.counter),
+		Status:    "running",
+		Direction: opts.Direction,
+		Local:     opts.Local,
+		Remote:    opts.Remote,
+		DryRun:    opts.DryRun,
+		Actions:   []SyncAction{},
+		CreatedAt: now,
+	}
+	ss.tasks[task.ID] = task
+	snapshot := task.copy()
+	ss.mu.Unlock()
+
+	metrics.AsyncTasks.WithLabelValues("running").Inc()
+	log := s.logger(ctx)
+	log.Infow("FTP sync started", "task_id", task.ID, "direction", opts.Direction, "local", opts.Local, "remote", opts.Remote)
+
+	go func() {
+		err := s.runSync(task, opts)
+		now := time.Now()
+		ss.update(func() {
+			task.DoneAt = &now
+			if err != nil {
+				task.Status = "error"
+				task.Error = err.Error()
+			} else {
+				task.Status = "done"
+			}
+		})
+		metrics.AsyncTasks.WithLabelValues("running").Dec()
+		metrics.AsyncTasks.WithLabelValues(task.Status).Inc()
+		log.Infow("FTP sync finished", "task_id", task.ID, "status", task.Status, "done", task.Progress.Done, "failed", task.Progress.Failed)
+	}()
+	return snapshot, nil
+}
+
+// SyncTask returns the current state of a sync
+func (s *Service) SyncTask(id string) (SyncTask, error) {
+	s.syncs.mu.Lock()
+	defer s.syncs.mu.Unlock()
+	task, ok := s.syncs.tasks[id]
+	if !ok {
+		return SyncTask{}, fmt.Errorf("%w: %s", ErrSyncNotFound, id)
+	}
+	return task.copy(), nil
+}
+
+func (t *SyncTask) copy() SyncTask {
+	c := *t
+	c.Actions = append([]SyncAction{}, t.Actions...)
+	return c
+}
+
+func (s *Service) runSync(task *SyncTask, opts SyncOptions) error {
+	return s.withConn(func(c *conn) error {
+		local, err := walkLocal(opts.Local)
+		if err != nil && !(errors.Is(err, fs.ErrNotExist) && opts.Direction == SyncDownload) {
+			return fmt.Errorf("read local directory: %w", err)
+		}
+		remote, err := walkRemote(c, opts.Remote)
+		if err != nil && opts.Direction == SyncUpload {
+			// A missing destination is created; anything else is fatal
+			var reply *textproto.Error
+			if !errors.As(err, &reply) {
+				return fmt.Errorf("list remote directory: %w", err)
+			}
+			remote = map[string]syncEntry{}
+		} else if err != nil {
+			return fmt.Errorf("list remote directory: %w", err)
+		}
+
+		src, dst := local, remote
+		if opts.Direction == SyncDownload {
+			src, dst = remote, local
+		}
+		// LIST only has minute precision; MLSD has seconds
+		tolerance := time.Second
+		if !c.IsTimePreciseInList() {
+			tolerance = time.Minute
+		}
+		actions := planSync(src, dst, opts, tolerance)
+
+		s.syncs.update(func() {
+			task.Actions = actions
+			task.Progress.Total = len(actions)
+			for _, a := range actions {
+				task.Progress.TotalBytes += a.Size
+			}
+		})
+		if opts.DryRun {
+			return nil
+		}
+
+		x := &syncExecutor{s: s, c: c, task: task, opts: opts}
+		return x.run()
+	})
+}
+
+// planSync lists the mkdir/copy/delete actions that make dst match src.
+// A file is copied when its size differs or the source is newer. Directories
+// are only created to hold a synced file, and only deleted when nothing below
+// them stays.
+func planSync(src, dst map[string]syncEntry, opts SyncOptions, tolerance time.Duration) []SyncAction {
+	var actions []SyncAction
+
+	// selected reports whether an entry takes part in the sync at all
+	selected := func(rel string, e syncEntry) bool {
+		return !excluded(rel, opts.Exclude) && (e.isDir || included(rel, opts.Include))
+	}
+
+	// Directories that will hold a synced file
+	needed := map[string]bool{}
+	for rel, e := range src {
+		if !e.isDir && selected(rel, e) {
+			markParents(needed, rel)
+		}
+	}
+
+	for _, rel := range sortedKeys(src) {
+		e := src[rel]
+		if !selected(rel, e) || e.isDir && !needed[rel] {
+			continue
+		}
+		d, exists := dst[rel]
+		switch {
+		case e.isDir && (!exists || !d.isDir):
+			actions = append(actions, SyncAction{Op: "mkdir", Path: rel})
+		case !e.isDir && (!exists || d.isDir || d.size != e.size || e.mtime.After(d.mtime.Add(tolerance))):
+			actions = append(actions, SyncAction{Op: "copy", Path: rel, Size: e.size})
+		}
+	}
+
+	if opts.Delete {
+		// Directories holding an entry that stays: excluded, filtered out or
+		// still in the source. Deleting them would take that entry along.
+		kept := map[string]bool{}
+		for rel, e := range dst {
+			if _, inSrc := src[rel]; inSrc || !selected(rel, e) {
+				markParents(kept, rel)
+			}
+		}
+		// Deepest first so directories are empty when they are removed
+		keys := sortedKeys(dst)
+		for i := len(keys) - 1; i >= 0; i-- {
+			rel := keys[i]
+			if _, inSrc := src[rel]; inSrc || !selected(rel, dst[rel]) || kept[rel] {
+				continue
+			}
+			actions = append(actions, SyncAction{Op: "delete", Path: rel})
+		}
+	}
+
+	status := "pending"
+	if opts.DryRun {
+		status = "planned"
+	}
+	for i := range actions {
+		actions[i].Status = status
+	}
+	return actions
+}
+
+// markParents adds every parent directory of rel to dirs
+func markParents(dirs map[string]bool, rel string) {
+	for d := path.Dir(rel); d != "." && d != "/"; d = path.Dir(d) {
+		dirs[d] = true
+	}
+}
+
+// matchGlob matches a pattern against the relative path, or against the base
+// name when the pattern has no slash ("*.log" matches "a/b/c.log")
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(pattern, rel)
+	return ok
+}
+
+// excluded reports whether rel or one of its parent directories matches an exclude glob
+func excluded(rel string, patterns []string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if matchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func included(rel string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]syncEntry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// walkLocal indexes a local tree by slash-separated relative path
+func walkLocal(root string) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		entries[filepath.ToSlash(rel)] = syncEntry{isDir: d.IsDir(), size: info.Size(), mtime: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+// walkRemote indexes a remote tree by relative path. Links are skipped.
+func walkRemote(c *conn, root string) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		list, err := listDir(c, path.Join(root, rel))
+		if err != nil {
+			return err
+		}
+		for _, e := range list {
+			if e.Type == ftp.EntryTypeLink {
+				continue
+			}
+			child := path.Join(rel, e.Name)
+			isDir := e.Type == ftp.EntryTypeFolder
+			entries[child] = syncEntry{isDir: isDir, size: int64(e.Size), mtime: e.Time}
+			if isDir {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return entries, walk("")
+}
+
+// syncExecutor applies planned actions over one FTP connection
+type syncExecutor struct {
+	s    *Service
+	c    *conn
+	task *SyncTask
+	opts SyncOptions
+}
+
+func (x *syncExecutor) run() error {
+	if x.opts.Direction == SyncUpload {
+		if err := mkdirAll(x.c, x.opts.Remote); err != nil {
+			return fmt.Errorf("mkdir failed: %w", err)
+		}
+	} else if err := os.MkdirAll(x.opts.Local, 0755); err != nil {
+		return err
+	}
+
+	for i := range x.task.Actions {
+		var a SyncAction
+		x.s.syncs.update(func() { a = x.task.Actions[i] })
+
+		err := x.apply(a)
+		x.s.syncs.update(func() {
+			if err != nil {
+				x.task.Actions[i].Status = "failed"
+				x.task.Actions[i].Error = err.Error()
+				x.task.Progress.Failed++
+			} else {
+				x.task.Actions[i].Status = "done"
+				x.task.Progress.Done++
+			}
+		})
+
+		// FTP replies and local errors only fail this action; a broken
+		// control connection fails the whole sync
+		var reply *textproto.Error
+		var pathErr *fs.PathError
+		if err != nil && !errors.As(err, &reply) && !errors.As(err, &pathErr) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *syncExecutor) apply(a SyncAction) error {
+	remote := path.Join(x.opts.Remote, a.Path)
+	local := filepath.Join(x.opts.Local, filepath.FromSlash(a.Path))
+
+	switch {
+	case a.Op == "mkdir" && x.opts.Direction == SyncUpload:
+		return x.c.MakeDir(remote)
+	case a.Op == "mkdir":
+		return os.MkdirAll(local, 0755)
+	// Never recursive: the plan deletes children first, and a directory that
+	// still holds something must fail rather than take it along
+	case a.Op == "delete" && x.opts.Direction == SyncUpload:
+		if err := x.c.Delete(remote); err != nil {
+			if dir, dirErr := isDir(x.c, remote); dirErr != nil || !dir {
+				return err
+			}
+			return x.c.RemoveDir(remote)
+		}
+		return nil
+	case a.Op == "delete":
+		return os.Remove(local)
+	case x.opts.Direction == SyncUpload:
+		return x.upload(local, remote)
+	default:
+		return x.download(remote, local)
+	}
+}
+
+func (x *syncExecutor) progress() *progressReader {
+	var last int64
+	return &progressReader{progress: func(n int64) {
+		x.s.syncs.update(func() { x.task.Progress.Bytes += n - last })
+		last = n
+	}}
+}
+
+func (x *syncExecutor) upload(local, remote string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	pr := x.progress()
+	pr.r = f
+	err = x.c.Stor(remote, pr)
+	metrics.FTPBytes.WithLabelValues("upload").Add(float64(pr.n))
+	if err != nil {
+		return err
+	}
+	// Keep the source mtime so the next sync sees the file as unchanged
+	if x.c.IsSetTimeSupported() {
+		_ = x.c.SetTime(remote, info.ModTime())
+	}
+	return nil
+}
+
+func (x *syncExecutor) download(remote, local string) error {
+	r, err := x.c.Retr(remote)
+	if err != nil {
+		return err
+	}
+
+	// Write next to the target and rename, so a failed copy never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(local), ".sync-*")
+	if err != nil {
+		r.Close()
+		return err
+	}
+	pr := x.progress()
+	pr.r = r
+	_, err = io.Copy(tmp, pr)
+	metrics.FTPBytes.WithLabelValues("download").Add(float64(pr.n))
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if x.c.IsGetTimeSupported() {
+		if mtime, err := x.c.GetTime(remote); err == nil {
+			_ = os.Chtimes(local, mtime, mtime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPlanSync(t *testing.T) {
+	now := time.Now()
+	file := syncEntry{size: 1, mtime: now}
+	dir := syncEntry{isDir: true}
+
+	tests := []struct {
+		name     string
+		src, dst map[string]syncEntry
+		opts     SyncOptions
+		want     []string
+	}{
+		{
+			name: "excluded child keeps its directory",
+			dst:  map[string]syncEntry{"cache": dir, "cache/keep.tmp": file, "cache/old": file},
+			opts: SyncOptions{Delete: true, Exclude: []string{"*.tmp"}},
+			want: []string{"delete cache/old"},
+		},
+		{
+			name: "file filtered by include keeps its directory",
+			dst:  map[string]syncEntry{"a": dir, "a/x.txt": file, "a/y.go": file},
+			opts: SyncOptions{Delete: true, Include: []string{"*.go"}},
+			want: []string{"delete a/y.go"},
+		},
+		{
+			name: "emptied directory is deleted after its children",
+			dst:  map[string]syncEntry{"a": dir, "a/b": dir, "a/b/x": file},
+			opts: SyncOptions{Delete: true},
+			want: []string{"delete a/b/x", "delete a/b", "delete a"},
+		},
+		{
+			name: "no mkdir for directories without included files",
+			src:  map[string]syncEntry{"docs": dir, "docs/a.md": file, "src": dir, "src/deep": dir, "src/deep/a.go": file, "empty": dir},
+			opts: SyncOptions{Include: []string{"*.go"}},
+			want: []string{"mkdir src", "mkdir src/deep", "copy src/deep/a.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range planSync(tt.src, tt.dst, tt.opts, time.Second) {
+				got = append(got, a.Op+" "+a.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncRetention(t *testing.T) {
+	_, cfg := serveMemFTP(t)
+	svc := NewService(cfg, zap.NewNop().Sugar())
+	defer svc.Close()
+
+	old, recent := time.Now().Add(-syncRetention-time.Minute), time.Now().Add(-time.Hour)
+	svc.syncs.tasks = map[string]*SyncTask{
+		"expired":  {ID: "expired", Status: "done", DoneAt: &old},
+		"finished": {ID: "finished", Status: "error", DoneAt: &recent},
+		"running":  {ID: "running", Status: "running", CreatedAt: old},
+	}
+
+	task, err := svc.StartSync(context.Background(), SyncOptions{Local: t.TempDir(), Remote: "/", DryRun: true})
+	if err != nil {
+		t.Fatalf("StartSync: %v", err)
+	}
+	id := task.ID
+	for deadline := time.Now().Add(5 * time.Second); task.Status == "running"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("sync did not finish")
+		}
+		if task, err = svc.SyncTask(id); err != nil {
+			t.Fatalf("SyncTask(%s): %v", id, err)
+		}
+	}
+
+	if _, err := svc.SyncTask("expired"); !errors.Is(err, ErrSyncNotFound) {
+		t.Errorf("sync finished %v ago: %v, want %v", syncRetention+time.Minute, err, ErrSyncNotFound)
+	}
+	for _, id := range []string{"finished", "running"} {
+		if _, err := svc.SyncTask(id); err != nil {
+			t.Errorf("SyncTask(%s): %v, want it kept", id, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"ssh-ftp-proxy/internal/config"
+)
+
+// TLS modes accepted in ftp_server.tls_mode
+const (
+	TLSModeNone     = "none"     // Plain FTP
+	TLSModeExplicit = "explicit" // AUTH TLS on the plain control port (FTPES)
+	TLSModeImplicit = "implicit" // TLS from the first byte, usually port 990 (FTPS)
+)
+
+// tlsClientConfig returns the TLS configuration for the configured mode, nil
+// for plain FTP. Data connections are protected too (PROT P).
+func tlsClientConfig(cfg config.FTPConfig) (*tls.Config, error) {
+	switch cfg.TLSMode {
+	case "", TLSModeNone:
+		return nil, nil
+	case TLSModeExplicit, TLSModeImplicit:
+	default:
+		return nil, fmt.Errorf("unknown tls_mode %q (want none, explicit or implicit)", cfg.TLSMode)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.Host,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		// Many servers (vsftpd require_ssl_reuse) insist that data connections
+		// resume the control connection's TLS session
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// isTLSError reports whether err comes from the TLS handshake. With explicit
+// TLS the handshake runs lazily on the first command after AUTH TLS, so it
+// surfaces from Login and would otherwise look like an authentication failure.
+func isTLSError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &verifyErr) || errors.As(err, &alertErr) || errors.As(err, &recordErr)
+}
@@ -0,0 +1,306 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// testPKI is a throwaway CA with a server and a client certificate
+type testPKI struct {
+	caFile                string
+	serverCert            tls.Certificate
+	clientCert, clientKey string
+	caPool                *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p := &testPKI{caPool: x509.NewCertPool()}
+	p.caPool.AddCert(caCert)
+	p.caFile = write("ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	serverPEM, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	if p.serverCert, err = tls.X509KeyPair(serverPEM, serverKey); err != nil {
+		t.Fatal(err)
+	}
+	clientPEM, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	p.clientCert = write("client.pem", clientPEM)
+	p.clientKey = write("client-key.pem", clientKey)
+	return p
+}
+
+// serveFTPS runs a minimal FTP server that speaks just enough of the protocol
+// (login, NOOP, EPSV, PORT, LIST) to exercise implicit and explicit TLS, including
+// protected data connections. It returns the listening port.
+func serveFTPS(t *testing.T, mode string, tlsConfig *tls.Config) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	if mode == TLSModeImplicit {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleFTPS(conn, tlsConfig)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func handleFTPS(conn net.Conn, tlsConfig *tls.Config) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+
+	var data net.Listener
+	var active string // PORT address
+	protected := false
+	reply("220 ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(cmd) {
+		case "AUTH":
+			reply("234 proceed")
+			conn = tls.Server(conn, tlsConfig)
+			r = bufio.NewReader(conn)
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			if arg == "bad" {
+				reply("530 login incorrect")
+			} else {
+				reply("230 logged in")
+			}
+		case "FEAT":
+			reply("211 no features")
+		case "PROT":
+			protected = arg == "P"
+			reply("200 ok")
+		case "TYPE", "OPTS", "PBSZ", "NOOP":
+			reply("200 ok")
+		case "EPSV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 cannot open data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||" + strconv.Itoa(data.Addr().(*net.TCPAddr).Port) + "|)")
+		case "PORT":
+			h := strings.Split(arg, ",")
+			p1, _ := strconv.Atoi(h[4])
+			p2, _ := strconv.Atoi(h[5])
+			active = net.JoinHostPort(strings.Join(h[:4], "."), strconv.Itoa(p1*256+p2))
+			reply("200 PORT ok")
+		case "LIST":
+			reply("150 here it comes")
+			var dc net.Conn
+			if active != "" {
+				dc, err = net.Dial("tcp", active)
+				active = ""
+			} else {
+				dc, err = data.Accept()
+				data.Close()
+			}
+			if err != nil {
+				return
+			}
+			if protected {
+				dc = tls.Server(dc, tlsConfig)
+			}
+			fmt.Fprint(dc, "-rw-r--r-- 1 user group 5 Jan 01 00:00 hello.txt\r\n")
+			dc.Close()
+			reply("226 done")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPTLSModes(t *testing.T) {
+	pki := newTestPKI(t)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{pki.serverCert}}
+
+	for _, mode := range []string{TLSModeExplicit, TLSModeImplicit} {
+		t.Run(mode, func(t *testing.T) {
+			port := serveFTPS(t, mode, serverTLS)
+			svc := NewService(config.FTPConfig{
+				Host: "127.0.0.1", Port: port, User: "u", Password: "p",
+				TLSMode: mode, CAFile: pki.caFile,
+			}, zap.NewNop().Sugar())
+			defer svc.Close()
+
+			if err := svc.Ping(); err != nil {
+				t.Fatalf("Ping: %v", err)
+			}
+			entries, err := svc.List("/", ListOptions{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name != "hello.txt" {
+				t.Errorf("List = %+v, want hello.txt", entries)
+			}
+		})
+	}
+}
+
+func TestFTPTLSVerification(t *testing.T) {
+	pki := newTestPKI(t)
+	port := serveFTPS(t, TLSModeImplicit, &tls.Config{Certificates: []tls.Certificate{pki.serverCert}})
+	base := config.FTPConfig{Host: "127.0.0.1", Port: port, User: "u", Password: "p", TLSMode: TLSModeImplicit}
+
+	// Unknown CA must be rejected as a connection failure
+	err := NewService(base, zap.NewNop().Sugar()).Ping()
+	if !errors.Is(err, ErrConnect) {
+		t.Errorf("untrusted certificate: got %v, want ErrConnect", err)
+	}
+
+	skip := base
+	skip.InsecureSkipVerify = true
+	if err := NewService(skip, zap.NewNop().Sugar()).Ping(); err != nil {
+		t.Errorf("insecure_skip_verify: %v", err)
+	}
+
+	bad := base
+	bad.TLSMode = "starttls"
+	if err := NewService(bad, zap.NewNop().Sugar()).Ping(); !errors.Is(err, ErrConnect) {
+		t.Errorf("unknown tls_mode: got %v, want ErrConnect", err)
+	}
+}
+
+func TestFTPTLSExplicitUntrusted(t *testing.T) {
+	pki := newTestPKI(t)
+	port := serveFTPS(t, TLSModeExplicit, &tls.Config{Certificates: []tls.Certificate{pki.serverCert}})
+
+	// The handshake only happens on the first command after AUTH TLS; it must
+	// still be reported as a connection failure rather than a login failure
+	err := NewService(config.FTPConfig{Host: "127.0.0.1", Port: port, User: "u", Password: "p", TLSMode: TLSModeExplicit}, zap.NewNop().Sugar()).Ping()
+	if !errors.Is(err, ErrConnect) || errors.Is(err, ErrAuth) {
+		t.Errorf("got %v, want ErrConnect", err)
+	}
+}
+
+func TestFTPTLSClientCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	port := serveFTPS(t, TLSModeImplicit, &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.caPool,
+	})
+	cfg := config.FTPConfig{
+		Host: "127.0.0.1", Port: port, User: "u", Password: "p",
+		TLSMode: TLSModeImplicit, CAFile: pki.caFile,
+	}
+
+	if err := NewService(cfg, zap.NewNop().Sugar()).Ping(); err == nil {
+		t.Error("server requiring a client certificate accepted a client without one")
+	}
+
+	cfg.CertFile, cfg.KeyFile = pki.clientCert, pki.clientKey
+	if err := NewService(cfg, zap.NewNop().Sugar()).Ping(); err != nil {
+		t.Errorf("with client certificate: %v", err)
+	}
+}
+
+func TestFTPActiveMode(t *testing.T) {
+	pki := newTestPKI(t)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{pki.serverCert}}
+
+	for _, mode := range []string{TLSModeNone, TLSModeExplicit} {
+		t.Run(mode, func(t *testing.T) {
+			port := serveFTPS(t, mode, serverTLS)
+			svc := NewService(config.FTPConfig{
+				Host: "127.0.0.1", Port: port, User: "u", Password: "p",
+				TLSMode: mode, CAFile: pki.caFile, Active: true,
+			}, zap.NewNop().Sugar())
+			defer svc.Close()
+
+			entries, err := svc.List("/", ListOptions{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name != "hello.txt" {
+				t.Errorf("List = %+v, want hello.txt", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/metrics"
+)
+
+var (
+	// ErrTransferNotFound is returned for unknown or expired transfer IDs
+	ErrTransferNotFound = errors.New("transfer not found")
+	// ErrTransferConflict is returned when a transfer cannot be resumed by a request
+	ErrTransferConflict = errors.New("transfer cannot be resumed")
+)
+
+// transferRetention is how long finished transfers stay resumable
+const transferRetention = 24 * time.Hour
+
+// Transfer records the progress of an upload or download so an interrupted
+// transfer can be resumed by a follow-up request carrying its ID.
+type Transfer struct {
+	ID        string    `json:"id"`
+	Direction string    `json:"direction" enum:"upload,download"`
+	Path      string    `json:"path"`
+	Offset    int64     `json:"offset"`         // Bytes transferred so far; the next request resumes here
+	Size      int64     `json:"size,omitempty"` // Total size, when known
+	Status    string    `json:"status" enum:"running,partial,done,failed"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// transferStore keeps transfers in memory; they do not survive a restart
+type transferStore struct {
+	mu      sync.Mutex
+	counter int64
+	items   map[string]*Transfer
+}
+
+// begin marks a transfer as running, creating it when id is empty
+func (ts *transferStore) begin(id, direction, path string) (Transfer, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := time.Now()
+	if ts.items == nil {
+		ts.items = map[string]*Transfer{}
+	}
+	for key, t := range ts.items {
+		if t.Status != "running" && now.Sub(t.UpdatedAt) > transferRetention {
+			delete(ts.items, key)
+		}
+	}
+
+	if id == "" {
+		ts.counter++
+		t := &Transfer{
+			ID:        fmt.Sprintf("transfer_%d_%d", now.Unix(), ts.counter),
+			Direction: direction,
+			Path:      path,
+			Status:    "running",
+			UpdatedAt: now,
+		}
+		ts.items[t.ID] = t
+		return *t, nil
+	}
+
+	t, ok := ts.items[id]
+	if !ok {
+		return Transfer{}, fmt.Errorf("%w: %s", ErrTransferNotFound, id)
+	}
+	switch {
+	case t.Status == "running":
+		return Transfer{}, fmt.Errorf("%w: %s is still running", ErrTransferConflict, id)
+	case t.Direction != direction || t.Path != path:
+		return Transfer{}, fmt.Errorf("%w: %s is a %s of %s", ErrTransferConflict, id, t.Direction, t.Path)
+	}
+	t.Status = "running"
+	t.Error = ""
+	t.UpdatedAt = now
+	return *t, nil
+}
+
+// update applies fn to a transfer and returns a copy of the result
+func (ts *transferStore) update(id string, fn func(t *Transfer)) Transfer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t := ts.items[id]
+	fn(t)
+	t.UpdatedAt = time.Now()
+	return *t
+}
+
+// finish records the final offset and status of a request
+func (ts *transferStore) finish(id string, offset int64, err error) Transfer {
+	return ts.update(id, func(t *Transfer) {
+		t.Offset = offset
+		switch {
+		case err != nil:
+			t.Status = "failed"
+			t.Error = err.Error()
+		case t.Size > 0 && offset < t.Size:
+			t.Status = "partial"
+		default:
+			t.Status = "done"
+		}
+	})
+}
+
+func (ts *transferStore) get(id string) (Transfer, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.items[id]
+	if !ok {
+		return Transfer{}, false
+	}
+	return *t, true
+}
+
+// progressReader reports every chunk read so transfer progress is visible live
+type progressReader struct {
+	r        io.Reader
+	n        int64
+	progress func(n int64)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.n += int64(n)
+		p.progress(p.n)
+	}
+	return n, err
+}
+
+// Transfer returns the current state of a transfer
+func (s *Service) Transfer(id string) (Transfer, error) {
+	t, ok := s.transfers.get(id)
+	if !ok {
+		return Transfer{}, fmt.Errorf("%w: %s", ErrTransferNotFound, id)
+	}
+	return t, nil
+}
+
+// UploadOptions controls where an upload starts
+type UploadOptions struct {
+	TransferID string // Resume this transfer from its recorded offset
+	Offset     int64  // Write from this byte (REST + STOR); overrides the transfer offset
+	Append     bool   // Append to the remote file (APPE)
+	Size       int64  // Expected total size, for progress reporting
+}
+
+// UploadFrom streams r to the remote path. The returned transfer is valid
+// (and records where to resume) even when the upload fails.
+func (s *Service) UploadFrom(p string, r io.Reader, opts UploadOptions) (Transfer, error) {
+	t, err := s.transfers.begin(opts.TransferID, "upload", p)
+	if err != nil {
+		return Transfer{}, err
+	}
+	start := opts.Offset
+	if start == 0 && opts.TransferID != "" {
+		start = t.Offset
+	}
+	s.transfers.update(t.ID, func(t *Transfer) {
+		t.Offset = start
+		if opts.Size > 0 {
+			t.Size = opts.Size
+		}
+	})
+
+	pr := &progressReader{r: r, progress: func(n int64) {
+		s.transfers.update(t.ID, func(t *Transfer) { t.Offset = start + n })
+	}}
+	err = s.withConn(func(c *conn) error {
+		var err error
+		switch {
+		case opts.Append:
+			err = c.Append(p, pr)
+		case start > 0:
+			err = c.StorFrom(p, pr, uint64(start))
+		default:
+			err = c.Stor(p, pr)
+		}
+		if err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		return nil
+	})
+	metrics.FTPBytes.WithLabelValues("upload").Add(float64(pr.n))
+
+	if err != nil {
+		// Bytes sent are not necessarily bytes stored: ask the server where to
+		// resume. APPE has no offset to ask about; count what was sent.
+		offset := start + pr.n
+		if !opts.Append {
+			if size, sizeErr := s.remoteSize(p); sizeErr == nil {
+				offset = size
+			}
+		}
+		return s.transfers.finish(t.ID, offset, err), err
+	}
+	return s.transfers.finish(t.ID, start+pr.n, nil), nil
+}
+
+// DownloadOptions selects the byte range of a download
+type DownloadOptions struct {
+	TransferID string // Resume this transfer from its recorded offset
+	Offset     int64  // Start at this byte (REST + RETR); overrides the transfer offset
+	Length     int64  // Read at most this many bytes (0 = to the end)
+}
+
+// DownloadRange reads a remote file from an offset, optionally limited to a
+// number of bytes so large files can be fetched in chunks.
+func (s *Service) DownloadRange(p string, opts DownloadOptions) ([]byte, Transfer, error) {
+	t, err := s.transfers.begin(opts.TransferID, "download", p)
+	if err != nil {
+		return nil, Transfer{}, err
+	}
+	start := opts.Offset
+	if start == 0 && opts.TransferID != "" {
+		start = t.Offset
+	}
+	s.transfers.update(t.ID, func(t *Transfer) { t.Offset = start })
+
+	connPool, pc, err := s.checkout()
+	if err != nil {
+		return nil, s.transfers.finish(t.ID, start, err), err
+	}
+
+	// The total size lets clients tell a finished transfer from a partial one
+	if size, err := pc.FileSize(p); err == nil {
+		s.transfers.update(t.ID, func(t *Transfer) { t.Size = size })
+	}
+
+	r, err := pc.RetrFrom(p, uint64(start))
+	if err != nil {
+		connPool.put(pc, err)
+		err = fmt.Errorf("download failed: %w", err)
+		return nil, s.transfers.finish(t.ID, start, err), err
+	}
+
+	var src io.Reader = r
+	if opts.Length > 0 {
+		src = io.LimitReader(r, opts.Length)
+	}
+	pr := &progressReader{r: src, progress: func(n int64) {
+		s.transfers.update(t.ID, func(t *Transfer) { t.Offset = start + n })
+	}}
+	buf, err := io.ReadAll(pr)
+	// Close reads the end-of-transfer reply. The data is complete either way
+	// (a server aborting a transfer we cut short replies 426), but the
+	// connection is only reusable if that reply arrived.
+	if closeErr := r.Close(); err == nil {
+		connPool.put(pc, closeErr)
+	} else {
+		connPool.put(pc, err)
+	}
+	metrics.FTPBytes.WithLabelValues("download").Add(float64(len(buf)))
+	if err != nil {
+		// The partial data is not returned, so the resume point stays at start
+		err = fmt.Errorf("read failed: %w", err)
+		return nil, s.transfers.finish(t.ID, start, err), err
+	}
+	return buf, s.transfers.finish(t.ID, start+int64(len(buf)), nil), nil
+}
+
+// remoteSize returns the size of a remote file (SIZE)
+func (s *Service) remoteSize(p string) (int64, error) {
+	var size int64
+	err := s.withConn(func(c *conn) error {
+		var err error
+		size, err = c.FileSize(p)
+		return err
+	})
+	return size, err
+}
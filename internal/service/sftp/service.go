@@ -0,0 +1,340 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/metrics"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSubsystem is matched when the SSH server does not offer the sftp subsystem
+var ErrSubsystem = errors.New("sftp subsystem unavailable")
+
+// ClientProvider hands out a pooled, authenticated SSH connection together
+// with a reserved session slot, freed by release
+type ClientProvider interface {
+	Acquire() (client *ssh.Client, release func(), err error)
+}
+
+// Service runs SFTP over the connections of the ssh service instead of
+// dialing again. One SFTP session is kept open; it holds a session slot on
+// its connection and is reopened elsewhere when that connection drops.
+type Service struct {
+	ssh ClientProvider
+	log *zap.SugaredLogger
+
+	mu      sync.Mutex
+	client  *sftp.Client
+	release func()
+}
+
+func NewService(provider ClientProvider, log *zap.SugaredLogger) *Service {
+	return &Service{ssh: provider, log: log}
+}
+
+// FileInfo describes a remote file. Links are reported, not followed.
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Type    string    `json:"type" enum:"file,dir,link"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"` // Permission bits in octal, e.g. "0644"
+	ModTime time.Time `json:"mod_time"`
+	UID     uint32    `json:"uid"`
+	GID     uint32    `json:"gid"`
+	Target  string    `json:"target,omitempty"` // Link target (stat only)
+}
+
+func newFileInfo(p string, fi os.FileInfo) FileInfo {
+	info := FileInfo{
+		Name:    fi.Name(),
+		Path:    p,
+		Type:    "file",
+		Size:    fi.Size(),
+		Mode:    FormatMode(fi.Mode()),
+		ModTime: fi.ModTime(),
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		info.Type = "link"
+	case fi.IsDir():
+		info.Type = "dir"
+	}
+	if stat, ok := fi.Sys().(*sftp.FileStat); ok {
+		info.UID, info.GID = stat.UID, stat.GID
+	}
+	return info
+}
+
+// FormatMode renders permission bits, including setuid, setgid and sticky, in octal
+func FormatMode(m os.FileMode) string {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// ParseMode reads octal permission bits such as "755" or "4755"
+func ParseMode(s string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || bits > 07777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// withClient runs fn on the SFTP session, opening it first if needed. A
+// session that lost its connection is dropped so the next call reopens it.
+func (s *Service) withClient(fn func(c *sftp.Client) error) error {
+	c, err := s.session()
+	if err != nil {
+		return err
+	}
+	err = fn(c)
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) {
+		s.drop(c)
+	}
+	return err
+}
+
+func (s *Service) session() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	conn, release, err := s.ssh.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%w: %w", ErrSubsystem, err)
+	}
+	s.client, s.release = client, release
+	// Drop the session as soon as its connection goes away
+	go func() {
+		conn.Wait()
+		s.drop(client)
+	}()
+	return client, nil
+}
+
+// drop closes c and frees its session slot, unless it was already replaced
+func (s *Service) drop(c *sftp.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != c {
+		return
+	}
+	c.Close()
+	s.release()
+	s.client, s.release = nil, nil
+}
+
+// Close ends the SFTP session; the SSH connection stays open
+func (s *Service) Close() {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+	if c != nil {
+		s.drop(c)
+	}
+}
+
+func (s *Service) List(p string) ([]FileInfo, error) {
+	result := []FileInfo{}
+	err := s.withClient(func(c *sftp.Client) error {
+		entries, err := c.ReadDir(p)
+		if err != nil {
+			return fmt.Errorf("list failed: %w", err)
+		}
+		for _, fi := range entries {
+			result = append(result, newFileInfo(path.Join(p, fi.Name()), fi))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Stat describes p itself; for a link that includes its target
+func (s *Service) Stat(p string) (*FileInfo, error) {
+	var info FileInfo
+	err := s.withClient(func(c *sftp.Client) error {
+		fi, err := c.Lstat(p)
+		if err != nil {
+			return fmt.Errorf("stat failed: %w", err)
+		}
+		info = newFileInfo(p, fi)
+		if info.Type == "link" {
+			info.Target, _ = c.ReadLink(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Upload writes r to p, replacing it. mode, when non-zero, is applied
+// afterwards. ctx carries the logger of the request.
+func (s *Service) Upload(ctx context.Context, p string, r io.Reader, mode os.FileMode) (int64, error) {
+	var n int64
+	err := s.withClient(func(c *sftp.Client) error {
+		f, err := c.Create(p)
+		if err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		n, err = f.ReadFrom(r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		if mode != 0 {
+			if err := c.Chmod(p, mode); err != nil {
+				return fmt.Errorf("chmod failed: %w", err)
+			}
+		}
+		return nil
+	})
+	metrics.SFTPBytes.WithLabelValues("upload").Add(float64(n))
+	if err == nil {
+		logger.FromContext(ctx, s.log).Infow("File uploaded to sftp", "path", p, "size", n)
+	}
+	return n, err
+}
+
+func (s *Service) Download(p string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.withClient(func(c *sftp.Client) error {
+		f, err := c.Open(p)
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteTo(&buf); err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		return nil
+	})
+	metrics.SFTPBytes.WithLabelValues("download").Add(float64(buf.Len()))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Mkdir creates p, with its parents when parents is set
+func (s *Service) Mkdir(p string, parents bool) error {
+	return s.withClient(func(c *sftp.Client) error {
+		var err error
+		if parents {
+			err = c.MkdirAll(p)
+		} else {
+			err = c.Mkdir(p)
+		}
+		if err != nil {
+			return fmt.Errorf("mkdir failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// Rename moves src to dst, replacing dst when the server supports it
+func (s *Service) Rename(src, dst string) error {
+	return s.withClient(func(c *sftp.Client) error {
+		err := c.PosixRename(src, dst)
+		var status *sftp.StatusError
+		if errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxOpUnsupported {
+			// No posix-rename@openssh.com extension: plain rename fails if dst exists
+			err = c.Rename(src, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("rename failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// Remove deletes a file, link or empty directory; recursive also removes
+// directory contents
+func (s *Service) Remove(p string, recursive bool) error {
+	return s.withClient(func(c *sftp.Client) error {
+		var err error
+		if recursive {
+			err = c.RemoveAll(p)
+		} else {
+			err = c.Remove(p)
+		}
+		if err != nil {
+			return fmt.Errorf("remove failed: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *Service) Chmod(p string, mode os.FileMode) error {
+	return s.withClient(func(c *sftp.Client) error {
+		if err := c.Chmod(p, mode); err != nil {
+			return fmt.Errorf("chmod failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// Symlink creates link pointing at target
+func (s *Service) Symlink(target, link string) error {
+	return s.withClient(func(c *sftp.Client) error {
+		if err := c.Symlink(target, link); err != nil {
+			return fmt.Errorf("symlink failed: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *Service) Readlink(p string) (string, error) {
+	var target string
+	err := s.withClient(func(c *sftp.Client) error {
+		var err error
+		if target, err = c.ReadLink(p); err != nil {
+			return fmt.Errorf("readlink failed: %w", err)
+		}
+		return nil
+	})
+	return target, err
+}
@@ -0,0 +1,231 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// testProvider hands out one connection to an in-process sshd whose sftp
+// subsystem serves sftp.InMemHandler, counting the slots it reserves
+type testProvider struct {
+	client   *ssh.Client
+	acquired atomic.Int32
+	released atomic.Int32
+}
+
+func (p *testProvider) Acquire() (*ssh.Client, func(), error) {
+	p.acquired.Add(1)
+	return p.client, func() { p.released.Add(1) }, nil
+}
+
+func newTestService(t *testing.T) (*Service, *testProvider) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	handlers := sftp.InMemHandler()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(nc, serverConfig, handlers)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	p := &testProvider{client: client}
+	s := NewService(p, zap.NewNop().Sugar())
+	t.Cleanup(s.Close)
+	return s, p
+}
+
+func serveSFTP(nc net.Conn, serverConfig *ssh.ServerConfig, handlers sftp.Handlers) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, serverConfig)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, chReqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range chReqs {
+				// Payload is the length-prefixed subsystem name
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						server := sftp.NewRequestServer(ch, handlers)
+						server.Serve()
+						server.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		s    string
+		mode os.FileMode
+	}{
+		{"0644", 0644},
+		{"0755", 0755},
+		{"4755", os.ModeSetuid | 0755},
+		{"2750", os.ModeSetgid | 0750},
+		{"1777", os.ModeSticky | 0777},
+		{"7000", os.ModeSetuid | os.ModeSetgid | os.ModeSticky},
+	}
+	for _, tt := range tests {
+		if got := FormatMode(tt.mode); got != tt.s {
+			t.Errorf("FormatMode(%v) = %q, want %q", tt.mode, got, tt.s)
+		}
+		if got, err := ParseMode(tt.s); err != nil || got != tt.mode {
+			t.Errorf("ParseMode(%q) = %v, %v, want %v", tt.s, got, err, tt.mode)
+		}
+	}
+
+	// Leading zeros are optional; the type bits are not permissions
+	if got, err := ParseMode("755"); err != nil || got != 0755 {
+		t.Errorf("ParseMode(755) = %v, %v, want 0755", got, err)
+	}
+	if got := FormatMode(os.ModeDir | 0700); got != "0700" {
+		t.Errorf("FormatMode(dir 0700) = %q, want 0700", got)
+	}
+	for _, s := range []string{"", "rwx", "9", "-1", "10000"} {
+		if _, err := ParseMode(s); err == nil {
+			t.Errorf("ParseMode(%q) accepted", s)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	s, p := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.Mkdir("/srv/app", true); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := s.Mkdir("/srv/empty", false); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if n, err := s.Upload(ctx, "/srv/app/config.yml", strings.NewReader("port: 80\n"), 0); err != nil || n != 9 {
+		t.Fatalf("Upload = %d, %v, want 9 bytes", n, err)
+	}
+
+	// List
+	files, err := s.List("/srv/app")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "config.yml" || files[0].Path != "/srv/app/config.yml" ||
+		files[0].Type != "file" || files[0].Size != 9 || files[0].Mode != "0644" {
+		t.Errorf("List = %+v, want config.yml", files)
+	}
+	empty, err := s.List("/srv/empty")
+	if err != nil {
+		t.Fatalf("List of an empty directory: %v", err)
+	}
+	if data, _ := json.Marshal(empty); string(data) != "[]" {
+		t.Errorf("empty directory serialized as %s, want []", data)
+	}
+	if _, err := s.List("/missing"); err == nil || !strings.HasPrefix(err.Error(), "list failed: ") {
+		t.Errorf("List of a missing directory: %v, want list failed", err)
+	}
+
+	// Stat
+	info, err := s.Stat("/srv/app")
+	if err != nil || info.Type != "dir" || info.Name != "app" {
+		t.Errorf("Stat(dir) = %+v, %v, want dir app", info, err)
+	}
+	if _, err := s.Stat("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing path: %v, want %v", err, os.ErrNotExist)
+	}
+
+	// Symlink
+	if err := s.Symlink("/srv/app/config.yml", "/srv/current"); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	info, err = s.Stat("/srv/current")
+	if err != nil || info.Type != "link" || info.Target != "/srv/app/config.yml" {
+		t.Errorf("Stat(link) = %+v, %v, want a link to /srv/app/config.yml", info, err)
+	}
+	if target, err := s.Readlink("/srv/current"); err != nil || target != "/srv/app/config.yml" {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+
+	// Rename
+	if err := s.Rename("/srv/app/config.yml", "/srv/app/app.yml"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := s.Stat("/srv/app/config.yml"); err == nil {
+		t.Error("renamed file still exists under its old name")
+	}
+	if content, err := s.Download("/srv/app/app.yml"); err != nil || string(content) != "port: 80\n" {
+		t.Errorf("Download after rename = %q, %v", content, err)
+	}
+
+	// Remove
+	if err := s.Remove("/srv/app", false); err == nil {
+		t.Error("non-recursive Remove deleted a non-empty directory")
+	}
+	if err := s.Remove("/srv/current", false); err != nil {
+		t.Errorf("Remove(link): %v", err)
+	}
+	if err := s.Remove("/srv/app", true); err != nil {
+		t.Fatalf("recursive Remove: %v", err)
+	}
+	if files, err := s.List("/srv"); err != nil || len(files) != 1 || files[0].Name != "empty" {
+		t.Errorf("List after removal = %+v, %v, want only empty", files, err)
+	}
+
+	// One session served every call and gives its slot back on Close
+	s.Close()
+	if acquired, released := p.acquired.Load(), p.released.Load(); acquired != 1 || released != 1 {
+		t.Errorf("acquired %d, released %d session slots, want 1 each", acquired, released)
+	}
+}
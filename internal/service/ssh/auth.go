@@ -0,0 +1,194 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// hopAuth is what one hop is offered, plus the agent connection backing it
+type hopAuth struct {
+	methods []ssh.AuthMethod
+	offered []string // Methods as described in auth errors, in the order tried
+
+	agent     agent.ExtendedAgent
+	agentConn net.Conn
+}
+
+// newHopAuth loads the credentials of auth. A key, certificate or agent that
+// is configured but unusable fails the dial rather than being skipped, so the
+// error names the real cause instead of a bare "unable to authenticate".
+// withAgent connects to the agent even when its keys are not offered, for
+// forwarding.
+func newHopAuth(auth config.SSHAuth, withAgent bool) (*hopAuth, error) {
+	a := &hopAuth{}
+	var signers []ssh.Signer
+	var keys []string
+
+	if auth.KeyFile != "" {
+		signer, err := loadKey(auth.KeyFile, auth.KeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		certFile := auth.CertFile
+		if certFile == "" {
+			// Picked up next to the key, as ssh does
+			if _, err := os.Stat(auth.KeyFile + "-cert.pub"); err == nil {
+				certFile = auth.KeyFile + "-cert.pub"
+			}
+		}
+		if certFile != "" {
+			cert, err := loadCert(certFile, signer)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, cert)
+			keys = append(keys, "certificate "+certFile)
+		}
+		signers = append(signers, signer)
+		keys = append(keys, "key "+auth.KeyFile)
+	} else if auth.CertFile != "" {
+		return nil, authConfigError(fmt.Errorf("cert_file %s: key_file is required", auth.CertFile))
+	}
+
+	if auth.UseAgent || withAgent {
+		if err := a.connectAgent(); err != nil {
+			return nil, err
+		}
+	}
+	if auth.UseAgent {
+		agentSigners, err := a.agent.Signers()
+		if err != nil {
+			a.close()
+			return nil, authConfigError(fmt.Errorf("ssh agent: %w", err))
+		}
+		signers = append(signers, agentSigners...)
+		keys = append(keys, fmt.Sprintf("agent: %d keys", len(agentSigners)))
+	}
+
+	// Each method is tried once, so all keys go in one publickey method
+	if len(signers) > 0 {
+		a.methods = append(a.methods, ssh.PublicKeys(signers...))
+	}
+	if len(keys) > 0 {
+		a.offered = append(a.offered, "publickey ("+strings.Join(keys, ", ")+")")
+	}
+	if auth.Password != "" {
+		// keyboard-interactive covers servers that disable password but still
+		// ask for it, e.g. through PAM
+		a.methods = append(a.methods,
+			ssh.Password(auth.Password),
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					answers[i] = auth.Password
+				}
+				return answers, nil
+			}),
+		)
+		a.offered = append(a.offered, "password", "keyboard-interactive")
+	}
+
+	if len(a.offered) == 0 {
+		a.close()
+		return nil, authConfigError(errors.New("no credentials configured: set password, key_file or use_agent"))
+	}
+	return a, nil
+}
+
+func (a *hopAuth) connectAgent() error {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return authConfigError(errors.New("ssh agent: SSH_AUTH_SOCK is not set"))
+	}
+	conn, err := net.DialTimeout("unix", sock, dialTimeout)
+	if err != nil {
+		return authConfigError(fmt.Errorf("ssh agent: %w", err))
+	}
+	a.agent, a.agentConn = agent.NewClient(conn), conn
+	return nil
+}
+
+// forwardAgent serves agent requests from sessions of client with the local
+// agent until client closes
+func (a *hopAuth) forwardAgent(client *ssh.Client) error {
+	if err := agent.ForwardToAgent(client, a.agent); err != nil {
+		return err
+	}
+	conn := a.agentConn
+	a.agentConn = nil
+	go func() {
+		client.Wait()
+		conn.Close()
+	}()
+	return nil
+}
+
+// close drops the agent connection unless it was handed to forwardAgent
+func (a *hopAuth) close() {
+	if a.agentConn != nil {
+		a.agentConn.Close()
+		a.agentConn = nil
+	}
+}
+
+// failed adds the methods offered to an authentication failure
+func (a *hopAuth) failed(err error) error {
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return fmt.Errorf("%w; offered %s", err, strings.Join(a.offered, ", "))
+	}
+	return err
+}
+
+func loadKey(path, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, authConfigError(fmt.Errorf("key_file: %w", err))
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case errors.As(err, &missing) && passphrase == "":
+		return nil, authConfigError(fmt.Errorf("key_file %s is encrypted: set key_passphrase", path))
+	case errors.As(err, &missing):
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+		if err != nil {
+			return nil, authConfigError(fmt.Errorf("key_file %s: %w", path, err))
+		}
+	case err != nil:
+		return nil, authConfigError(fmt.Errorf("key_file %s: %w", path, err))
+	}
+	return signer, nil
+}
+
+// loadCert pairs an OpenSSH user certificate with its private key
+func loadCert(path string, signer ssh.Signer) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, authConfigError(fmt.Errorf("cert_file: %w", err))
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, authConfigError(fmt.Errorf("cert_file %s: %w", path, err))
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, authConfigError(fmt.Errorf("cert_file %s: not a certificate", path))
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, authConfigError(fmt.Errorf("cert_file %s: %w", path, err))
+	}
+	return certSigner, nil
+}
+
+func authConfigError(err error) error {
+	return &connectError{kind: ErrAuth, err: err}
+}
@@ -0,0 +1,200 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeKey writes a new ed25519 key in OpenSSH format, encrypted when
+// passphrase is set, and returns its path and public key
+func writeKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, sshPub
+}
+
+// acceptKey makes a test server accept user "test" with exactly key
+func acceptKey(key ssh.PublicKey) func(*ssh.ServerConfig) {
+	return func(serverConfig *ssh.ServerConfig) {
+		serverConfig.PublicKeyCallback = func(c ssh.ConnMetadata, offered ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "test" && bytes.Equal(offered.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		}
+	}
+}
+
+func addr(cfg config.SSHConfig) string {
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
+
+func TestAuthEncryptedKey(t *testing.T) {
+	keyFile, pub := writeKey(t, "secret")
+	_, cfg := serveSSHAuth(t, 0, acceptKey(pub))
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantErr    string
+	}{
+		{name: "right passphrase", passphrase: "secret"},
+		{name: "wrong passphrase", passphrase: "guess", wantErr: "key_file " + keyFile + ": x509: decryption password incorrect"},
+		{name: "no passphrase", wantErr: "key_file " + keyFile + " is encrypted: set key_passphrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := config.SSHAuth{User: "test", KeyFile: keyFile, KeyPassphrase: tt.passphrase}
+			client, err := dialHop(nil, hop{addr: addr(cfg), auth: auth})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				client.Close()
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr || !errors.Is(err, ErrAuth) {
+				t.Fatalf("dial error = %v, want ErrAuth %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthCertificate(t *testing.T) {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool { return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal()) },
+	}
+	_, cfg := serveSSHAuth(t, 0, func(serverConfig *ssh.ServerConfig) {
+		serverConfig.PublicKeyCallback = checker.Authenticate
+	})
+
+	// The plain key alone is not trusted by the server
+	keyFile, pub := writeKey(t, "")
+	auth := config.SSHAuth{User: "test", KeyFile: keyFile}
+	if _, err := dialHop(nil, hop{addr: addr(cfg), auth: auth}); !errors.Is(err, ErrAuth) {
+		t.Fatalf("dial without a certificate: %v, want ErrAuth", err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           "test",
+		ValidPrincipals: []string{"test"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Picked up next to the key without cert_file
+	client, err := dialHop(nil, hop{addr: addr(cfg), auth: auth})
+	if err != nil {
+		t.Fatalf("dial with %s-cert.pub: %v", keyFile, err)
+	}
+	client.Close()
+
+	// An explicit cert_file that is not a certificate fails the dial
+	auth.CertFile = keyFile
+	if _, err := dialHop(nil, hop{addr: addr(cfg), auth: auth}); err == nil || !strings.Contains(err.Error(), "cert_file "+keyFile) {
+		t.Errorf("dial with a private key as cert_file: %v, want a cert_file error", err)
+	}
+}
+
+func TestAuthKeyboardInteractive(t *testing.T) {
+	_, cfg := serveSSHAuth(t, 0, func(serverConfig *ssh.ServerConfig) {
+		serverConfig.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) == 1 && answers[0] == "pw" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		}
+	})
+
+	client, err := dialHop(nil, hop{addr: addr(cfg), auth: config.SSHAuth{User: "test", Password: "pw"}})
+	if err != nil {
+		t.Fatalf("dial with a password against keyboard-interactive only: %v", err)
+	}
+	client.Close()
+}
+
+func TestAuthFailureListsMethods(t *testing.T) {
+	_, cfg := serveSSH(t, 0)
+	keyFile, _ := writeKey(t, "")
+
+	tests := []struct {
+		name string
+		auth config.SSHAuth
+		want string
+	}{
+		{
+			name: "password",
+			auth: config.SSHAuth{User: "test", Password: "wrong"},
+			want: "; offered password, keyboard-interactive",
+		},
+		{
+			name: "key and password",
+			auth: config.SSHAuth{User: "test", Password: "wrong", KeyFile: keyFile},
+			want: "; offered publickey (key " + keyFile + "), password, keyboard-interactive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dialHop(nil, hop{addr: addr(cfg), auth: tt.auth})
+			if !errors.Is(err, ErrAuth) || !strings.Contains(err.Error(), "unable to authenticate") || !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("dial error = %v, want ErrAuth ending in %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := dialHop(nil, hop{addr: addr(cfg), auth: config.SSHAuth{User: "test"}}); err == nil || !strings.Contains(err.Error(), "no credentials configured") {
+		t.Errorf("dial without credentials: %v, want a configuration error", err)
+	}
+}
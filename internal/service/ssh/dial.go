@@ -0,0 +1,193 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialTimeout bounds the TCP connect and the handshake of every hop
+const dialTimeout = 5 * time.Second
+
+// hop is one SSH server on the way to the target
+type hop struct {
+	addr         string
+	auth         config.SSHAuth
+	forwardAgent bool // Only ever set on the target
+}
+
+func (h hop) key() string {
+	return h.auth.User + "@" + h.addr
+}
+
+func jumpHops(cfg config.SSHConfig) []hop {
+	hops := make([]hop, len(cfg.JumpHosts))
+	for i, j := range cfg.JumpHosts {
+		port := j.Port
+		if port == 0 {
+			port = 22
+		}
+		hops[i] = hop{addr: net.JoinHostPort(j.Host, strconv.Itoa(port)), auth: j.SSHAuth}
+	}
+	return hops
+}
+
+// targetKey identifies a target, including the route to it
+func targetKey(cfg config.SSHConfig) string {
+	keys := []string{cfg.User + "@" + net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}
+	for _, h := range jumpHops(cfg) {
+		keys = append(keys, h.key())
+	}
+	return strings.Join(keys, " via ")
+}
+
+// dial opens and authenticates a new connection to the target of cfg,
+// tunneling through its jump hosts in order
+func (m *Manager) dial(cfg config.SSHConfig) (*ssh.Client, error) {
+	var via *ssh.Client
+	if hops := jumpHops(cfg); len(hops) > 0 {
+		var err error
+		if via, err = m.jump(hops); err != nil {
+			return nil, err
+		}
+	}
+	target := hop{
+		addr:         net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		auth:         cfg.SSHAuth,
+		forwardAgent: cfg.ForwardAgent,
+	}
+	return dialHop(via, target)
+}
+
+// bastion is a shared connection to a jump host
+type bastion struct {
+	mu     sync.Mutex
+	client *ssh.Client
+	auth   config.SSHAuth // What client was authenticated with
+}
+
+func (b *bastion) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+}
+
+// jump returns a connection to the last of hops, reached through the ones
+// before it. Connections are reused by every target behind the same chain
+// and redialed once they close.
+func (m *Manager) jump(hops []hop) (*ssh.Client, error) {
+	keys := make([]string, len(hops))
+	for i, h := range hops {
+		keys[i] = h.key()
+	}
+	key := strings.Join(keys, " > ")
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	b, ok := m.bastions[key]
+	if !ok {
+		b = &bastion{}
+		m.bastions[key] = b
+	}
+	m.mu.Unlock()
+
+	// Held while dialing so concurrent dials through this bastion share one connection
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	last := hops[len(hops)-1]
+	if b.client != nil {
+		if b.auth == last.auth {
+			return b.client, nil
+		}
+		// Credentials changed on reload. Whatever still runs through the old
+		// connection is cut off: it is shared, so there is no telling when
+		// its last user is done.
+		m.log.Infow("Jump host settings changed, reconnecting", "jump_host", last.addr)
+		b.client.Close()
+		b.client = nil
+	}
+
+	var via *ssh.Client
+	if len(hops) > 1 {
+		var err error
+		if via, err = m.jump(hops[:len(hops)-1]); err != nil {
+			return nil, err
+		}
+	}
+	client, err := dialHop(via, last)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", last.addr, err)
+	}
+	m.log.Infow("Connected to jump host", "jump_host", last.addr)
+
+	b.client, b.auth = client, last.auth
+	go func() {
+		client.Wait()
+		b.mu.Lock()
+		if b.client == client {
+			b.client = nil
+		}
+		b.mu.Unlock()
+		m.log.Infow("Jump host connection closed", "jump_host", last.addr)
+	}()
+	return client, nil
+}
+
+// dialHop connects to h directly, or through via when it is set
+func dialHop(via *ssh.Client, h hop) (*ssh.Client, error) {
+	auth, err := newHopAuth(h.auth, h.forwardAgent)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.close()
+	clientConfig := &ssh.ClientConfig{
+		User: h.auth.User,
+		Auth: auth.methods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return nil // Insecure: accept any host key
+		},
+		Timeout: dialTimeout,
+	}
+
+	var client *ssh.Client
+	if via == nil {
+		if client, err = ssh.Dial("tcp", h.addr, clientConfig); err != nil {
+			return nil, newConnectError(auth.failed(err))
+		}
+	} else {
+		conn, err := via.Dial("tcp", h.addr)
+		if err != nil {
+			return nil, &connectError{kind: ErrConnect, err: err}
+		}
+		// Channels have no deadlines, so the handshake is bounded by closing the channel
+		timer := time.AfterFunc(dialTimeout, func() { conn.Close() })
+		c, chans, reqs, err := ssh.NewClientConn(conn, h.addr, clientConfig)
+		timer.Stop()
+		if err != nil {
+			conn.Close()
+			return nil, newConnectError(auth.failed(err))
+		}
+		client = ssh.NewClient(c, chans, reqs)
+	}
+
+	if h.forwardAgent {
+		if err := auth.forwardAgent(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
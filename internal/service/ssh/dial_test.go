@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+)
+
+// behind returns cfg routed through the test server at bastion
+func behind(cfg, bastion config.SSHConfig) config.SSHConfig {
+	cfg.JumpHosts = []config.SSHJumpHost{{Host: bastion.Host, Port: bastion.Port, SSHAuth: bastion.SSHAuth}}
+	return cfg
+}
+
+func TestJumpHops(t *testing.T) {
+	cfg := config.SSHConfig{
+		Host:    "target",
+		Port:    2222,
+		SSHAuth: config.SSHAuth{User: "app"},
+		JumpHosts: []config.SSHJumpHost{
+			{Host: "edge", SSHAuth: config.SSHAuth{User: "ops"}},
+			{Host: "::1", Port: 2200, SSHAuth: config.SSHAuth{User: "ops"}},
+		},
+	}
+	hops := jumpHops(cfg)
+	if len(hops) != 2 || hops[0].addr != "edge:22" || hops[1].addr != "[::1]:2200" {
+		t.Fatalf("hops = %+v, want edge:22 then [::1]:2200", hops)
+	}
+	if got, want := targetKey(cfg), "app@target:2222 via ops@edge:22 via ops@[::1]:2200"; got != want {
+		t.Errorf("targetKey = %q, want %q", got, want)
+	}
+}
+
+func TestJumpSharedBastion(t *testing.T) {
+	bastion, bastionCfg := serveSSH(t, 0)
+	bastion.relay.Store(true)
+	srvA, cfgA := serveSSH(t, 0)
+	srvB, cfgB := serveSSH(t, 0)
+	m := newTestManager(t)
+
+	clients := map[string]config.SSHConfig{"a": behind(cfgA, bastionCfg), "b": behind(cfgB, bastionCfg)}
+	for name, cfg := range clients {
+		client, err := m.dial(cfg)
+		if err != nil {
+			t.Fatalf("dial %s: %v", name, err)
+		}
+		defer client.Close()
+		session, err := client.NewSession()
+		if err != nil {
+			t.Fatalf("session on %s: %v", name, err)
+		}
+		session.Close()
+	}
+
+	// Both targets were reached over one bastion connection
+	srvA.waitConns(t, 1)
+	srvB.waitConns(t, 1)
+	bastion.waitConns(t, 1)
+	bastion.mu.Lock()
+	dialed := strings.Join(bastion.dialed, " ")
+	bastion.mu.Unlock()
+	for _, cfg := range []config.SSHConfig{cfgA, cfgB} {
+		if addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)); !strings.Contains(dialed, addr) {
+			t.Errorf("bastion dialed %q, want %s among them", dialed, addr)
+		}
+	}
+
+	// A bastion connection that dropped is redialed by the next target
+	m.mu.Lock()
+	for _, b := range m.bastions {
+		b.mu.Lock()
+		b.client.Close()
+		b.mu.Unlock()
+	}
+	m.mu.Unlock()
+	bastion.waitConns(t, 0)
+	client, err := m.dial(clients["a"])
+	if err != nil {
+		t.Fatalf("dial after the bastion dropped: %v", err)
+	}
+	defer client.Close()
+	bastion.waitConns(t, 1)
+}
+
+func TestJumpAuthChange(t *testing.T) {
+	bastion, bastionCfg := serveSSH(t, 0)
+	bastion.relay.Store(true)
+	_, targetCfg := serveSSH(t, 0)
+	m := newTestManager(t)
+
+	cfg := behind(targetCfg, bastionCfg)
+	old, err := m.dial(cfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer old.Close()
+	cut := make(chan struct{})
+	go func() {
+		old.Wait()
+		close(cut)
+	}()
+
+	// New credentials for the bastion replace its connection, cutting off
+	// the target connection that ran through it
+	cfg.JumpHosts[0].Password = rotatedPassword
+	client, err := m.dial(cfg)
+	if err != nil {
+		t.Fatalf("dial with rotated bastion password: %v", err)
+	}
+	defer client.Close()
+	select {
+	case <-cut:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection through the old bastion connection is still open")
+	}
+	bastion.waitConns(t, 1)
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("session through the new bastion connection: %v", err)
+	}
+	session.Close()
+
+	// Unchanged credentials keep the connection
+	again, err := m.dial(cfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer again.Close()
+	if session, err := client.NewSession(); err != nil {
+		t.Errorf("connection cut off although the bastion settings did not change: %v", err)
+	} else {
+		session.Close()
+	}
+
+	// Wrong credentials name the jump host
+	cfg.JumpHosts[0].Password = "wrong"
+	if _, err := m.dial(cfg); err == nil || !strings.Contains(err.Error(), "jump host "+net.JoinHostPort(bastionCfg.Host, strconv.Itoa(bastionCfg.Port))) {
+		t.Errorf("dial with a wrong bastion password: %v, want a jump host error", err)
+	}
+}
@@ -0,0 +1,254 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrForwardNotFound is returned for unknown forward IDs
+	ErrForwardNotFound = errors.New("forward not found")
+	// ErrInvalidForward is matched by forward options that cannot work
+	ErrInvalidForward = errors.New("invalid forward")
+)
+
+// Forward types, named after the ssh flags
+const (
+	ForwardLocal   = "local"   // -L: listen on the proxy, connect from the target
+	ForwardRemote  = "remote"  // -R: listen on the target, connect from the proxy
+	ForwardDynamic = "dynamic" // -D: SOCKS5 on the proxy, connect from the target
+)
+
+// defaultForwardListen binds forwards to loopback on a free port
+const defaultForwardListen = "127.0.0.1:0"
+
+type ForwardOptions struct {
+	Type    string
+	Listen  string // host:port; on the target for remote forwards, on the proxy otherwise
+	Connect string // host:port; seen from the target for local, from the proxy for remote
+}
+
+// Forward is a port forward riding on one pooled connection. It stops when
+// that connection closes, on reconnects and on shutdown alike.
+type Forward struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type" enum:"local,remote,dynamic"`
+	Listen    string     `json:"listen"` // Address actually bound
+	Connect   string     `json:"connect,omitempty"`
+	Status    string     `json:"status" enum:"active,closed"`
+	Error     string     `json:"error,omitempty"` // Why it closed, unless it was deleted
+	Active    int64      `json:"active"`          // Connections currently forwarded
+	Total     int64      `json:"total"`           // Connections forwarded so far
+	Bytes     int64      `json:"bytes"`           // Bytes copied in both directions
+	CreatedAt time.Time  `json:"created_at"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+}
+
+type forward struct {
+	log      *zap.SugaredLogger
+	mu       sync.Mutex
+	info     Forward
+	listener net.Listener
+	client   *ssh.Client
+
+	active, total, bytes atomic.Int64
+	closeOnce            sync.Once
+}
+
+func (f *forward) snapshot() Forward {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info := f.info
+	info.Active, info.Total, info.Bytes = f.active.Load(), f.total.Load(), f.bytes.Load()
+	return info
+}
+
+// close stops listening and records reason; connections already forwarded
+// end with the SSH connection or on their own
+func (f *forward) close(reason string) {
+	f.closeOnce.Do(func() {
+		f.listener.Close()
+		now := time.Now()
+		f.mu.Lock()
+		f.info.Status, f.info.Error, f.info.ClosedAt = "closed", reason, &now
+		f.mu.Unlock()
+		f.log.Infow("Port forward closed", "id", f.info.ID, "type", f.info.Type, "listen", f.info.Listen, "reason", reason)
+	})
+}
+
+// forwardStore keeps the forwards of one Service
+type forwardStore struct {
+	mu       sync.Mutex
+	counter  int64
+	forwards map[string]*forward
+}
+
+// StartForward opens a listener as described by opts on a pooled connection
+// and starts forwarding whatever connects to it. The forward logs with the
+// logger of ctx for as long as it runs.
+func (s *Service) StartForward(ctx context.Context, opts ForwardOptions) (*Forward, error) {
+	if opts.Listen == "" {
+		opts.Listen = defaultForwardListen
+	}
+	switch opts.Type {
+	case ForwardLocal, ForwardRemote:
+		if _, _, err := net.SplitHostPort(opts.Connect); err != nil {
+			return nil, fmt.Errorf("%w: connect address %q: %v", ErrInvalidForward, opts.Connect, err)
+		}
+	case ForwardDynamic:
+		opts.Connect = ""
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidForward, opts.Type)
+	}
+	if _, _, err := net.SplitHostPort(opts.Listen); err != nil {
+		return nil, fmt.Errorf("%w: listen address %q: %v", ErrInvalidForward, opts.Listen, err)
+	}
+
+	pc, err := s.clients().get(false)
+	if err != nil {
+		return nil, connectionFailed(err)
+	}
+	var l net.Listener
+	if opts.Type == ForwardRemote {
+		l, err = pc.Listen("tcp", opts.Listen)
+	} else {
+		l, err = net.Listen("tcp", opts.Listen)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen failed: %w", err)
+	}
+
+	s.forwards.mu.Lock()
+	if s.forwards.forwards == nil {
+		s.forwards.forwards = map[string]*forward{}
+	}
+	s.forwards.counter++
+	f := &forward{
+		log: s.logger(ctx),
+		info: Forward{
+			ID:        fmt.Sprintf("fwd_%d_%d", time.Now().Unix(), s.forwards.counter),
+			Type:      opts.Type,
+			Listen:    l.Addr().String(),
+			Connect:   opts.Connect,
+			Status:    "active",
+			CreatedAt: time.Now(),
+		},
+		listener: l,
+		client:   pc.Client,
+	}
+	s.forwards.forwards[f.info.ID] = f
+	s.forwards.mu.Unlock()
+
+	go func() {
+		err := pc.Wait()
+		f.close(fmt.Sprintf("ssh connection closed: %v", err))
+	}()
+	go s.serveForward(f)
+
+	f.log.Infow("Port forward started", "id", f.info.ID, "type", f.info.Type, "listen", f.info.Listen, "connect", f.info.Connect)
+	info := f.snapshot()
+	return &info, nil
+}
+
+func (s *Service) serveForward(f *forward) {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			f.close(fmt.Sprintf("accept failed: %v", err))
+			return
+		}
+		go func() {
+			defer conn.Close()
+			f.active.Add(1)
+			f.total.Add(1)
+			defer f.active.Add(-1)
+
+			var upstream net.Conn
+			var err error
+			switch f.info.Type {
+			case ForwardLocal:
+				upstream, err = f.client.Dial("tcp", f.info.Connect)
+			case ForwardRemote:
+				upstream, err = net.DialTimeout("tcp", f.info.Connect, dialTimeout)
+			case ForwardDynamic:
+				upstream, err = socksConnect(conn, f.client)
+			}
+			if err != nil {
+				f.log.Debugw("Port forward connection failed", "id", f.info.ID, "error", err)
+				return
+			}
+			defer upstream.Close()
+			f.bytes.Add(pipe(conn, upstream))
+		}()
+	}
+}
+
+// pipe copies both ways, passing half-closes on, and returns the bytes copied
+func pipe(a, b net.Conn) int64 {
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		copied, err := io.Copy(dst, src)
+		n.Add(copied)
+		cw, ok := dst.(interface{ CloseWrite() error })
+		if err != nil || !ok {
+			// Broken or no half-close: the other direction cannot go on
+			a.Close()
+			b.Close()
+			return
+		}
+		cw.CloseWrite()
+	}
+	wg.Add(2)
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+	return n.Load()
+}
+
+// Forwards lists forwards, oldest first, including closed ones until deleted
+func (s *Service) Forwards() []Forward {
+	s.forwards.mu.Lock()
+	list := make([]Forward, 0, len(s.forwards.forwards))
+	for _, f := range s.forwards.forwards {
+		list = append(list, f.snapshot())
+	}
+	s.forwards.mu.Unlock()
+	slices.SortFunc(list, func(a, b Forward) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return list
+}
+
+// StopForward closes a forward and forgets it
+func (s *Service) StopForward(id string) error {
+	s.forwards.mu.Lock()
+	f, ok := s.forwards.forwards[id]
+	delete(s.forwards.forwards, id)
+	s.forwards.mu.Unlock()
+	if !ok {
+		return ErrForwardNotFound
+	}
+	f.close("")
+	return nil
+}
+
+// CloseForwards stops every forward, for shutdown
+func (s *Service) CloseForwards() {
+	s.forwards.mu.Lock()
+	forwards := s.forwards.forwards
+	s.forwards.forwards = nil
+	s.forwards.mu.Unlock()
+	for _, f := range forwards {
+		f.close("shutdown")
+	}
+}
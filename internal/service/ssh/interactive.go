@@ -6,7 +6,6 @@ import (
 	"sync"
 
 	"ssh-ftp-proxy/internal/encoder"
-	"ssh-ftp-proxy/internal/logger"
 
 	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/ssh"
@@ -23,14 +22,12 @@ func (s *Service) StartInteractive(ws *websocket.Conn) error {
 }
 
 func (s *Service) StartInteractiveWithContext(ctx context.Context, ws *websocket.Conn) error {
-	if err := s.connect(); err != nil {
-		return fmt.Errorf("connection failed: %w", err)
-	}
-
-	session, err := s.client.NewSession()
+	log := s.logger(ctx)
+	session, release, err := s.newSession(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+		return err
 	}
+	defer release()
 	defer session.Close()
 
 	// Request PTY
@@ -135,13 +132,18 @@ func (s *Service) StartInteractiveWithContext(ctx context.Context, ws *websocket
 				if msg.Type == "input" {
 					data, err := encoder.DecodeBytes(msg.Payload)
 					if err != nil {
-						logger.Log.Warn("Invalid base64 input", "error", err)
+						log.Warnw("Invalid base64 input", "error", err)
 						continue
 					}
 					stdin.Write(data)
 				} else if msg.Type == "resize" {
 					// Handle resize payload: "rows,cols"
-					// Not implemented in MVP
+					var rows, cols int
+					if _, err := fmt.Sscanf(msg.Payload, "%d,%d", &rows, &cols); err != nil || rows <= 0 || cols <= 0 {
+						log.Warnw("Invalid resize payload", "payload", msg.Payload)
+						continue
+					}
+					session.WindowChange(rows, cols)
 				}
 			}
 		}
@@ -160,7 +162,7 @@ func (s *Service) StartInteractiveWithContext(ctx context.Context, ws *websocket
 	case err := <-sessionDone:
 		cancel()
 		if err != nil {
-			logger.Log.Debug("Session ended", "error", err)
+			log.Debugw("Session ended", "error", err)
 		}
 	}
 
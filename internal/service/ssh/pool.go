@@ -0,0 +1,546 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/metrics"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSessionTimeout is returned when every connection stayed at its session
+// limit for the whole wait timeout
+var ErrSessionTimeout = errors.New("timed out waiting for an ssh session")
+
+var errPoolClosed = &connectError{kind: ErrConnect, err: errors.New("ssh connection pool closed")}
+
+// PoolStats is a snapshot of the connections to one target, reported by /api/health/ready
+type PoolStats struct {
+	MaxConns    int   `json:"max_conns"`
+	MaxSessions int   `json:"max_sessions"`
+	Open        int   `json:"open"`
+	Sessions    int   `json:"sessions"` // Sessions open across all connections
+	Limits      []int `json:"limits"`   // Session limit of each open connection, after sshd refusals
+	Dials       int64 `json:"dials"`    // Connections established
+	Waits       int64 `json:"waits"`    // Requests that had to wait for a session
+	Failures    int   `json:"failures"` // Consecutive failed dials; requests fail fast while backing off
+}
+
+// Manager keeps one connection pool per SSH target, so every server talking
+// to the same target shares its connections. Connections to jump hosts are
+// kept here too and shared by every target behind them.
+type Manager struct {
+	log      *zap.SugaredLogger
+	mu       sync.Mutex
+	pools    map[string]*clientPool
+	bastions map[string]*bastion
+	closed   bool
+}
+
+func NewManager(log *zap.SugaredLogger) *Manager {
+	return &Manager{
+		log:      log,
+		pools:    map[string]*clientPool{},
+		bastions: map[string]*bastion{},
+	}
+}
+
+// pool returns the pool for the target of cfg, creating it on first use.
+// When the target's settings changed (a config reload), the old pool is
+// retired and a new one created with cfg. Every call is paired with a
+// release once the caller stops using the pool.
+func (m *Manager) pool(cfg config.SSHConfig) *clientPool {
+	key := targetKey(cfg)
+	cfg.HTTPTunnel = "" // Not a connection setting
+
+	m.mu.Lock()
+	old, ok := m.pools[key]
+	if ok && reflect.DeepEqual(old.cfg, cfg) {
+		old.users++
+		m.mu.Unlock()
+		return old
+	}
+	p := newClientPool(cfg, func() (*ssh.Client, error) { return m.dial(cfg) }, m.log)
+	if m.closed {
+		p.Close()
+	}
+	p.users++
+	m.pools[key] = p
+	m.mu.Unlock()
+
+	if ok {
+		// Settings changed: connections made with the old ones go
+		old.retire()
+	}
+	return p
+}
+
+// release gives up one use of p, retiring it when nothing uses it anymore
+func (m *Manager) release(p *clientPool) {
+	key := targetKey(p.cfg)
+	m.mu.Lock()
+	p.users--
+	unused := p.users == 0
+	if unused && m.pools[key] == p {
+		delete(m.pools, key)
+	}
+	m.mu.Unlock()
+	if unused {
+		p.retire()
+	}
+}
+
+// Close closes every pooled connection; sessions still open are cut off
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	pools := slices.Collect(maps.Values(m.pools))
+	bastions := slices.Collect(maps.Values(m.bastions))
+	m.mu.Unlock()
+
+	// Outside m.mu: a bastion being dialed holds its own lock while it takes m.mu
+	for _, p := range pools {
+		p.Close()
+	}
+	for _, b := range bastions {
+		b.close()
+	}
+}
+
+// pooledClient is one connection. Unlike FTP, SSH multiplexes, so a
+// connection serves up to limit sessions at once.
+type pooledClient struct {
+	*ssh.Client
+	sessions int
+	limit    int
+}
+
+// clientPool keeps up to maxConns connections to one target. Dials that fail
+// are retried with exponential backoff; until the backoff expires, requests
+// that have no connection to use fail with the last dial error.
+type clientPool struct {
+	log         *zap.SugaredLogger
+	cfg         config.SSHConfig
+	users       int // Services using the pool, guarded by Manager.mu
+	target      string
+	dial        func() (*ssh.Client, error)
+	maxConns    int
+	maxSessions int
+	keepalive   time.Duration
+	waitTimeout time.Duration
+	backoffMin  time.Duration
+	backoffMax  time.Duration
+
+	mu           sync.Mutex
+	clients      []*pooledClient
+	dialing      int
+	failures     int       // consecutive failed dials
+	lastErr      error     // error of the last failed dial
+	nextDial     time.Time // no dial before this while backing off
+	lost         int       // connections lost and not replaced yet
+	reconnecting bool
+	changed      chan struct{} // closed whenever a session frees up or a dial ends
+	dials, waits int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newClientPool(cfg config.SSHConfig, dial func() (*ssh.Client, error), log *zap.SugaredLogger) *clientPool {
+	p := &clientPool{
+		log:         log,
+		cfg:         cfg,
+		target:      net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		dial:        dial,
+		maxConns:    max(cfg.Pool.MaxConns, 1),
+		maxSessions: max(cfg.Pool.MaxSessions, 1),
+		keepalive:   cfg.Pool.KeepaliveInterval,
+		waitTimeout: cfg.Pool.WaitTimeout,
+		backoffMin:  max(cfg.Pool.BackoffMin, 100*time.Millisecond),
+		backoffMax:  cfg.Pool.BackoffMax,
+		changed:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if p.keepalive > 0 {
+		go p.keepaliveLoop()
+	}
+	return p
+}
+
+// session opens a session on the least busy connection that has room,
+// dialing or waiting as needed. release must be called once it is closed.
+func (p *clientPool) session() (*ssh.Session, func(), error) {
+	for {
+		pc, release, err := p.acquire()
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := pc.NewSession()
+		if err == nil {
+			return session, release, nil
+		}
+		release()
+
+		var openErr *ssh.OpenChannelError
+		if !errors.As(err, &openErr) {
+			// The connection itself failed; watch replaces it
+			pc.Close()
+			return nil, nil, fmt.Errorf("failed to create session: %w", err)
+		}
+		if openErr.Reason != ssh.Prohibited && openErr.Reason != ssh.ResourceShortage {
+			return nil, nil, fmt.Errorf("failed to create session: %w", err)
+		}
+		// sshd allows fewer sessions (MaxSessions) than configured: remember
+		// what this connection actually holds and try again
+		p.mu.Lock()
+		if pc.sessions == 0 {
+			p.mu.Unlock()
+			return nil, nil, fmt.Errorf("failed to create session: %w", err)
+		}
+		if pc.sessions < pc.limit {
+			pc.limit = pc.sessions
+			p.log.Infow("SSH server refused a session, lowering per-connection limit",
+				"target", p.target, "limit", pc.limit)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// acquire reserves a session slot on a connection
+func (p *clientPool) acquire() (*pooledClient, func(), error) {
+	pc, err := p.get(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			pc.sessions--
+			p.broadcast()
+			idle := pc.sessions == 0
+			p.mu.Unlock()
+			select {
+			case <-p.done:
+				if idle {
+					// Retired pool: the connection goes with its last session
+					pc.Close()
+				}
+			default:
+			}
+		})
+	}
+	return pc, release, nil
+}
+
+// get returns a connection, reserving a session slot on it when reserve is
+// set. It prefers open connections, dials while the pool has room and is not
+// backing off, and otherwise waits up to waitTimeout.
+func (p *clientPool) get(reserve bool) (*pooledClient, error) {
+	var timeout <-chan time.Time
+	waited := false
+
+	p.mu.Lock()
+	for {
+		select {
+		case <-p.done:
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		default:
+		}
+
+		if pc := p.pick(reserve); pc != nil {
+			if reserve {
+				pc.sessions++
+			}
+			p.mu.Unlock()
+			return pc, nil
+		}
+
+		if len(p.clients)+p.dialing < p.maxConns {
+			if wait := time.Until(p.nextDial); wait <= 0 {
+				p.dialing++
+				p.mu.Unlock()
+				err := p.connect()
+				p.mu.Lock()
+				if err != nil && len(p.clients) == 0 {
+					p.mu.Unlock()
+					return nil, err
+				}
+				continue
+			} else if len(p.clients) == 0 && p.dialing == 0 {
+				// Nothing to wait for but the backoff
+				err := p.lastErr
+				p.mu.Unlock()
+				return nil, fmt.Errorf("%w (next attempt in %s)", err, wait.Round(100*time.Millisecond))
+			}
+		}
+
+		if !waited {
+			waited = true
+			p.waits++
+			if p.waitTimeout > 0 {
+				timer := time.NewTimer(p.waitTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+		}
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-p.done:
+		case <-timeout:
+			return nil, ErrSessionTimeout
+		}
+		p.mu.Lock()
+	}
+}
+
+// pick returns the least busy connection, only among those with a free slot
+// when reserve is set. Called with p.mu held.
+func (p *clientPool) pick(reserve bool) *pooledClient {
+	var best *pooledClient
+	for _, pc := range p.clients {
+		if reserve && pc.sessions >= pc.limit {
+			continue
+		}
+		if best == nil || pc.sessions < best.sessions {
+			best = pc
+		}
+	}
+	return best
+}
+
+// broadcast wakes every waiter. Called with p.mu held.
+func (p *clientPool) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// connect dials a connection for a slot the caller already counted in p.dialing
+func (p *clientPool) connect() error {
+	client, err := p.dial()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing--
+	defer p.broadcast()
+
+	if err != nil {
+		p.failures++
+		p.lastErr = err
+		delay := p.backoff()
+		p.nextDial = time.Now().Add(delay)
+		metrics.SSHConnectFailures.WithLabelValues(p.target).Inc()
+		p.log.Warnw("SSH connect failed", "target", p.target, "failures", p.failures, "retry_in", delay, "error", err)
+		return err
+	}
+
+	select {
+	case <-p.done:
+		client.Close()
+		return errPoolClosed
+	default:
+	}
+	p.dials++
+	p.failures, p.lastErr, p.nextDial = 0, nil, time.Time{}
+	if p.lost > 0 {
+		p.lost--
+		metrics.SSHReconnects.WithLabelValues(p.target).Inc()
+	}
+	pc := &pooledClient{Client: client, limit: p.maxSessions}
+	p.clients = append(p.clients, pc)
+	go p.watch(pc)
+	return nil
+}
+
+// backoff returns backoffMin doubled for every consecutive failure after the first
+func (p *clientPool) backoff() time.Duration {
+	delay := p.backoffMin
+	for i := 1; i < p.failures; i++ {
+		delay *= 2
+		if p.backoffMax > 0 && delay >= p.backoffMax {
+			return p.backoffMax
+		}
+	}
+	return delay
+}
+
+// watch drops a connection once it closes, and starts replacing it in the
+// background unless the pool is shutting down
+func (p *clientPool) watch(pc *pooledClient) {
+	err := pc.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients = slices.DeleteFunc(p.clients, func(c *pooledClient) bool { return c == pc })
+	p.broadcast()
+
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.log.Warnw("SSH connection lost", "target", p.target, "sessions", pc.sessions, "error", err)
+	p.lost++
+	if !p.reconnecting {
+		p.reconnecting = true
+		go p.reconnect()
+	}
+}
+
+// reconnect replaces lost connections, waiting out the backoff between
+// failed attempts
+func (p *clientPool) reconnect() {
+	for {
+		p.mu.Lock()
+		if p.lost == 0 || len(p.clients)+p.dialing >= p.maxConns {
+			p.lost = 0
+			p.reconnecting = false
+			p.mu.Unlock()
+			return
+		}
+		wait := time.Until(p.nextDial)
+		p.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-p.done:
+				timer.Stop()
+				p.mu.Lock()
+				p.reconnecting = false
+				p.mu.Unlock()
+				return
+			case <-timer.C:
+			}
+		}
+
+		p.mu.Lock()
+		if time.Now().Before(p.nextDial) || len(p.clients)+p.dialing >= p.maxConns {
+			// A request dialed meanwhile; look again
+			p.mu.Unlock()
+			continue
+		}
+		p.dialing++
+		p.mu.Unlock()
+		p.connect()
+	}
+}
+
+// keepaliveLoop probes every connection in the background, so a broken one is
+// replaced before a request runs into it
+func (p *clientPool) keepaliveLoop() {
+	ticker := time.NewTicker(p.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			clients := slices.Clone(p.clients)
+			p.mu.Unlock()
+			for _, pc := range clients {
+				go p.probe(pc)
+			}
+		}
+	}
+}
+
+// probe sends a keepalive and closes the connection if the server does not
+// answer within one keepalive interval
+func (p *clientPool) probe(pc *pooledClient) {
+	if err := ping(pc.Client, p.keepalive); err != nil {
+		p.log.Warnw("SSH keepalive failed, closing connection", "target", p.target, "error", err)
+		pc.Close()
+	}
+}
+
+// ping does a keepalive round-trip. OpenSSH answers keepalive@openssh.com with
+// a failure reply, which still proves the connection works.
+func ping(client *ssh.Client, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("no keepalive reply within %s", timeout)
+	}
+}
+
+// Stats returns a snapshot of the pool
+func (p *clientPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := PoolStats{
+		MaxConns:    p.maxConns,
+		MaxSessions: p.maxSessions,
+		Open:        len(p.clients),
+		Limits:      []int{},
+		Dials:       p.dials,
+		Waits:       p.waits,
+		Failures:    p.failures,
+	}
+	for _, pc := range p.clients {
+		stats.Sessions += pc.sessions
+		stats.Limits = append(stats.Limits, pc.limit)
+	}
+	return stats
+}
+
+// retire stops handing out connections and closes each one once its last
+// session ends, so commands already running finish on the old settings.
+// Port forwards and tunnels hold no session and stop right away.
+func (p *clientPool) retire() {
+	first := false
+	p.closeOnce.Do(func() {
+		close(p.done)
+		first = true
+	})
+	if !first {
+		return // Already retired or closed
+	}
+	p.log.Infow("Retiring SSH connections", "target", p.target)
+	p.mu.Lock()
+	var idle []*pooledClient
+	for _, pc := range p.clients {
+		if pc.sessions == 0 {
+			idle = append(idle, pc)
+		}
+	}
+	p.broadcast()
+	p.mu.Unlock()
+	for _, pc := range idle {
+		pc.Close()
+	}
+}
+
+// Close stops the background work and closes every connection
+func (p *clientPool) Close() {
+	p.closeOnce.Do(func() { close(p.done) })
+	p.mu.Lock()
+	clients := slices.Clone(p.clients)
+	p.broadcast()
+	p.mu.Unlock()
+	for _, pc := range clients {
+		pc.Close()
+	}
+}
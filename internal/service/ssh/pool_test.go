@@ -0,0 +1,413 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ssh-ftp-proxy/internal/config"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process sshd. It accepts sessions, refusing them past
+// maxSessions per connection like sshd MaxSessions, and direct-tcpip
+// channels, which echo what they receive unless relay is set.
+type testServer struct {
+	maxSessions int // 0 = unlimited
+
+	relay atomic.Bool  // Connect direct-tcpip channels to their destination, like a bastion
+	conns atomic.Int32 // Connections currently open
+
+	mu     sync.Mutex
+	dialed []string // Addresses of direct-tcpip channels, refused ones included
+}
+
+const (
+	// refusedHost is refused by the test server's direct-tcpip handler
+	refusedHost = "refused.invalid"
+	// rotatedPassword is accepted as well as "pw", to change credentials
+	rotatedPassword = "rotated"
+)
+
+// serveSSH starts a test server accepting user "test" with password "pw" (or
+// rotatedPassword) and returns a config pointing at it
+func serveSSH(t *testing.T, maxSessions int) (*testServer, config.SSHConfig) {
+	t.Helper()
+	return serveSSHAuth(t, maxSessions, func(serverConfig *ssh.ServerConfig) {
+		serverConfig.PasswordCallback = func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "test" && (string(pass) == "pw" || string(pass) == rotatedPassword) {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		}
+	})
+}
+
+// serveSSHAuth starts a test server whose authentication is set up by auth
+func serveSSHAuth(t *testing.T, maxSessions int, auth func(*ssh.ServerConfig)) (*testServer, config.SSHConfig) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{}
+	auth(serverConfig)
+	serverConfig.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := &testServer{maxSessions: maxSessions}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(nc, serverConfig)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	cfg := config.SSHConfig{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		SSHAuth: config.SSHAuth{User: "test", Password: "pw"},
+		Pool: config.SSHPoolConfig{
+			MaxConns:    1,
+			MaxSessions: 10,
+			WaitTimeout: time.Second,
+			BackoffMin:  100 * time.Millisecond,
+			BackoffMax:  time.Second,
+		},
+	}
+	return srv, cfg
+}
+
+func (s *testServer) serve(nc net.Conn, serverConfig *ssh.ServerConfig) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, serverConfig)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	s.conns.Add(1)
+	defer s.conns.Add(-1)
+	go ssh.DiscardRequests(reqs)
+
+	var sessions atomic.Int32
+	go func() {
+		for nch := range chans {
+			switch nch.ChannelType() {
+			case "session":
+				if s.maxSessions > 0 && int(sessions.Load()) >= s.maxSessions {
+					nch.Reject(ssh.ResourceShortage, "no more sessions")
+					continue
+				}
+				ch, chReqs, err := nch.Accept()
+				if err != nil {
+					continue
+				}
+				sessions.Add(1)
+				go ssh.DiscardRequests(chReqs)
+				go func() {
+					io.Copy(io.Discard, ch)
+					ch.Close()
+					sessions.Add(-1)
+				}()
+			case "direct-tcpip":
+				var dest struct {
+					Host     string
+					Port     uint32
+					OrigHost string
+					OrigPort uint32
+				}
+				if err := ssh.Unmarshal(nch.ExtraData(), &dest); err != nil {
+					nch.Reject(ssh.ConnectionFailed, err.Error())
+					continue
+				}
+				s.mu.Lock()
+				s.dialed = append(s.dialed, net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port))))
+				s.mu.Unlock()
+				if dest.Host == refusedHost {
+					nch.Reject(ssh.ConnectionFailed, "connection refused")
+					continue
+				}
+				var upstream net.Conn
+				if s.relay.Load() {
+					var err error
+					if upstream, err = net.Dial("tcp", net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port)))); err != nil {
+						nch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+				}
+				ch, chReqs, err := nch.Accept()
+				if err != nil {
+					continue
+				}
+				go ssh.DiscardRequests(chReqs)
+				if upstream == nil {
+					go func() {
+						io.Copy(ch, ch)
+						ch.Close()
+					}()
+					continue
+				}
+				go func() {
+					io.Copy(upstream, ch)
+					upstream.Close()
+				}()
+				go func() {
+					io.Copy(ch, upstream)
+					ch.Close()
+				}()
+			default:
+				nch.Reject(ssh.UnknownChannelType, "unsupported")
+			}
+		}
+	}()
+	conn.Wait()
+}
+
+// waitConns waits until the server has want connections open
+func (s *testServer) waitConns(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for int(s.conns.Load()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("server has %d connections open, want %d", s.conns.Load(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestManager(t *testing.T) *Manager {
+	m := NewManager(zap.NewNop().Sugar())
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestPoolSessionLimit(t *testing.T) {
+	srv, cfg := serveSSH(t, 0)
+	cfg.Pool.MaxSessions = 2
+	cfg.Pool.WaitTimeout = 100 * time.Millisecond
+	p := newTestManager(t).pool(cfg)
+
+	var releases []func()
+	for range 2 {
+		session, release, err := p.session()
+		if err != nil {
+			t.Fatalf("session: %v", err)
+		}
+		defer session.Close()
+		releases = append(releases, release)
+	}
+	if stats := p.Stats(); stats.Open != 1 || stats.Sessions != 2 || stats.Dials != 1 {
+		t.Fatalf("stats = %+v, want 2 sessions on 1 connection", stats)
+	}
+
+	// Both slots taken and no room for another connection
+	start := time.Now()
+	if _, _, err := p.session(); !errors.Is(err, ErrSessionTimeout) {
+		t.Fatalf("third session error = %v, want %v", err, ErrSessionTimeout)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("third session gave up after %s, want the wait timeout", waited)
+	}
+
+	// A waiter gets the slot freed by a release
+	type result struct {
+		session *ssh.Session
+		err     error
+	}
+	got := make(chan result, 1)
+	go func() {
+		session, _, err := p.session()
+		got <- result{session, err}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	releases[0]()
+	r := <-got
+	if r.err != nil {
+		t.Fatalf("waiting session: %v", r.err)
+	}
+	r.session.Close()
+
+	stats := p.Stats()
+	if stats.Waits != 2 || stats.Dials != 1 {
+		t.Errorf("stats = %+v, want 2 waits and 1 dial", stats)
+	}
+	if n := srv.conns.Load(); n != 1 {
+		t.Errorf("server has %d connections, want 1", n)
+	}
+}
+
+func TestPoolLowersLimitOnRefusal(t *testing.T) {
+	srv, cfg := serveSSH(t, 1)
+	cfg.Pool.MaxConns = 2
+	cfg.Pool.MaxSessions = 3
+	cfg.Pool.WaitTimeout = 100 * time.Millisecond
+	p := newTestManager(t).pool(cfg)
+
+	// The second session is refused on the first connection, which is then
+	// known to hold one, so it goes to a second connection
+	for range 2 {
+		session, _, err := p.session()
+		if err != nil {
+			t.Fatalf("session: %v", err)
+		}
+		defer session.Close()
+	}
+	stats := p.Stats()
+	if stats.Open != 2 || stats.Limits[0] != 1 {
+		t.Fatalf("stats = %+v, want 2 connections, the first limited to 1", stats)
+	}
+	srv.waitConns(t, 2)
+}
+
+func TestPoolBackoff(t *testing.T) {
+	_, cfg := serveSSH(t, 0)
+	cfg.Pool.BackoffMin = 100 * time.Millisecond
+	cfg.Pool.BackoffMax = 300 * time.Millisecond
+
+	m := newTestManager(t)
+	var dials atomic.Int32
+	var fail atomic.Bool
+	fail.Store(true)
+	dialErr := errors.New("connection refused")
+	p := newClientPool(cfg, func() (*ssh.Client, error) {
+		dials.Add(1)
+		if fail.Load() {
+			return nil, dialErr
+		}
+		return m.dial(cfg)
+	}, zap.NewNop().Sugar())
+	t.Cleanup(p.Close)
+
+	if _, err := p.get(true); !errors.Is(err, dialErr) {
+		t.Fatalf("first get error = %v, want %v", err, dialErr)
+	}
+	// While backing off, requests fail fast with the last error
+	_, err := p.get(true)
+	if !errors.Is(err, dialErr) || !strings.Contains(err.Error(), "next attempt in") {
+		t.Fatalf("get while backing off error = %v, want the last dial error", err)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("dialed %d times while backing off, want 1", n)
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if _, err := p.get(true); !errors.Is(err, dialErr) {
+		t.Fatalf("get after backoff error = %v, want %v", err, dialErr)
+	}
+	if n, failures := dials.Load(), p.Stats().Failures; n != 2 || failures != 2 {
+		t.Fatalf("dials = %d, failures = %d, want 2 each", n, failures)
+	}
+
+	// Once a dial succeeds the backoff resets
+	fail.Store(false)
+	time.Sleep(210 * time.Millisecond)
+	pc, err := p.get(true)
+	if err != nil {
+		t.Fatalf("get after recovery: %v", err)
+	}
+	if pc.sessions != 1 {
+		t.Errorf("sessions = %d, want the reserved slot", pc.sessions)
+	}
+	if stats := p.Stats(); stats.Failures != 0 || stats.Dials != 1 {
+		t.Errorf("stats = %+v, want failures reset after 1 dial", stats)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		max      time.Duration
+		want     time.Duration
+	}{
+		{failures: 1, max: time.Second, want: 100 * time.Millisecond},
+		{failures: 2, max: time.Second, want: 200 * time.Millisecond},
+		{failures: 4, max: time.Second, want: 800 * time.Millisecond},
+		{failures: 5, max: time.Second, want: time.Second},
+		{failures: 30, max: time.Second, want: time.Second},
+		{failures: 5, max: 0, want: 1600 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		p := &clientPool{backoffMin: 100 * time.Millisecond, backoffMax: tt.max, failures: tt.failures}
+		if got := p.backoff(); got != tt.want {
+			t.Errorf("backoff after %d failures (max %s) = %s, want %s", tt.failures, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestManagerReloadRetiresPool(t *testing.T) {
+	srv, cfg := serveSSH(t, 0)
+	cfg.Pool.MaxConns = 2
+	cfg.Pool.MaxSessions = 1
+	m := newTestManager(t)
+	old := m.pool(cfg)
+
+	// One connection busy with a session, one idle
+	busy, releaseBusy, err := old.session()
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	idle, releaseIdle, err := old.session()
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	idle.Close()
+	releaseIdle()
+	srv.waitConns(t, 2)
+
+	// Same settings share the pool
+	if p := m.pool(cfg); p != old {
+		t.Fatal("unchanged settings got a new pool")
+	}
+	m.release(old)
+
+	// Changed settings retire the old pool: the idle connection closes now,
+	// the busy one once its session ends
+	cfg.Pool.MaxSessions = 5
+	cur := m.pool(cfg)
+	if cur == old {
+		t.Fatal("changed settings kept the old pool")
+	}
+	srv.waitConns(t, 1)
+	if _, _, err := old.session(); !errors.Is(err, ErrConnect) {
+		t.Fatalf("session on retired pool error = %v, want %v", err, ErrConnect)
+	}
+
+	busy.Close()
+	releaseBusy()
+	srv.waitConns(t, 0)
+
+	// The new pool dials its own connection
+	session, release, err := cur.session()
+	if err != nil {
+		t.Fatalf("session on new pool: %v", err)
+	}
+	session.Close()
+	release()
+	srv.waitConns(t, 1)
+
+	// Releasing the last user retires it too
+	m.release(cur)
+	srv.waitConns(t, 0)
+}
@@ -2,89 +2,179 @@ package ssh
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"ssh-ftp-proxy/internal/config"
 	"ssh-ftp-proxy/internal/logger"
+	"ssh-ftp-proxy/internal/metrics"
 
+	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
+var (
+	// ErrConnect is matched (errors.Is) by failures to reach or handshake with the SSH server
+	ErrConnect = errors.New("ssh connect failed")
+	// ErrAuth is matched by SSH authentication failures
+	ErrAuth = errors.New("ssh authentication failed")
+)
+
+// connectError tags a dial error with ErrConnect or ErrAuth without changing its message
+type connectError struct {
+	kind error
+	err  error
+}
+
+func (e *connectError) Error() string   { return e.err.Error() }
+func (e *connectError) Unwrap() []error { return []error{e.kind, e.err} }
+
+func newConnectError(err error) error {
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return &connectError{kind: ErrAuth, err: err}
+	}
+	return &connectError{kind: ErrConnect, err: err}
+}
+
+// IsExitError reports whether err only carries a non-zero exit status of a command that ran
+func IsExitError(err error) bool {
+	var exitErr *ssh.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// Service runs commands on one SSH target over connections from a Manager,
+// so services created for the same target share them
 type Service struct {
-	mu     sync.Mutex
-	client *ssh.Client
+	log      *zap.SugaredLogger
+	manager  *Manager
+	forwards forwardStore
+
+	mu     sync.RWMutex // Update swaps config and pool together
 	config config.SSHConfig
+	pool   *clientPool
 }
 
-func NewService(cfg config.SSHConfig) *Service {
+func NewService(cfg config.SSHConfig, manager *Manager) *Service {
 	return &Service{
-		config: cfg,
+		log:     manager.log,
+		manager: manager,
+		config:  cfg,
+		pool:    manager.pool(cfg),
 	}
 }
 
-func (s *Service) connect() error {
+// Update switches the service to cfg and reports whether the connection
+// settings changed. If so, new requests use fresh connections and the old
+// ones close as their sessions end.
+func (s *Service) Update(cfg config.SSHConfig) bool {
+	pool := s.manager.pool(cfg)
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	old := s.pool
+	s.config, s.pool = cfg, pool
+	s.mu.Unlock()
+	s.manager.release(old)
+	return pool != old
+}
 
-	if s.client != nil {
-		// Verify connection
-		_, _, err := s.client.Conn.SendRequest("keepalive@openssh.com", true, nil)
-		if err == nil {
-			return nil
-		}
-		s.client.Close()
-	}
+// logger returns the logger carried by ctx, falling back to the service's
+func (s *Service) logger(ctx context.Context) *zap.SugaredLogger {
+	return logger.FromContext(ctx, s.log)
+}
+
+func (s *Service) settings() config.SSHConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+func (s *Service) clients() *clientPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
+// target identifies the SSH server in metrics and logs
+func (s *Service) target() string {
+	cfg := s.settings()
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
 
-	auth := []ssh.AuthMethod{}
-	if s.config.Password != "" {
-		auth = append(auth, ssh.Password(s.config.Password))
+// Ping verifies a connection with a keepalive round-trip, dialing one if none
+// is open. It does not take a session slot.
+func (s *Service) Ping() error {
+	pc, err := s.clients().get(false)
+	if err != nil {
+		return err
 	}
-	if s.config.KeyFile != "" {
-		key, err := os.ReadFile(s.config.KeyFile)
-		if err != nil {
-			logger.Log.Warn("Failed to read key file", "error", err)
-		} else {
-			signer, err := ssh.ParsePrivateKey(key)
-			if err != nil {
-				logger.Log.Warn("Failed to parse private key", "error", err)
-			} else {
-				auth = append(auth, ssh.PublicKeys(signer))
-			}
-		}
+	if err := ping(pc.Client, 5*time.Second); err != nil {
+		return fmt.Errorf("keepalive failed: %w", err)
 	}
+	return nil
+}
 
-	clientConfig := &ssh.ClientConfig{
-		User: s.config.User,
-		Auth: auth,
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			return nil // Insecure: accept any host key
-		},
-		Timeout: 5 * time.Second,
+// Acquire reserves a session slot and returns the connection it belongs to,
+// for callers that open their own channels (SFTP). release frees the slot.
+func (s *Service) Acquire() (client *ssh.Client, release func(), err error) {
+	pc, release, err := s.clients().acquire()
+	if err != nil {
+		return nil, nil, connectionFailed(err)
 	}
+	return pc.Client, release, nil
+}
+
+// PoolStats reports the connections to the target
+func (s *Service) PoolStats() PoolStats {
+	return s.clients().Stats()
+}
+
+// Target returns the host:port of the SSH server
+func (s *Service) Target() string {
+	return s.target()
+}
 
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	client, err := ssh.Dial("tcp", addr, clientConfig)
+// newSession opens a session on a pooled connection. release frees its slot
+// and must be called after the session is closed.
+func (s *Service) newSession(ctx context.Context) (*ssh.Session, func(), error) {
+	session, release, err := s.clients().session()
 	if err != nil {
-		return err
+		return nil, nil, connectionFailed(err)
 	}
-
-	s.client = client
-	return nil
+	if s.settings().ForwardAgent {
+		// Like ssh -A, a refusal is not fatal: the session just has no agent
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			s.logger(ctx).Warnw("Agent forwarding refused", "error", err)
+		}
+	}
+	return session, release, nil
 }
 
-func (s *Service) Exec(cmd string) (string, string, int, error) {
-	if err := s.connect(); err != nil {
-		return "", "", -1, fmt.Errorf("connection failed: %w", err)
+// connectionFailed prefixes dial errors the way callers have always seen them
+func connectionFailed(err error) error {
+	if errors.Is(err, ErrConnect) || errors.Is(err, ErrAuth) {
+		return fmt.Errorf("connection failed: %w", err)
 	}
+	return err
+}
+
+// Exec runs cmd in a new session. ctx carries the logger of the request.
+func (s *Service) Exec(ctx context.Context, cmd string) (stdout string, stderr string, exitCode int, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveSSHExec(s.target(), exitCode, time.Since(start))
+	}()
 
-	session, err := s.client.NewSession()
+	session, release, err := s.newSession(ctx)
 	if err != nil {
-		return "", "", -1, fmt.Errorf("failed to create session: %w", err)
+		return "", "", -1, err
 	}
+	defer release()
 	defer session.Close()
 
 	var stdoutBuf, stderrBuf bytes.Buffer
@@ -93,7 +183,7 @@ func (s *Service) Exec(cmd string) (string, string, int, error) {
 
 	err = session.Run(cmd)
 
-	exitCode := 0
+	exitCode = 0
 	if err != nil {
 		if exitErr, ok := err.(*ssh.ExitError); ok {
 			exitCode = exitErr.ExitStatus()
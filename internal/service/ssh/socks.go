@@ -0,0 +1,112 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SOCKS5 (RFC 1928) values used by dynamic forwards
+const (
+	socksVersion        = 5
+	socksNoAuth         = 0
+	socksNoAcceptable   = 0xff
+	socksCmdConnect     = 1
+	socksAddrIPv4       = 1
+	socksAddrDomain     = 3
+	socksAddrIPv6       = 4
+	socksSucceeded      = 0
+	socksHostFailure    = 4
+	socksCmdUnsupported = 7
+)
+
+// socksConnect runs the server side of a SOCKS5 CONNECT handshake on conn
+// and dials the requested destination through client. Only unauthenticated
+// CONNECT is supported, like ssh -D.
+func socksConnect(conn net.Conn, client *ssh.Client) (net.Conn, error) {
+	// Greeting: version, method count, methods
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return nil, err
+	}
+	if head[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported socks version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return nil, err
+	}
+	if method == socksNoAcceptable {
+		return nil, errors.New("socks client requires authentication")
+	}
+
+	// Request: version, command, reserved, address
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return nil, err
+	}
+	if req[1] != socksCmdConnect {
+		socksReply(conn, socksCmdUnsupported)
+		return nil, fmt.Errorf("unsupported socks command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksAddrIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		return nil, fmt.Errorf("unsupported socks address type %d", req[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	upstream, err := client.Dial("tcp", addr)
+	if err != nil {
+		socksReply(conn, socksHostFailure)
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	return upstream, nil
+}
+
+// socksReply answers a request; the bound address is not meaningful through SSH
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
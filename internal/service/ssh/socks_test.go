@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSocksConnect(t *testing.T) {
+	srv, cfg := serveSSH(t, 0)
+	client, err := newTestManager(t).dial(cfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	greeting := []byte{socksVersion, 1, socksNoAuth}
+	accepted := []byte{socksVersion, socksNoAuth}
+	reply := func(code byte) []byte {
+		return []byte{socksVersion, code, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0}
+	}
+	connect := func(atyp byte, addr ...byte) []byte {
+		return append([]byte{socksVersion, socksCmdConnect, 0, atyp}, addr...)
+	}
+	domain := func(name string, port ...byte) []byte {
+		return append(append([]byte{byte(len(name))}, name...), port...)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []byte // Everything the server writes back
+		dialed  string // Destination requested over SSH
+		hangUp  bool   // Client disconnects after sending input
+		wantErr string
+	}{
+		{
+			name:   "ipv4",
+			input:  slices.Concat(greeting, connect(socksAddrIPv4, 127, 0, 0, 1, 0x1f, 0x90)),
+			want:   slices.Concat(accepted, reply(socksSucceeded)),
+			dialed: "127.0.0.1:8080",
+		},
+		{
+			name:   "ipv6",
+			input:  slices.Concat(greeting, connect(socksAddrIPv6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 22)),
+			want:   slices.Concat(accepted, reply(socksSucceeded)),
+			dialed: "[::1]:22",
+		},
+		{
+			name:   "domain",
+			input:  slices.Concat(greeting, connect(socksAddrDomain, domain("example.com", 1, 187)...)),
+			want:   slices.Concat(accepted, reply(socksSucceeded)),
+			dialed: "example.com:443",
+		},
+		{
+			name:   "no auth among several methods",
+			input:  slices.Concat([]byte{socksVersion, 3, 2, 1, socksNoAuth}, connect(socksAddrIPv4, 10, 0, 0, 1, 0, 80)),
+			want:   slices.Concat(accepted, reply(socksSucceeded)),
+			dialed: "10.0.0.1:80",
+		},
+		{
+			name:    "auth required",
+			input:   []byte{socksVersion, 1, 2},
+			want:    []byte{socksVersion, socksNoAcceptable},
+			wantErr: "requires authentication",
+		},
+		{
+			name:    "socks4",
+			input:   []byte{4, 1, 0, 80, 127, 0, 0, 1, 0},
+			wantErr: "unsupported socks version 4",
+		},
+		{
+			name:    "bind",
+			input:   slices.Concat(greeting, []byte{socksVersion, 2, 0, socksAddrIPv4, 127, 0, 0, 1, 0, 80}),
+			want:    slices.Concat(accepted, reply(socksCmdUnsupported)),
+			wantErr: "unsupported socks command 2",
+		},
+		{
+			name:    "unknown address type",
+			input:   slices.Concat(greeting, connect(9, 1, 2, 3, 4)),
+			want:    accepted,
+			wantErr: "unsupported socks address type 9",
+		},
+		{
+			name:    "destination refused",
+			input:   slices.Concat(greeting, connect(socksAddrDomain, domain(refusedHost, 0, 80)...)),
+			want:    slices.Concat(accepted, reply(socksHostFailure)),
+			dialed:  refusedHost + ":80",
+			wantErr: "dial " + refusedHost + ":80",
+		},
+		{
+			name:    "truncated request",
+			input:   slices.Concat(greeting, connect(socksAddrDomain, 11, 'e', 'x')),
+			want:    accepted,
+			hangUp:  true,
+			wantErr: "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+
+			type result struct {
+				upstream net.Conn
+				err      error
+			}
+			done := make(chan result, 1)
+			go func() {
+				upstream, err := socksConnect(serverConn, client)
+				done <- result{upstream, err}
+				serverConn.Close()
+			}()
+			go func() {
+				// Input the server does not read fails once it hangs up
+				clientConn.Write(tt.input)
+				if tt.hangUp {
+					clientConn.Close()
+				}
+			}()
+			got, _ := io.ReadAll(clientConn)
+			r := <-done
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("server wrote %v, want %v", got, tt.want)
+			}
+			if tt.dialed != "" {
+				srv.mu.Lock()
+				dialed := srv.dialed[len(srv.dialed)-1]
+				srv.mu.Unlock()
+				if dialed != tt.dialed {
+					t.Errorf("dialed %s, want %s", dialed, tt.dialed)
+				}
+			}
+			if tt.wantErr != "" {
+				if r.err == nil || !strings.Contains(r.err.Error(), tt.wantErr) {
+					t.Fatalf("socksConnect error = %v, want %q", r.err, tt.wantErr)
+				}
+				return
+			}
+			if r.err != nil {
+				t.Fatalf("socksConnect: %v", r.err)
+			}
+			defer r.upstream.Close()
+
+			// The returned connection reaches the destination
+			if _, err := r.upstream.Write([]byte("ping")); err != nil {
+				t.Fatalf("write upstream: %v", err)
+			}
+			echo := make([]byte, 4)
+			if _, err := io.ReadFull(r.upstream, echo); err != nil || string(echo) != "ping" {
+				t.Errorf("upstream echoed %q, %v, want %q", echo, err, "ping")
+			}
+		})
+	}
+}
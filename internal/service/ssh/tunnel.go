@@ -0,0 +1,25 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrTunnel is matched when the SSH server could not reach a tunnel destination
+var ErrTunnel = errors.New("ssh tunnel failed")
+
+// DialContext opens a direct-tcpip channel over a pooled connection to addr,
+// as seen from the target. Channels do not count against session limits.
+func (s *Service) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	pc, err := s.clients().get(false)
+	if err != nil {
+		return nil, connectionFailed(err)
+	}
+	conn, err := pc.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrTunnel, addr, err)
+	}
+	return conn, nil
+}
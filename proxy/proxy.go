@@ -0,0 +1,133 @@
+// Package proxy embeds the SSH/FTP proxy API in another program. New returns
+// an http.Handler serving the same routes as the standalone server: the
+// HTTP API under /api, /metrics, and the interactive shell at /ws/ssh.
+//
+//	cfg, err := proxy.LoadConfig("config/config.yaml")
+//	...
+//	p, err := proxy.New(proxy.Options{Config: cfg, Logger: log})
+//	...
+//	defer p.Close()
+//	http.ListenAndServe(":8080", p)
+//
+// Metrics are process-wide: several proxies in one program count into the
+// same collectors, and each one's /metrics reports the combined totals.
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"ssh-ftp-proxy/internal/config"
+	"ssh-ftp-proxy/internal/redact"
+	"ssh-ftp-proxy/internal/server"
+	"ssh-ftp-proxy/internal/service/ssh"
+
+	"go.uber.org/zap"
+)
+
+// Config and its sections, as read from config.yaml
+type (
+	Config        = config.Config
+	ServerConfig  = config.ServerConfig
+	SSHConfig     = config.SSHConfig
+	SSHAuth       = config.SSHAuth
+	SSHJumpHost   = config.SSHJumpHost
+	SSHPoolConfig = config.SSHPoolConfig
+	FTPConfig     = config.FTPConfig
+	FTPPoolConfig = config.FTPPoolConfig
+	HealthConfig  = config.HealthConfig
+	LogConfig     = config.LogConfig
+	RedactConfig  = config.RedactConfig
+)
+
+// Backend services the handler calls. Implementations replace the built-in
+// ones, e.g. in tests.
+type (
+	SSHService  = server.SSHService
+	FTPService  = server.FTPService
+	FileService = server.FileService
+)
+
+// LoadConfig reads config.yaml at path over the defaults and environment
+// variables, and validates it. A missing file leaves the defaults.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// Options configure New
+type Options struct {
+	Config *Config            // Required; Server (listen addresses) and Log are not used
+	Logger *zap.SugaredLogger // Default: discard. Secrets are masked per Config.Redact.
+
+	// Services left nil are created from Config
+	SSH  SSHService
+	FTP  FTPService
+	File FileService
+}
+
+// Proxy is the proxy as an http.Handler
+type Proxy struct {
+	api     *server.Server
+	ws      *server.WSServer
+	manager *ssh.Manager
+}
+
+// New validates opts.Config and creates the proxy. Close it to release its
+// connections.
+func New(opts Options) (*Proxy, error) {
+	if opts.Config == nil {
+		return nil, errors.New("proxy: Options.Config is required")
+	}
+	if err := opts.Config.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop().Sugar()
+	}
+	redactor, err := redact.New(opts.Config.Redact.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	log := redactor.Logger(opts.Logger)
+
+	p := &Proxy{manager: ssh.NewManager(log)}
+	srvOpts := server.Options{
+		Config:     opts.Config,
+		Logger:     log,
+		Redactor:   redactor,
+		SSHManager: p.manager,
+		SSH:        opts.SSH,
+		FTP:        opts.FTP,
+		File:       opts.File,
+	}
+	p.api = server.NewServer(srvOpts)
+	p.ws = server.NewWSServer(srvOpts)
+	return p, nil
+}
+
+// ServeHTTP routes /ws/ssh to the shell server and everything else to the API
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ws/ssh" {
+		p.ws.Handler().ServeHTTP(w, r)
+		return
+	}
+	p.api.Handler().ServeHTTP(w, r)
+}
+
+// Reload validates cfg and applies it like a config file change does for the
+// standalone server. An invalid cfg changes nothing.
+func (p *Proxy) Reload(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	p.api.Reload(cfg)
+	p.ws.Reload(cfg)
+	return nil
+}
+
+// Close stops port forwards and closes the SSH, SFTP and FTP connections
+func (p *Proxy) Close() {
+	p.api.Close()
+	p.ws.Close()
+	p.manager.Close()
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNew(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := New(Options{}); err == nil {
+		t.Error("New without Config: want error")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ssh_server:\n  password: x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	p, err := New(Options{Config: cfg})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer p.Close()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/health: status %d", w.Code)
+	}
+
+	// Not a WebSocket handshake, but it must reach the shell server
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws/ssh", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET /ws/ssh: status %d, want %d from the upgrader", w.Code, http.StatusBadRequest)
+	}
+}
@@ -50,8 +50,12 @@ AI SSH/FTP Proxy - Install Script
 
 Usage: $0 [OPTIONS]
 
-Required:
-  --ssh-pass PASSWORD       SSH password for the target server
+Required (one of):
+  --ssh-pass PASSWORD       SSH password for the target server, or a secret
+                            reference: env:NAME, file:/path or enc:... (see
+                            "$BINARY_NAME secret encrypt")
+  --ssh-pass-file FILE      Read the SSH password from FILE at startup instead
+                            of storing it in config.yaml
 
 Server Options:
   --install-dir DIR         Install directory (default: /opt/ssh-ftp-proxy)
@@ -69,7 +73,8 @@ FTP Configuration (defaults to SSH values):
   --ftp-host HOST           FTP host (default: same as ssh-host)
   --ftp-port PORT           FTP port (default: 21)
   --ftp-user USER           FTP username (default: same as ssh-user)
-  --ftp-pass PASSWORD       FTP password (default: same as ssh-pass)
+  --ftp-pass PASSWORD       FTP password or secret reference (default: same as ssh-pass)
+  --ftp-pass-file FILE      Read the FTP password from FILE at startup
 
 Other:
   --log-level LEVEL         Log level: debug|info|warn|error (default: info)
@@ -82,6 +87,9 @@ Examples:
   # Minimal install (AI default)
   $0 --ssh-pass MyPassword --auto-start
 
+  # Keep the password out of the command line and config.yaml
+  $0 --ssh-pass-file /root/.ssh-proxy-pass --auto-start
+
   # Full control
   $0 --ssh-host 127.0.0.1 --ssh-port 1643 --ssh-user root --ssh-pass MyPass \\
      --http-port 48891 --auto-start --systemd
@@ -105,11 +113,13 @@ parse_args() {
             --ssh-port)     SSH_PORT="$2"; shift 2 ;;
             --ssh-user)     SSH_USER="$2"; shift 2 ;;
             --ssh-pass)     SSH_PASS="$2"; shift 2 ;;
+            --ssh-pass-file) SSH_PASS="file:$2"; shift 2 ;;
             --ssh-keyfile)  SSH_KEYFILE="$2"; shift 2 ;;
             --ftp-host)     FTP_HOST="$2"; shift 2 ;;
             --ftp-port)     FTP_PORT="$2"; shift 2 ;;
             --ftp-user)     FTP_USER="$2"; shift 2 ;;
             --ftp-pass)     FTP_PASS="$2"; shift 2 ;;
+            --ftp-pass-file) FTP_PASS="file:$2"; shift 2 ;;
             --log-level)    LOG_LEVEL="$2"; shift 2 ;;
             --auto-start)   AUTO_START=true; shift ;;
             --systemd)      SETUP_SYSTEMD=true; shift ;;
@@ -124,7 +134,7 @@ parse_args() {
 
     # Validate required
     if [[ -z "$SSH_PASS" ]]; then
-        log_error "--ssh-pass is required"
+        log_error "--ssh-pass or --ssh-pass-file is required"
         echo ""
         usage
     fi
@@ -227,6 +237,8 @@ log:
   level: "$LOG_LEVEL"
   file: "logs/server.log"
 YAML
+    # May still hold plaintext passwords
+    chmod 600 "$config_file"
 
     log_success "Config generated"
 }
@@ -304,7 +304,7 @@ download_binary() {
         local temp_dir=$(mktemp -d)
         if git clone --depth 1 "https://github.com/$GITHUB_REPO.git" "$temp_dir" 2>/dev/null; then
             cd "$temp_dir"
-            CGO_ENABLED=0 go build -o "$SCRIPT_DIR/../$BINARY_NAME" cmd/server/main.go
+            CGO_ENABLED=0 go build -o "$SCRIPT_DIR/../$BINARY_NAME" ./cmd/server
             cd "$SCRIPT_DIR/.."
             rm -rf "$temp_dir"
             chmod +x "$BINARY_NAME"
@@ -314,7 +314,7 @@ download_binary() {
     fi
 
     print_error "$(t download_failed)"
-    print_info "$(t compile_hint) $BINARY_NAME cmd/server/main.go"
+    print_info "$(t compile_hint) $BINARY_NAME ./cmd/server"
     return 1
 }
 